@@ -1,12 +1,28 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/version"
 	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/webhook/server"
 )
 
 func main() {
+	printVersion := flag.Bool("version", false, "print the build info and exit")
+	flag.Parse()
+
+	if *printVersion {
+		info, err := json.Marshal(version.Get())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(info))
+		return
+	}
+
 	err := server.StartServer()
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,42 @@
+package informermanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapDeleteReported(t *testing.T) {
+	cm := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "mix-scheduler", Namespace: "mix-scheduler-system"}}
+	client := fake.NewSimpleClientset(cm)
+
+	applied := make(chan struct{}, 1)
+	deleted := make(chan struct{}, 1)
+	manager := NewSingleClusterManager(context.Background(), client, WithConfigMap(cm.Namespace, cm.Name,
+		func(*v1.ConfigMap) { applied <- struct{}{} },
+		func() { deleted <- struct{}{} }))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	manager.StartInformer(stopCh)
+
+	select {
+	case <-applied:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the ConfigMap was never applied")
+	}
+
+	if err := client.CoreV1().ConfigMaps(cm.Namespace).Delete(context.Background(), cm.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete configmap: %v", err)
+	}
+
+	select {
+	case <-deleted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the ConfigMap delete was never reported")
+	}
+}
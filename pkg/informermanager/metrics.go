@@ -0,0 +1,28 @@
+package informermanager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// resource label of the cached objects
+const (
+	resourcePods       = "pods"
+	resourceNodes      = "nodes"
+	resourceNamespaces = "namespaces"
+)
+
+var (
+	cachedObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mix_scheduler_informer_cached_objects",
+		Help: "Number of objects in the informer cache by resource.",
+	}, []string{"resource"})
+
+	cacheSynced = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mix_scheduler_informer_synced",
+		Help: "Whether the informer cache is synced, 1 once it synced.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cachedObjects, cacheSynced)
+}
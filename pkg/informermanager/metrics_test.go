@@ -0,0 +1,105 @@
+package informermanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// gaugeValue the current value of the gauge
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	t.Helper()
+
+	out := &dto.Metric{}
+	if err := gauge.Write(out); err != nil {
+		t.Fatalf("write metric: %v", err)
+	}
+	return out.GetGauge().GetValue()
+}
+
+// cachedCounts the mix_scheduler_informer_cached_objects by resource
+func cachedCounts(t *testing.T) map[string]float64 {
+	t.Helper()
+
+	counts := map[string]float64{}
+	for _, resource := range []string{resourcePods, resourceNodes, resourceNamespaces} {
+		counts[resource] = gaugeValue(t, cachedObjects.WithLabelValues(resource))
+	}
+	return counts
+}
+
+func TestInformerMetricsRegistered(t *testing.T) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+
+	registered := map[string]bool{}
+	for _, family := range families {
+		registered[family.GetName()] = true
+	}
+	for _, name := range []string{"mix_scheduler_informer_cached_objects", "mix_scheduler_informer_synced"} {
+		if !registered[name] {
+			t.Errorf("%s not registered", name)
+		}
+	}
+}
+
+// the gauges are global, the managers of the other tests moved them too so the deltas are compared
+func TestInformerMetricsFollowCache(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		counterNode("od-1", "on-demand"),
+		counterPod("web-1", "web", "od-1", true),
+		counterPod("web-2", "web", "od-1", true),
+	)
+	before := cachedCounts(t)
+
+	s := NewSingleClusterManager(context.Background(), client)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go s.StartInformer(stopCh)
+
+	// waitFor polls the cache sizes until they moved by the deltas
+	waitFor := func(step string, want map[string]float64) {
+		t.Helper()
+
+		var got map[string]float64
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			got = cachedCounts(t)
+			moved := true
+			for resource, delta := range want {
+				moved = moved && got[resource]-before[resource] == delta
+			}
+			if moved {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s: cached objects %v, want %v more than %v", step, got, want, before)
+	}
+
+	waitFor("seeded", map[string]float64{resourcePods: 2, resourceNodes: 1, resourceNamespaces: 1})
+	deadline := time.Now().Add(5 * time.Second)
+	for !isSyncedWithin(t, s, time.Second) {
+		if time.Now().After(deadline) {
+			t.Fatal("informers not synced within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := gaugeValue(t, cacheSynced); got != 1 {
+		t.Errorf("mix_scheduler_informer_synced %v once synced, want 1", got)
+	}
+
+	if err := client.CoreV1().Pods("default").Delete(context.Background(), "web-2", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete pod: %v", err)
+	}
+	waitFor("pod deleted", map[string]float64{resourcePods: 1, resourceNodes: 1, resourceNamespaces: 1})
+}
@@ -0,0 +1,63 @@
+package informermanager
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultNodeCacheTTL bounds how long a cached value may be stale when the informer is not
+// running to invalidate it
+const defaultNodeCacheTTL = time.Minute
+
+type nodeCacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+// NodeCache caches a value derived from a node by node name, e.g. its capacity label,
+// entries expire after the TTL and are invalidated by the node informer when the node changes
+type NodeCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]nodeCacheEntry
+}
+
+func NewNodeCache(ttl time.Duration) *NodeCache {
+	return &NodeCache{
+		ttl:     ttl,
+		entries: make(map[string]nodeCacheEntry),
+	}
+}
+
+// Get the cached value of the node, ok is false when it is not cached or expired
+func (c *NodeCache) Get(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[name]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+
+	return entry.value, true
+}
+
+// Set caches the value of the node for the TTL
+func (c *NodeCache) Set(name, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[name] = nodeCacheEntry{
+		value:   value,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// Invalidate drops the cached value of the node
+func (c *NodeCache) Invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, name)
+}
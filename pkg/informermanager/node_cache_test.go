@@ -0,0 +1,80 @@
+package informermanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeCacheExpires(t *testing.T) {
+	c := NewNodeCache(50 * time.Millisecond)
+	c.Set("od-1", "on-demand")
+
+	if value, ok := c.Get("od-1"); !ok || value != "on-demand" {
+		t.Fatalf("cached %q %v, want on-demand", value, ok)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.Get("od-1"); ok {
+		t.Errorf("entry still cached after its TTL")
+	}
+}
+
+// cachedWithin polls the cache until the node's entry is cached or not, fails the test after the timeout
+func cachedWithin(t *testing.T, c *NodeCache, name string, cached bool, timeout time.Duration) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, ok := c.Get(name); ok == cached {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node %s cached %v after %v, want %v", name, !cached, timeout, cached)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNodeCacheInvalidatedByInformer(t *testing.T) {
+	node := counterNode("od-1", "on-demand")
+	client := fake.NewSimpleClientset(node)
+	manager := NewSingleClusterManager(context.Background(), client)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	manager.StartInformer(stopCh)
+
+	nodes := client.CoreV1().Nodes()
+	update := func(node *v1.Node) {
+		t.Helper()
+		if _, err := nodes.Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("update node: %v", err)
+		}
+	}
+
+	// a change besides the labels keeps the entry
+	manager.NodeCache.Set("od-1", "on-demand")
+	unschedulable := node.DeepCopy()
+	unschedulable.Spec.Unschedulable = true
+	update(unschedulable)
+	time.Sleep(200 * time.Millisecond)
+	cachedWithin(t, manager.NodeCache, "od-1", true, 0)
+
+	// relabeled
+	relabeled := unschedulable.DeepCopy()
+	relabeled.Labels[testCapacityLabel] = "spot"
+	update(relabeled)
+	cachedWithin(t, manager.NodeCache, "od-1", false, 5*time.Second)
+
+	// deleted
+	manager.NodeCache.Set("od-1", "spot")
+	if err := nodes.Delete(context.Background(), "od-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete node: %v", err)
+	}
+	cachedWithin(t, manager.NodeCache, "od-1", false, 5*time.Second)
+}
@@ -0,0 +1,139 @@
+package informermanager
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/client-go/listers/core/v1"
+)
+
+type podCountKey struct {
+	namespace string
+	labels    string
+}
+
+type podCountEntry struct {
+	key      podCountKey
+	nodeName string
+}
+
+// PodCounter counts the ready pods per namespace, label set and node incrementally
+// from the pod informer events, so the count of a workload is a lookup instead of a list.
+// The capacity of the nodes is looked up when the count is read, so a pod counts as soon as
+// its node is cached and follows a relabeled node. Terminating pods are not counted.
+type PodCounter struct {
+	capacityLabel string
+	// capacity of the nodes without the capacity label
+	defaultCapacity string
+	ready           func(pod *v1.Pod) bool
+	nodeLister      corev1.NodeLister
+
+	mu sync.RWMutex
+	// the ready pods per node of each namespace and label set
+	counts map[podCountKey]map[string]int
+	// the counter each counted pod contributes to
+	pods map[types.UID]podCountEntry
+}
+
+func newPodCounter(capacityLabel, defaultCapacity string, ready func(pod *v1.Pod) bool, nodeLister corev1.NodeLister) *PodCounter {
+	return &PodCounter{
+		capacityLabel:   capacityLabel,
+		defaultCapacity: defaultCapacity,
+		ready:           ready,
+		nodeLister:      nodeLister,
+		counts:          make(map[podCountKey]map[string]int),
+		pods:            make(map[types.UID]podCountEntry),
+	}
+}
+
+// entry the counter and node the pod contributes to, ok is false when it does not count
+func (c *PodCounter) entry(pod *v1.Pod) (podCountEntry, bool) {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || !c.ready(pod) {
+		return podCountEntry{}, false
+	}
+
+	return podCountEntry{
+		key: podCountKey{
+			namespace: pod.Namespace,
+			labels:    labels.Set(pod.Labels).String(),
+		},
+		nodeName: pod.Spec.NodeName,
+	}, true
+}
+
+// update moves the pod's contribution to the counter it counts for now, the counter it counted
+// for is remembered so a relabeled pod does not leave the old count behind
+func (c *PodCounter) update(pod *v1.Pod) {
+	entry, ok := c.entry(pod)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if oldEntry, counted := c.pods[pod.UID]; counted {
+		if ok && oldEntry == entry {
+			return
+		}
+		c.decrement(oldEntry)
+		delete(c.pods, pod.UID)
+	}
+
+	if ok {
+		nodes, exist := c.counts[entry.key]
+		if !exist {
+			nodes = make(map[string]int)
+			c.counts[entry.key] = nodes
+		}
+		nodes[entry.nodeName]++
+		c.pods[pod.UID] = entry
+	}
+}
+
+// remove drops the pod's contribution
+func (c *PodCounter) remove(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if oldKey, counted := c.pods[uid]; counted {
+		c.decrement(oldKey)
+		delete(c.pods, uid)
+	}
+}
+
+func (c *PodCounter) decrement(entry podCountEntry) {
+	nodes := c.counts[entry.key]
+	if nodes[entry.nodeName] <= 1 {
+		delete(nodes, entry.nodeName)
+	} else {
+		nodes[entry.nodeName]--
+	}
+	if len(nodes) == 0 {
+		delete(c.counts, entry.key)
+	}
+}
+
+// ReadyOnCapacity the number of ready pods in the namespace with exactly the labels on nodes of the capacity,
+// the pods on nodes not cached yet are not counted
+func (c *PodCounter) ReadyOnCapacity(namespace string, podLabels map[string]string, capacity string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	num := 0
+	for nodeName, count := range c.counts[podCountKey{namespace: namespace, labels: labels.Set(podLabels).String()}] {
+		node, err := c.nodeLister.Get(nodeName)
+		if err != nil {
+			continue
+		}
+
+		nodeCapacity, ok := node.Labels[c.capacityLabel]
+		if !ok {
+			nodeCapacity = c.defaultCapacity
+		}
+		if nodeCapacity == capacity {
+			num += count
+		}
+	}
+
+	return num
+}
@@ -0,0 +1,138 @@
+package informermanager
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testCapacityLabel = "node.kubernetes.io/capacity"
+
+func counterNode(name, capacity string) *v1.Node {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+	if capacity != "" {
+		node.Labels[testCapacityLabel] = capacity
+	}
+	return node
+}
+
+func counterPod(name, app, nodeName string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name), Labels: map[string]string{"app": app}},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}}},
+	}
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// listCount the count of a full list of the pods and nodes, what the counter has to agree with
+func listCount(pods map[string]*v1.Pod, nodes corev1.NodeLister, app, capacity string) int {
+	num := 0
+	for _, pod := range pods {
+		if pod.Labels["app"] != app || pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || !podReady(pod) {
+			continue
+		}
+		node, err := nodes.Get(pod.Spec.NodeName)
+		if err != nil {
+			continue
+		}
+		nodeCapacity, ok := node.Labels[testCapacityLabel]
+		if !ok {
+			nodeCapacity = "on-demand"
+		}
+		if nodeCapacity == capacity {
+			num++
+		}
+	}
+	return num
+}
+
+func TestPodCounterMatchesList(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	nodes := corev1.NewNodeLister(indexer)
+	counter := newPodCounter(testCapacityLabel, "on-demand", podReady, nodes)
+	pods := map[string]*v1.Pod{}
+
+	setPod := func(pod *v1.Pod) {
+		pods[pod.Name] = pod
+		counter.update(pod)
+	}
+	removePod := func(name string) {
+		counter.remove(pods[name].UID)
+		delete(pods, name)
+	}
+	setNode := func(node *v1.Node) {
+		if err := indexer.Update(node); err != nil {
+			t.Fatalf("update node: %v", err)
+		}
+	}
+
+	steps := []struct {
+		name string
+		do   func()
+	}{
+		{"pods on cached nodes", func() {
+			setNode(counterNode("od-1", "on-demand"))
+			setNode(counterNode("spot-1", "spot"))
+			setPod(counterPod("web-1", "web", "od-1", true))
+			setPod(counterPod("web-2", "web", "spot-1", true))
+			setPod(counterPod("api-1", "api", "od-1", true))
+		}},
+		{"pod on a node not cached yet", func() {
+			setPod(counterPod("web-3", "web", "spot-2", true))
+		}},
+		{"the node arrives", func() {
+			setNode(counterNode("spot-2", "spot"))
+		}},
+		{"a node relabeled", func() {
+			setNode(counterNode("spot-1", "on-demand"))
+		}},
+		{"a node unlabeled counts as the default", func() {
+			setNode(counterNode("spot-2", ""))
+		}},
+		{"a pod not ready", func() {
+			setPod(counterPod("web-1", "web", "od-1", false))
+		}},
+		{"a pod terminating", func() {
+			pod := counterPod("web-2", "web", "spot-1", true)
+			pod.DeletionTimestamp = &metav1.Time{}
+			setPod(pod)
+		}},
+		{"a pod deleted", func() {
+			removePod("web-3")
+		}},
+		{"a node deleted", func() {
+			if err := indexer.Delete(counterNode("od-1", "on-demand")); err != nil {
+				t.Fatalf("delete node: %v", err)
+			}
+		}},
+	}
+
+	for _, step := range steps {
+		step.do()
+		for _, app := range []string{"web", "api"} {
+			for _, capacity := range []string{"on-demand", "spot"} {
+				got := counter.ReadyOnCapacity("default", map[string]string{"app": app}, capacity)
+				if want := listCount(pods, nodes, app, capacity); got != want {
+					t.Errorf("%s: %s on %s counted %d, a full list %d", step.name, app, capacity, got, want)
+				}
+			}
+		}
+	}
+}
@@ -2,11 +2,18 @@ package informermanager
 
 import (
 	"context"
-	"sync"
+	"reflect"
+	"sync/atomic"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	appsv1 "k8s.io/client-go/listers/apps/v1"
 	corev1 "k8s.io/client-go/listers/core/v1"
+	policyv1 "k8s.io/client-go/listers/policy/v1"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -14,67 +21,264 @@ type SingleClusterManager struct {
 	PodLister       corev1.PodLister
 	NodeLister      corev1.NodeLister
 	NamespaceLister corev1.NamespaceLister
-	factory         informers.SharedInformerFactory
 
-	synced      bool
-	syncRWMutex sync.RWMutex
+	// derived node values, invalidated when a node's labels change
+	NodeCache *NodeCache
+	// ready pods per capacity, nil unless enabled
+	PodCounter *PodCounter
+
+	PersistentVolumeClaimLister corev1.PersistentVolumeClaimLister
+	PersistentVolumeLister      corev1.PersistentVolumeLister
+
+	ReplicaSetLister  appsv1.ReplicaSetLister
+	StatefulSetLister appsv1.StatefulSetLister
+
+	PodDisruptionBudgetLister policyv1.PodDisruptionBudgetLister
+
+	factory informers.SharedInformerFactory
+	// the factory of the pod informer, factory itself unless the pods are scoped
+	podFactory informers.SharedInformerFactory
+	// the factory of the watched ConfigMap, nil unless enabled
+	configMapFactory informers.SharedInformerFactory
+
+	// read by every request while StartInformer waits for the sync, never held across the wait
+	synced atomic.Bool
+}
+
+// Option configures the informers of the SingleClusterManager
+type Option func(*options)
+
+type options struct {
+	resync     time.Duration
+	podListOpt func(*metav1.ListOptions)
+
+	podCounterCapacityLabel string
+	podCounterDefault       string
+	podCounterReady         func(pod *v1.Pod) bool
+
+	configMapNamespace string
+	configMapName      string
+	configMapHandler   func(cm *v1.ConfigMap)
+	configMapDeleted   func()
+}
+
+// WithResync sets the resync period of the informers, 0 disables the periodic resync
+func WithResync(resync time.Duration) Option {
+	return func(o *options) {
+		o.resync = resync
+	}
+}
+
+// WithPodListOptions scopes the pod informer, e.g. by a field selector on the namespace or a label selector,
+// the other informers keep caching the whole cluster
+func WithPodListOptions(tweak func(*metav1.ListOptions)) Option {
+	return func(o *options) {
+		o.podListOpt = tweak
+	}
+}
+
+// WithPodCounter maintains a PodCounter of the pods ready by the func, per capacity label of their nodes,
+// the pods on nodes without the label count for defaultCapacity
+func WithPodCounter(capacityLabel, defaultCapacity string, ready func(pod *v1.Pod) bool) Option {
+	return func(o *options) {
+		o.podCounterCapacityLabel = capacityLabel
+		o.podCounterDefault = defaultCapacity
+		o.podCounterReady = ready
+	}
+}
+
+// WithConfigMap watches the ConfigMap and calls the handler with it whenever it is added or updated,
+// deleted is called when it is deleted
+func WithConfigMap(namespace, name string, handler func(cm *v1.ConfigMap), deleted func()) Option {
+	return func(o *options) {
+		o.configMapNamespace = namespace
+		o.configMapName = name
+		o.configMapHandler = handler
+		o.configMapDeleted = deleted
+	}
 }
 
-func NewSingleClusterManager(ctx context.Context, client kubernetes.Interface) *SingleClusterManager {
-	factory := informers.NewSharedInformerFactory(client, 0)
-	podInformer := factory.Core().V1().Pods().Informer()
+func NewSingleClusterManager(ctx context.Context, client kubernetes.Interface, opts ...Option) *SingleClusterManager {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	factory := informers.NewSharedInformerFactory(client, o.resync)
+
+	// list options apply to every informer of a factory, the scoped pods get their own
+	podFactory := factory
+	if o.podListOpt != nil {
+		podFactory = informers.NewSharedInformerFactoryWithOptions(client, o.resync, informers.WithTweakListOptions(o.podListOpt))
+	}
+
+	podInformer := podFactory.Core().V1().Pods().Informer()
 	nodeInformer := factory.Core().V1().Nodes().Informer()
 	namespaceInformer := factory.Core().V1().Namespaces().Informer()
 
-	podLister := factory.Core().V1().Pods().Lister()
+	podLister := podFactory.Core().V1().Pods().Lister()
+	nodeLister := factory.Core().V1().Nodes().Lister()
+
+	var podCounter *PodCounter
+	if o.podCounterReady != nil {
+		podCounter = newPodCounter(o.podCounterCapacityLabel, o.podCounterDefault, o.podCounterReady, nodeLister)
+	}
+
+	// the cache sizes follow the add and delete events, updates do not change them
+	podsCached := cachedObjects.WithLabelValues(resourcePods)
+	nodesCached := cachedObjects.WithLabelValues(resourceNodes)
+	namespacesCached := cachedObjects.WithLabelValues(resourceNamespaces)
+
 	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			podsCached.Inc()
+			if pod, ok := obj.(*v1.Pod); ok && podCounter != nil {
+				podCounter.update(pod)
+			}
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
+			if pod, ok := newObj.(*v1.Pod); ok && podCounter != nil {
+				podCounter.update(pod)
+			}
 		},
 		DeleteFunc: func(obj interface{}) {
+			podsCached.Dec()
+			if podCounter == nil {
+				return
+			}
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				podCounter.remove(pod.UID)
+			}
 		},
 	})
 
-	nodeLister := factory.Core().V1().Nodes().Lister()
+	nodeCache := NewNodeCache(defaultNodeCacheTTL)
 	nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			nodesCached.Inc()
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, oldOk := oldObj.(*v1.Node)
+			newNode, newOk := newObj.(*v1.Node)
+			if oldOk && newOk && !reflect.DeepEqual(oldNode.Labels, newNode.Labels) {
+				nodeCache.Invalidate(newNode.Name)
+			}
 		},
 		DeleteFunc: func(obj interface{}) {
+			nodesCached.Dec()
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				nodeCache.Invalidate(tombstone.Key)
+				return
+			}
+			if node, ok := obj.(*v1.Node); ok {
+				nodeCache.Invalidate(node.Name)
+			}
 		},
 	})
 
 	namespaceLister := factory.Core().V1().Namespaces().Lister()
 	namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
+			namespacesCached.Inc()
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 		},
 		DeleteFunc: func(obj interface{}) {
+			namespacesCached.Dec()
 		},
 	})
 
+	// volume node affinity, PersistentVolumeClaim -> PersistentVolume
+	persistentVolumeClaimLister := factory.Core().V1().PersistentVolumeClaims().Lister()
+	persistentVolumeLister := factory.Core().V1().PersistentVolumes().Lister()
+
+	// owner resolution and replicas, ReplicaSet -> Deployment, StatefulSet
+	replicaSetLister := factory.Apps().V1().ReplicaSets().Lister()
+	statefulSetLister := factory.Apps().V1().StatefulSets().Lister()
+
+	// live config, only the one ConfigMap is cached
+	var configMapFactory informers.SharedInformerFactory
+	if o.configMapHandler != nil {
+		configMapFactory = informers.NewSharedInformerFactoryWithOptions(client, o.resync,
+			informers.WithNamespace(o.configMapNamespace),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", o.configMapName).String()
+			}))
+
+		configMapFactory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if cm, ok := obj.(*v1.ConfigMap); ok {
+					o.configMapHandler(cm)
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldCm, oldOk := oldObj.(*v1.ConfigMap)
+				newCm, newOk := newObj.(*v1.ConfigMap)
+				if oldOk && newOk && oldCm.ResourceVersion != newCm.ResourceVersion {
+					o.configMapHandler(newCm)
+				}
+			},
+			// only the one ConfigMap is watched, a tombstone is its delete as well
+			DeleteFunc: func(obj interface{}) {
+				if o.configMapDeleted != nil {
+					o.configMapDeleted()
+				}
+			},
+		})
+	}
+
+	// eviction guard, PodDisruptionBudgets governing the pod
+	podDisruptionBudgetLister := factory.Policy().V1().PodDisruptionBudgets().Lister()
+
 	return &SingleClusterManager{
 		PodLister:       podLister,
 		NodeLister:      nodeLister,
 		NamespaceLister: namespaceLister,
-		factory:         factory,
+
+		NodeCache:  nodeCache,
+		PodCounter: podCounter,
+
+		PersistentVolumeClaimLister: persistentVolumeClaimLister,
+		PersistentVolumeLister:      persistentVolumeLister,
+
+		ReplicaSetLister:  replicaSetLister,
+		StatefulSetLister: statefulSetLister,
+
+		PodDisruptionBudgetLister: podDisruptionBudgetLister,
+		factory:                   factory,
+		podFactory:                podFactory,
+		configMapFactory:          configMapFactory,
 	}
 }
 
 func (s *SingleClusterManager) StartInformer(stopCh <-chan struct{}) {
 	s.factory.Start(stopCh)
+	s.podFactory.Start(stopCh)
+	if s.configMapFactory != nil {
+		s.configMapFactory.Start(stopCh)
+	}
 
-	s.syncRWMutex.Lock()
-	defer s.syncRWMutex.Unlock()
 	s.factory.WaitForCacheSync(stopCh)
-	s.synced = true
+	s.podFactory.WaitForCacheSync(stopCh)
+	if s.configMapFactory != nil {
+		s.configMapFactory.WaitForCacheSync(stopCh)
+	}
+
+	// stopped before the informers synced, the listers are incomplete
+	select {
+	case <-stopCh:
+		return
+	default:
+	}
+
+	s.synced.Store(true)
+	cacheSynced.Set(1)
 }
 
+// IsSynced reports whether the informer caches are synced, it does not wait for them
 func (s *SingleClusterManager) IsSynced() bool {
-	s.syncRWMutex.RLock()
-	defer s.syncRWMutex.RUnlock()
-	return s.synced
+	return s.synced.Load()
 }
@@ -0,0 +1,81 @@
+package informermanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// neverSyncing a clientset whose PersistentVolumes can not be listed, so the informers never sync
+func neverSyncing() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "persistentvolumes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("persistentvolumes unavailable")
+	})
+	return client
+}
+
+// isSyncedWithin calls IsSynced, fails the test when it does not return within the timeout
+func isSyncedWithin(t *testing.T, s *SingleClusterManager, timeout time.Duration) bool {
+	t.Helper()
+
+	result := make(chan bool, 1)
+	go func() { result <- s.IsSynced() }()
+
+	select {
+	case synced := <-result:
+		return synced
+	case <-time.After(timeout):
+		t.Fatalf("IsSynced blocked for %v", timeout)
+		return false
+	}
+}
+
+func TestIsSyncedDoesNotBlockWhileSyncing(t *testing.T) {
+	s := NewSingleClusterManager(context.Background(), neverSyncing())
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.StartInformer(stopCh)
+		close(done)
+	}()
+
+	// give StartInformer time to enter WaitForCacheSync
+	time.Sleep(100 * time.Millisecond)
+	if isSyncedWithin(t, s, time.Second) {
+		t.Fatal("synced although the persistentvolumes can not be listed")
+	}
+
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartInformer did not return after stop")
+	}
+
+	if isSyncedWithin(t, s, time.Second) {
+		t.Error("synced after being stopped before the informers synced")
+	}
+}
+
+func TestStartInformerSyncs(t *testing.T) {
+	s := NewSingleClusterManager(context.Background(), fake.NewSimpleClientset())
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go s.StartInformer(stopCh)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !isSyncedWithin(t, s, time.Second) {
+		if time.Now().After(deadline) {
+			t.Fatal("informers not synced within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,38 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// set by the linker, e.g.
+// -ldflags "-X github.com/helen-frank/mix-scheduler-admission-webhook/pkg/version.Version=v1.0.0"
+var (
+	Version   = "unknown"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info the build info of the binary
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Get the build info of the binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+func (info Info) String() string {
+	return fmt.Sprintf("version %s, commit %s, built %s with %s for %s", info.Version, info.GitCommit, info.BuildDate, info.GoVersion, info.Platform)
+}
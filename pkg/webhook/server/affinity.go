@@ -0,0 +1,345 @@
+package server
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/klog/v2"
+)
+
+// nodeAffinityConflictPolicy decides what happens when the pod's required node affinity
+// does not allow the capacity the webhook wants to pin it to
+type nodeAffinityConflictPolicy string
+
+const (
+	// respect the pod's node affinity, do not inject the nodeSelector
+	nodeAffinityConflictRespectAffinity nodeAffinityConflictPolicy = "respect-affinity"
+	// inject the nodeSelector and drop the conflicting capacity requirements from the node affinity
+	nodeAffinityConflictOverrideWithSelector nodeAffinityConflictPolicy = "override-with-selector"
+	// reject the pod
+	nodeAffinityConflictDeny nodeAffinityConflictPolicy = "deny"
+)
+
+func parseNodeAffinityConflictPolicy(val string) (nodeAffinityConflictPolicy, error) {
+	switch policy := nodeAffinityConflictPolicy(val); policy {
+	case nodeAffinityConflictRespectAffinity, nodeAffinityConflictOverrideWithSelector, nodeAffinityConflictDeny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid node affinity conflict policy %q, must be one of %s|%s|%s", val,
+			nodeAffinityConflictRespectAffinity, nodeAffinityConflictOverrideWithSelector, nodeAffinityConflictDeny)
+	}
+}
+
+// capacityRequirementMatches reports whether a node labeled capacityKey=capacity satisfies the requirement,
+// requirements on other keys are ignored
+func capacityRequirementMatches(req corev1.NodeSelectorRequirement, capacity string) bool {
+	if req.Key != capacityKey {
+		return true
+	}
+
+	switch req.Operator {
+	case corev1.NodeSelectorOpIn:
+		for _, v := range req.Values {
+			if v == capacity {
+				return true
+			}
+		}
+		return false
+	case corev1.NodeSelectorOpNotIn:
+		for _, v := range req.Values {
+			if v == capacity {
+				return false
+			}
+		}
+		return true
+	case corev1.NodeSelectorOpExists:
+		return true
+	case corev1.NodeSelectorOpDoesNotExist:
+		return false
+	default:
+		// Gt/Lt on the capacity label never match a non-numeric capacity value
+		return false
+	}
+}
+
+// nodeAffinityAllowsCapacity reports whether the pod's required node affinity can be satisfied
+// by a node of the given capacity, terms are ORed and expressions within a term are ANDed
+func nodeAffinityAllowsCapacity(podSpec corev1.PodSpec, capacity string) bool {
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil ||
+		podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+
+	terms := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		return true
+	}
+
+	for ti := range terms {
+		matched := true
+		for _, req := range terms[ti].MatchExpressions {
+			if !capacityRequirementMatches(req, capacity) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dropCapacityNodeAffinity removes the capacity requirements from the required node affinity terms
+// so that the injected nodeSelector is the only capacity constraint left
+func dropCapacityNodeAffinity(affinity *corev1.Affinity) {
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return
+	}
+
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	terms := make([]corev1.NodeSelectorTerm, 0, len(required.NodeSelectorTerms))
+	for _, term := range required.NodeSelectorTerms {
+		exprs := make([]corev1.NodeSelectorRequirement, 0, len(term.MatchExpressions))
+		for _, req := range term.MatchExpressions {
+			if req.Key != capacityKey {
+				exprs = append(exprs, req)
+			}
+		}
+
+		// the term only constrained the capacity, without it any node matches,
+		// an empty term would match no nodes so drop the whole requirement instead
+		if len(exprs) == 0 && len(term.MatchFields) == 0 {
+			affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = nil
+			return
+		}
+
+		term.MatchExpressions = exprs
+		terms = append(terms, term)
+	}
+
+	required.NodeSelectorTerms = terms
+}
+
+// unsatisfiableAffinityPolicy decides what happens when no node of the target capacity
+// satisfies the pod's existing required node affinity
+type unsatisfiableAffinityPolicy string
+
+const (
+	// leave the pod to the scheduler without injecting the placement
+	unsatisfiableAffinityFallback unsatisfiableAffinityPolicy = "fallback"
+	// reject the pod
+	unsatisfiableAffinityDeny unsatisfiableAffinityPolicy = "deny"
+)
+
+func parseUnsatisfiableAffinityPolicy(val string) (unsatisfiableAffinityPolicy, error) {
+	switch policy := unsatisfiableAffinityPolicy(val); policy {
+	case unsatisfiableAffinityFallback, unsatisfiableAffinityDeny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid unsatisfiable affinity policy %q, must be one of %s|%s", val,
+			unsatisfiableAffinityFallback, unsatisfiableAffinityDeny)
+	}
+}
+
+// nodeSelectorRequirementsAsSelector converts node selector requirements to a label selector
+func nodeSelectorRequirementsAsSelector(reqs []corev1.NodeSelectorRequirement) (labels.Selector, error) {
+	selector := labels.NewSelector()
+	for _, req := range reqs {
+		var op selection.Operator
+		switch req.Operator {
+		case corev1.NodeSelectorOpIn:
+			op = selection.In
+		case corev1.NodeSelectorOpNotIn:
+			op = selection.NotIn
+		case corev1.NodeSelectorOpExists:
+			op = selection.Exists
+		case corev1.NodeSelectorOpDoesNotExist:
+			op = selection.DoesNotExist
+		case corev1.NodeSelectorOpGt:
+			op = selection.GreaterThan
+		case corev1.NodeSelectorOpLt:
+			op = selection.LessThan
+		default:
+			return nil, fmt.Errorf("%q is not a valid node selector operator", req.Operator)
+		}
+
+		r, err := labels.NewRequirement(req.Key, op, req.Values)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*r)
+	}
+
+	return selector, nil
+}
+
+// nodeMatchesFields evaluates the matchFields of a term, only metadata.name is supported by the scheduler
+func nodeMatchesFields(node *corev1.Node, reqs []corev1.NodeSelectorRequirement) bool {
+	for _, req := range reqs {
+		if req.Key != "metadata.name" {
+			return false
+		}
+
+		found := false
+		for _, v := range req.Values {
+			if v == node.Name {
+				found = true
+				break
+			}
+		}
+
+		switch req.Operator {
+		case corev1.NodeSelectorOpIn:
+			if !found {
+				return false
+			}
+		case corev1.NodeSelectorOpNotIn:
+			if found {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// nodeMatchesRequiredAffinity reports whether the node satisfies the pod's nodeSelector and required node affinity
+func nodeMatchesRequiredAffinity(node *corev1.Node, podSpec corev1.PodSpec) bool {
+	if !labels.SelectorFromSet(podSpec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil ||
+		podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+
+	return nodeMatchesNodeSelector(node, podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+}
+
+// nodeMatchesNodeSelector reports whether the node matches any of the selector terms
+func nodeMatchesNodeSelector(node *corev1.Node, nodeSelector *corev1.NodeSelector) bool {
+	for _, term := range nodeSelector.NodeSelectorTerms {
+		// an empty term matches no nodes
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		selector, err := nodeSelectorRequirementsAsSelector(term.MatchExpressions)
+		if err != nil {
+			klog.Errorf("parse node selector term: %v", err)
+			continue
+		}
+
+		if selector.Matches(labels.Set(node.Labels)) && nodeMatchesFields(node, term.MatchFields) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// placementSatisfiable reports whether any node of the capacity satisfies the pod spec with the affinity
+// the pod is patched with, e.g. overridden by NODE_AFFINITY_CONFLICT_POLICY, once the placement is applied
+// and can hold the pod's requests
+func (app *App) placementSatisfiable(pod *corev1.Pod, affinity *corev1.Affinity, capacity string) (bool, error) {
+	nodes, err := app.ListNode(app.capacitySelector(capacity))
+	if err != nil {
+		return false, internalErrorf("get %s nodes: %v", capacity, err)
+	}
+
+	// the capacity key of the pod's own nodeSelector is replaced by the placement
+	spec := pod.Spec.DeepCopy()
+	delete(spec.NodeSelector, capacityKey)
+	spec.Affinity = affinity
+
+	reqs := podRequests(pod)
+
+	for ni := range nodes {
+		if nodeMatchesRequiredAffinity(nodes[ni], *spec) && nodeFitsRequests(nodes[ni], reqs) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// placementMode decides how the pod is steered to its target capacity
+type placementMode string
+
+const (
+	// set the capacity key of the pod's nodeSelector
+	placementNodeSelector placementMode = "nodeSelector"
+	// add a preferred node affinity term, the scheduler may fall back to other capacity
+	placementPreferredAffinity placementMode = "preferredAffinity"
+	// require the capacity in every required node affinity term
+	placementRequiredAffinity placementMode = "requiredAffinity"
+)
+
+func parsePlacementMode(val string) (placementMode, error) {
+	switch mode := placementMode(val); mode {
+	case placementNodeSelector, placementPreferredAffinity, placementRequiredAffinity:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid placement mode %q, must be one of %s|%s|%s", val,
+			placementNodeSelector, placementPreferredAffinity, placementRequiredAffinity)
+	}
+}
+
+// preferCapacityNodeAffinity adds a preferred node affinity term toward the capacity label values,
+// the scheduler may still fall back to other capacity
+func preferCapacityNodeAffinity(affinity *corev1.Affinity, values []string, weight int32) {
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.PreferredSchedulingTerm{
+			Weight: weight,
+			Preference: corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{
+						Key:      capacityKey,
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   values,
+					},
+				},
+			},
+		})
+}
+
+// requireCapacityNodeAffinity requires the capacity label values in the required node affinity, terms are ORed
+// so the requirement is added to each of them
+func requireCapacityNodeAffinity(affinity *corev1.Affinity, values []string) {
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	req := corev1.NodeSelectorRequirement{
+		Key:      capacityKey,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   values,
+	}
+
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{req}},
+			},
+		}
+		return
+	}
+
+	for ti := range required.NodeSelectorTerms {
+		required.NodeSelectorTerms[ti].MatchExpressions = append(required.NodeSelectorTerms[ti].MatchExpressions, req)
+	}
+}
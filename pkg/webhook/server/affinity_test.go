@@ -0,0 +1,348 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// requireCapacity the pod with a required node affinity on the capacity values
+func requireCapacity(pod *corev1.Pod, values ...string) *corev1.Pod {
+	pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: capacityKey, Operator: corev1.NodeSelectorOpIn, Values: values}},
+			}},
+		},
+	}}
+	return pod
+}
+
+func TestNodeAffinityConflictPolicy(t *testing.T) {
+	tests := []struct {
+		policy  nodeAffinityConflictPolicy
+		allowed bool
+		// whether the on-demand nodeSelector is injected
+		pinned bool
+	}{
+		{policy: nodeAffinityConflictRespectAffinity, allowed: true},
+		{policy: nodeAffinityConflictOverrideWithSelector, allowed: true, pinned: true},
+		{policy: nodeAffinityConflictDeny},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, 1, 0)
+			app.nodeAffinityConflictPolicy = tt.policy
+
+			// below the on-demand minimum, the pod only allows spot nodes
+			resp := mutate(t, app, podReview(t, admissionv1.Create, requireCapacity(testCreatedPod("web"), spotKey)))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+
+			patch := patchOf(t, resp)
+			if _, ok := findPatch(patch, "/spec/nodeSelector"); ok != tt.pinned {
+				t.Fatalf("nodeSelector patched %v, want %v: %s", ok, tt.pinned, resp.Patch)
+			}
+			if !tt.pinned {
+				return
+			}
+
+			var affinity corev1.Affinity
+			decodePatchValue(t, patch, "/spec/affinity", &affinity)
+			if affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+				t.Errorf("conflicting required node affinity kept: %s", mustJSON(t, affinity.NodeAffinity))
+			}
+		})
+	}
+}
+
+func TestNodeAffinityAllowingCapacityPinned(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	setMinimums(app, 1, 0)
+	app.nodeAffinityConflictPolicy = nodeAffinityConflictDeny
+
+	resp := mutate(t, app, podReview(t, admissionv1.Create, requireCapacity(testCreatedPod("web"), ondemandKey, spotKey)))
+	if !resp.Allowed {
+		t.Fatalf("pod denied: %v", resp.Result)
+	}
+
+	var nodeSelector map[string]string
+	decodePatchValue(t, patchOf(t, resp), "/spec/nodeSelector", &nodeSelector)
+	if nodeSelector[capacityKey] != ondemandKey {
+		t.Errorf("nodeSelector %v, want %s", nodeSelector, ondemandKey)
+	}
+}
+
+// zonedNode the node of the capacity in the zone
+func zonedNode(name, capacity, zone string) *corev1.Node {
+	node := testNode(name, capacity)
+	node.Labels[corev1.LabelTopologyZone] = zone
+	return node
+}
+
+func TestValidateNodeAffinity(t *testing.T) {
+	// the pod requires zone a, its required affinity says nothing about the capacity
+	pod := func() *corev1.Pod {
+		pod := testCreatedPod("web")
+		pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+				}},
+			},
+		}}
+		return pod
+	}
+
+	tests := []struct {
+		name    string
+		zone    string
+		policy  unsatisfiableAffinityPolicy
+		allowed bool
+		pinned  bool
+	}{
+		{name: "satisfiable", zone: "a", policy: unsatisfiableAffinityDeny, allowed: true, pinned: true},
+		{name: "unsatisfiable falls back", zone: "b", policy: unsatisfiableAffinityFallback, allowed: true},
+		{name: "unsatisfiable denied", zone: "b", policy: unsatisfiableAffinityDeny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, zonedNode("od-1", ondemandKey, tt.zone), zonedNode("spot-1", spotKey, "a"))
+			setMinimums(app, 1, 0)
+			app.validateNodeAffinity = true
+			app.unsatisfiableAffinityPolicy = tt.policy
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod()))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if _, ok := findPatch(patchOf(t, resp), "/spec/nodeSelector"); ok != tt.pinned {
+				t.Errorf("nodeSelector patched %v, want %v: %s", ok, tt.pinned, resp.Patch)
+			}
+		})
+	}
+}
+
+func TestAntiAffinityTopologyKey(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	setMinimums(app, 1, 0)
+	app.AntiAffinityTopologyKey = corev1.LabelTopologyZone
+
+	resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+
+	var affinity corev1.Affinity
+	decodePatchValue(t, patchOf(t, resp), "/spec/affinity", &affinity)
+	terms := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || terms[0].PodAffinityTerm.TopologyKey != corev1.LabelTopologyZone {
+		t.Errorf("anti-affinity terms %s, want one over %s", mustJSON(t, terms), corev1.LabelTopologyZone)
+	}
+}
+
+func TestExistingPreferredTermsKept(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	setMinimums(app, 1, 0)
+
+	userTerm := corev1.WeightedPodAffinityTerm{
+		Weight: 50,
+		PodAffinityTerm: corev1.PodAffinityTerm{
+			TopologyKey:   corev1.LabelTopologyZone,
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}},
+		},
+	}
+	userPreference := corev1.PreferredSchedulingTerm{
+		Weight:     10,
+		Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "disktype", Operator: corev1.NodeSelectorOpIn, Values: []string{"ssd"}}}},
+	}
+
+	pod := testCreatedPod("web")
+	pod.Spec.Affinity = &corev1.Affinity{
+		NodeAffinity:    &corev1.NodeAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{userPreference}},
+		PodAntiAffinity: &corev1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{userTerm}},
+	}
+
+	resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+
+	var affinity corev1.Affinity
+	decodePatchValue(t, patchOf(t, resp), "/spec/affinity", &affinity)
+
+	terms := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 2 || !equality.Semantic.DeepEqual(terms[0], userTerm) || terms[1].PodAffinityTerm.TopologyKey != hostnameTopologyKey {
+		t.Errorf("anti-affinity terms %s, want the user's term followed by the injected one", mustJSON(t, terms))
+	}
+	if preferences := affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution; len(preferences) != 1 ||
+		!equality.Semantic.DeepEqual(preferences[0], userPreference) {
+		t.Errorf("node affinity preferences %s, want the user's one", mustJSON(t, preferences))
+	}
+}
+
+// the patch adds the capacity key, the keys the pod selects nodes by survive it
+func TestNodeSelectorKeysKept(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector map[string]string
+	}{
+		{name: "without nodeSelector"},
+		{name: "empty nodeSelector", selector: map[string]string{}},
+		{name: "user keys", selector: map[string]string{"disktype": "ssd", corev1.LabelOSStable: "linux"}},
+		{name: "stale capacity key", selector: map[string]string{"disktype": "ssd", capacityKey: ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+
+			pod := testCreatedPod("web")
+			pod.Spec.NodeSelector = tt.selector
+
+			patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+
+			want := map[string]string{capacityKey: ondemandKey}
+			for key, value := range tt.selector {
+				if key != capacityKey {
+					want[key] = value
+				}
+			}
+			if !equality.Semantic.DeepEqual(patched.Spec.NodeSelector, want) {
+				t.Errorf("nodeSelector %v, want %v", patched.Spec.NodeSelector, want)
+			}
+		})
+	}
+}
+
+func TestPlacementModes(t *testing.T) {
+	onDemand := corev1.NodeSelectorRequirement{Key: capacityKey, Operator: corev1.NodeSelectorOpIn, Values: []string{ondemandKey}}
+	zoneA := corev1.NodeSelectorRequirement{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	zoneB := corev1.NodeSelectorRequirement{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}
+
+	tests := []struct {
+		name     string
+		mode     placementMode
+		pod      func() *corev1.Pod
+		selector map[string]string
+		// the node affinity of the patched pod, nil for none
+		nodeAffinity *corev1.NodeAffinity
+	}{
+		{
+			name:     "nodeSelector",
+			mode:     placementNodeSelector,
+			pod:      func() *corev1.Pod { return testCreatedPod("web") },
+			selector: map[string]string{capacityKey: ondemandKey},
+		},
+		{
+			name: "preferredAffinity",
+			mode: placementPreferredAffinity,
+			pod:  func() *corev1.Pod { return testCreatedPod("web") },
+			nodeAffinity: &corev1.NodeAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+					Weight:     100,
+					Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{onDemand}},
+				}},
+			},
+		},
+		{
+			name: "requiredAffinity",
+			mode: placementRequiredAffinity,
+			pod:  func() *corev1.Pod { return testCreatedPod("web") },
+			nodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{onDemand}}},
+				},
+			},
+		},
+		{
+			name: "requiredAffinity adds the capacity to each of the pod's terms",
+			mode: placementRequiredAffinity,
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{
+							{MatchExpressions: []corev1.NodeSelectorRequirement{zoneA}},
+							{MatchExpressions: []corev1.NodeSelectorRequirement{zoneB}},
+						},
+					},
+				}}
+				return pod
+			},
+			nodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{MatchExpressions: []corev1.NodeSelectorRequirement{zoneA, onDemand}},
+						{MatchExpressions: []corev1.NodeSelectorRequirement{zoneB, onDemand}},
+					},
+				},
+			},
+		},
+		{
+			name: "a capacity label forces the nodeSelector",
+			mode: placementPreferredAffinity,
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Labels[capacityLabel] = ondemandKey
+				return pod
+			},
+			selector: map[string]string{capacityKey: ondemandKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+			app.placementMode = tt.mode
+
+			pod := tt.pod()
+			patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+
+			if !equality.Semantic.DeepEqual(patched.Spec.NodeSelector, tt.selector) {
+				t.Errorf("nodeSelector %v, want %v", patched.Spec.NodeSelector, tt.selector)
+			}
+			if !equality.Semantic.DeepEqual(patched.Spec.Affinity.NodeAffinity, tt.nodeAffinity) {
+				t.Errorf("node affinity %+v, want %+v", patched.Spec.Affinity.NodeAffinity, tt.nodeAffinity)
+			}
+		})
+	}
+}
+
+// the override drops the conflicting capacity requirement, the satisfiability check must not see it
+func TestValidateOverriddenNodeAffinity(t *testing.T) {
+	app := newTestApp(t, zonedNode("od-1", ondemandKey, "a"), zonedNode("spot-1", spotKey, "a"))
+	setMinimums(app, 1, 0)
+	app.nodeAffinityConflictPolicy = nodeAffinityConflictOverrideWithSelector
+	app.validateNodeAffinity = true
+	app.unsatisfiableAffinityPolicy = unsatisfiableAffinityDeny
+
+	// below the on-demand minimum, the pod only allows spot nodes of zone a
+	pod := requireCapacity(testCreatedPod("web"), spotKey)
+	term := &pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0]
+	term.MatchExpressions = append(term.MatchExpressions, corev1.NodeSelectorRequirement{Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}})
+
+	resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+	if !resp.Allowed {
+		t.Fatalf("pod denied: %v", resp.Result)
+	}
+
+	patch := patchOf(t, resp)
+	var nodeSelector map[string]string
+	decodePatchValue(t, patch, "/spec/nodeSelector", &nodeSelector)
+	if nodeSelector[capacityKey] != ondemandKey {
+		t.Errorf("nodeSelector %v, want %s", nodeSelector, ondemandKey)
+	}
+
+	// the zone requirement stays, only the capacity one is overridden
+	var affinity corev1.Affinity
+	decodePatchValue(t, patch, "/spec/affinity", &affinity)
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) != 1 || len(required.NodeSelectorTerms[0].MatchExpressions) != 1 ||
+		required.NodeSelectorTerms[0].MatchExpressions[0].Key != corev1.LabelTopologyZone {
+		t.Errorf("required node affinity %s, want only the zone requirement", mustJSON(t, affinity.NodeAffinity))
+	}
+}
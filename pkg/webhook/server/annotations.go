@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// parseAnnotationTemplate parses comma separated key=value annotations, ${ENV} in values is left unexpanded
+func parseAnnotationTemplate(val string) (map[string]string, error) {
+	annotations := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimSpace(val), ",") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid annotation %q, must be key=value", kv)
+		}
+		annotations[strings.TrimSpace(key)] = value
+	}
+
+	return annotations, nil
+}
+
+// expandAnnotationTemplate the annotations with ${ENV} in values expanded, the values added to the pods
+func expandAnnotationTemplate(template map[string]string) map[string]string {
+	annotations := make(map[string]string, len(template))
+	for key, value := range template {
+		annotations[key] = os.ExpandEnv(value)
+	}
+
+	return annotations
+}
+
+// escapeJSONPointer escapes a map key for use in a JSONPatch path
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// annotationPatch the patch adding the template annotations the pod does not set itself
+func (app *App) annotationPatch(pod *corev1.Pod) []JSONPatchEntry {
+	if len(app.annotationTemplate) == 0 {
+		return nil
+	}
+
+	if pod.Annotations == nil {
+		value, err := json.Marshal(app.annotationTemplate)
+		if err != nil {
+			klog.Errorf("marshal annotations: %v", err)
+			return nil
+		}
+
+		return []JSONPatchEntry{
+			{
+				OP:    "add",
+				Path:  "/metadata/annotations",
+				Value: value,
+			},
+		}
+	}
+
+	keys := make([]string, 0, len(app.annotationTemplate))
+	for key := range app.annotationTemplate {
+		if _, ok := pod.Annotations[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	patch := make([]JSONPatchEntry, 0, len(keys))
+	for _, key := range keys {
+		value, err := json.Marshal(app.annotationTemplate[key])
+		if err != nil {
+			klog.Errorf("marshal annotation %s: %v", key, err)
+			continue
+		}
+
+		patch = append(patch, JSONPatchEntry{
+			OP:    "add",
+			Path:  "/metadata/annotations/" + escapeJSONPointer(key),
+			Value: value,
+		})
+	}
+
+	return patch
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestAnnotationTemplate(t *testing.T) {
+	t.Setenv("CLUSTER_NAME", "prod-1")
+
+	template, err := parseAnnotationTemplate("cluster=${CLUSTER_NAME},example.com/team=platform")
+	if err != nil {
+		t.Fatalf("parse annotation template: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		existing map[string]string
+		// the annotations patched in by path
+		want map[string]string
+	}{
+		{
+			name: "pod without annotations",
+			want: map[string]string{"/metadata/annotations": `{"cluster":"prod-1","example.com/team":"platform"}`},
+		},
+		{
+			name:     "existing annotations kept",
+			existing: map[string]string{"cluster": "staging"},
+			want:     map[string]string{"/metadata/annotations/example.com~1team": `"platform"`},
+		},
+		{
+			name:     "all set by the pod",
+			existing: map[string]string{"cluster": "staging", "example.com/team": "web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+			app.annotationTemplate = expandAnnotationTemplate(template)
+
+			pod := testCreatedPod("web")
+			pod.Annotations = tt.existing
+
+			patch := patchOf(t, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+			annotations := 0
+			for _, entry := range patch {
+				if strings.HasPrefix(entry.Path, "/metadata/annotations") {
+					annotations++
+					if want, ok := tt.want[entry.Path]; !ok || string(entry.Value) != want {
+						t.Errorf("patch %s %s, want %q", entry.Path, entry.Value, want)
+					}
+				}
+			}
+			if annotations != len(tt.want) {
+				t.Errorf("%d annotation patches, want %d: %s", annotations, len(tt.want), mustJSON(t, patch))
+			}
+		})
+	}
+}
+
+func TestAnnotationTemplateInvalid(t *testing.T) {
+	for _, val := range []string{"cluster", "=prod", "cluster=prod,,team=web"} {
+		if _, err := parseAnnotationTemplate(val); err == nil {
+			t.Errorf("annotation template %q parsed", val)
+		}
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
 	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/informermanager"
@@ -24,26 +30,183 @@ const (
 	ondemandWeithtKey = "on-demand/weight"
 
 	mixSchedulerKey = "mix-scheduler-admission-webhook"
+
+	hostnameTopologyKey = "kubernetes.io/hostname"
+
+	// the API server limits objects to 3MB
+	defaultMaxRequestBytes = 3 * 1024 * 1024
 )
 
 type App struct {
-	Client            kubernetes.Interface
-	Ctx               context.Context
-	OnDemandMinPodNum int
-	SpotMinPodNum     int
-
-	mixSchedulerRequierd   bool
-	notControllerNamespace map[string]struct{}
+	Client kubernetes.Interface
+	Ctx    context.Context
+
+	// the minimums and the namespace lists and selector, a CONFIG_CONFIGMAP reload swaps in a new snapshot
+	// so the requests read it without locking, never modify a loaded snapshot
+	config atomic.Pointer[reloadableConfig]
+	// the reloadable config from the env, the base the ConfigMap is applied on
+	envConfig reloadableConfig
+
+	// percentage of a workload's pods pinned to on-demand, the larger of it and the on-demand minimum applies
+	ondemandMinPercent int
+	// workloads with fewer replicas, by their observed pods, are left to the scheduler, 0 to act on all
+	minReplicasToAct int
+	// the capacities pods are pinned to by minimum, filled in order, on-demand alone by default
+	tiers []capacityTier
+
+	// topology key the injected pod anti-affinity spreads over
+	AntiAffinityTopologyKey string
+	// weight of the injected pod anti-affinity term, 1-100
+	AntiAffinityWeight int32
+
+	// compute and log the patches without applying them
+	dryRun bool
+
+	// deadline of each call to the API server while the informers are not synced
+	clientTimeout time.Duration
+	// how long a request waits for the informers to sync before it is allowed unchanged, 0 to not wait
+	cacheSyncWait time.Duration
+
+	mixSchedulerRequierd bool
+	// only pods whose labels match are controlled, nil for all pods
+	controlledPodSelector labels.Selector
+
+	// capacity label values of the spot nodes, e.g. spot and preemptible
+	spotValues []string
+	// capacity the nodes without the capacity label count for, empty to not count their pods
+	unlabeledNodeCapacity string
 
 	ondemandNodeSelector map[string]string
 	spotNodeSelector     map[string]string
 
+	nodeAffinityConflictPolicy nodeAffinityConflictPolicy
+
+	topologySpreadPolicy topologySpreadPolicy
+
+	nodeNamePolicy nodeNamePolicy
+	// how a pod is placed when its capacity has no schedulable node
+	emptyCapacityPolicy emptyCapacityPolicy
+	// what happens to the request when the webhook fails internally
+	failurePolicy failurePolicy
+	// how the target capacity of a created pod is chosen
+	capacityMode capacityMode
+	// steer the pods above the on-demand minimum to spot instead of leaving them to the scheduler
+	overflowToSpot bool
+	// place the pods of a StatefulSet by their ordinal, the lowest ones on on-demand and the rest on spot
+	statefulSetOrdinalPlacement bool
+	// decides the target capacity of a created pod, selected by capacityMode
+	strategy placementStrategy
+	// how the pod is steered to its target capacity
+	placementMode placementMode
+	// factors the requests of the pods pinned to spot are scaled by, nil to keep them
+	spotRequestFactors map[corev1.ResourceName]float64
+	// prefer the nodes of the capacity by their weight labels
+	nodeWeightAffinity bool
+	// tolerates the taint of the spot nodes for the pods free to run on spot, nil to not inject one
+	spotToleration *corev1.Toleration
+	// how the placement concerns are written to the admission response
+	patchMode patchMode
+
+	// whether evictions of on-demand pods go through the scale down guard
+	evictionGuardPolicy evictionGuardPolicy
+
+	// do not pin pods whose bound volumes can not be used from the capacity nodes
+	checkVolumeNodeAffinity bool
+
+	// check the placement is satisfiable with the pod's required node affinity before injecting it
+	validateNodeAffinity        bool
+	unsatisfiableAffinityPolicy unsatisfiableAffinityPolicy
+
+	// pods on cordoned or drain tainted nodes do not count toward the on-demand floor of creates,
+	// the delete guard still counts them as they keep serving
+	excludeCordonedFromFloor bool
+	// taint keys marking a node as draining like a cordon
+	drainTaintKeys map[string]struct{}
+	// count the siblings of the pod's controller only instead of all pods sharing its labels
+	countSiblingsByOwner bool
+	// leave the pods of DaemonSets alone, they are bound to their nodes by the DaemonSet controller
+	skipDaemonSetPods bool
+
+	// deny deletes of on-demand pods while spot pods could be scaled down instead
+	enforceScaleDownOrder bool
+	// allow deletes the scale down guard denies when the pod's PodDisruptionBudgets allow a disruption
+	deleteGuardRespectPDB bool
+	// delete propagation policies the scale down guard does not apply to
+	deleteGuardSkipPropagationPolicies map[metav1.DeletionPropagation]struct{}
+	// always allow deleting pods of workloads scaled to zero
+	allowScaleToZeroDelete bool
+
+	// containers judging pod readiness for counting, empty for the pod Ready condition
+	readinessContainers map[string]struct{}
+
+	// bounds the admission requests processed at once, nil for no bound
+	admissionLimiter *admissionLimiter
+
+	// recent on-demand pins not yet in the cache, nil to disable
+	reservations *placementReservations
+
+	// relax the placement to a preference during create bursts, nil to disable
+	burstDetector *burstDetector
+
+	// annotations added to every controlled pod, existing keys are kept
+	annotationTemplate map[string]string
+	// the annotationTemplate before ${ENV} is expanded, /config serves it so the env values are not exposed
+	annotationTemplateRaw map[string]string
+
+	ownerResolutionFailurePolicy ownerResolutionFailurePolicy
+
+	// workloads (kind/name) labeled on the metrics, others are reported as "other", empty for metricsWorkloads
+	metricsWorkloadAllowlist map[string]struct{}
+	// the first workloads labeled on the metrics without an allowlist
+	metricsWorkloads *workloadLabelSet
+
+	// placement decisions are emitted as CloudEvents to the sink, nil to disable
+	cloudEventSink *cloudEventSink
+
+	// requests taking longer are logged with the phase they spent the most in, 0 to not log
+	slowRequestThreshold time.Duration
+
+	// the webhook timeoutSeconds, requests using more than latencyBudgetWarnPercent of it are logged
+	latencyBudget            time.Duration
+	latencyBudgetWarnPercent int
+
+	// max AdmissionReview body size
+	maxRequestBytes int64
+
+	// serves the certificate, /readyz fails when the one loaded expires within readyzCertExpiryWindow
+	certReloader           *certReloader
+	readyzCheckCert        bool
+	readyzCertExpiryWindow time.Duration
+
+	// paths the AdmissionReviews are posted to, as in the clientConfig of the webhook configurations
+	mutatePath   string
+	validatePath string
+
+	// serve the effective config on /config
+	configEndpoint bool
+	// serve the counts of a workload on /debug/count
+	debugEndpoints bool
+	// namespace/name of the ConfigMap the config is reloaded from, empty for the env only
+	configMap string
+
+	// only the leader of the Lease mutates and guards pods, the followers forward the admission requests to it
+	leaderElection bool
+	isLeader       atomic.Bool
+	// address of the leader, leaderScheme the scheme it serves with
+	leader       atomic.Pointer[string]
+	leaderScheme string
+	leaderClient *http.Client
+
+	// records the placement decisions as events on the pods' owners, nil to not record
+	eventRecorder record.EventRecorder
+
 	informermanager *informermanager.SingleClusterManager
 
 	stopCh chan struct{}
 }
 
-func NewDefaultApp(ctx context.Context) (*App, error) {
+// NewDefaultApp the App with the defaults on the in-cluster client
+func NewDefaultApp(ctx context.Context, informerOpts ...informermanager.Option) (*App, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, err
@@ -54,13 +217,27 @@ func NewDefaultApp(ctx context.Context) (*App, error) {
 		return nil, err
 	}
 
-	return &App{
-		Client:                 client,
-		Ctx:                    ctx,
-		OnDemandMinPodNum:      1,
-		SpotMinPodNum:          1,
-		mixSchedulerRequierd:   true,
-		notControllerNamespace: map[string]struct{}{},
+	return NewApp(ctx, client, informerOpts...), nil
+}
+
+// NewApp the App with the defaults on the client, e.g. a fake clientset outside of the cluster
+func NewApp(ctx context.Context, client kubernetes.Interface, informerOpts ...informermanager.Option) *App {
+	app := &App{
+		Client:        client,
+		eventRecorder: newEventRecorder(client),
+		Ctx:           ctx,
+		envConfig: reloadableConfig{
+			OnDemandMinPodNum:      1,
+			SpotMinPodNum:          1,
+			notControllerNamespace: map[string]struct{}{},
+		},
+
+		AntiAffinityTopologyKey: hostnameTopologyKey,
+		AntiAffinityWeight:      100,
+
+		clientTimeout: 2 * time.Second,
+
+		mixSchedulerRequierd: true,
 
 		ondemandNodeSelector: map[string]string{
 			capacityKey: ondemandKey,
@@ -69,10 +246,42 @@ func NewDefaultApp(ctx context.Context) (*App, error) {
 		spotNodeSelector: map[string]string{
 			capacityKey: spotKey,
 		},
-
-		informermanager: informermanager.NewSingleClusterManager(ctx, client),
+		spotValues: []string{spotKey},
+
+		nodeAffinityConflictPolicy:  nodeAffinityConflictRespectAffinity,
+		unsatisfiableAffinityPolicy: unsatisfiableAffinityFallback,
+		topologySpreadPolicy:        topologySpreadInject,
+		nodeNamePolicy:              nodeNameSkip,
+		emptyCapacityPolicy:         emptyCapacityPrefer,
+		patchMode:                   patchModeJSONPatch,
+		capacityMode:                capacityMinimum,
+		failurePolicy:               failurePolicyFail,
+		placementMode:               placementNodeSelector,
+		evictionGuardPolicy:         evictionGuardIgnore,
+		checkVolumeNodeAffinity:     true,
+		allowScaleToZeroDelete:      true,
+		skipDaemonSetPods:           true,
+		drainTaintKeys:              parseDrainTaintKeys(defaultDrainTaintKeys),
+		enforceScaleDownOrder:       true,
+		maxRequestBytes:             defaultMaxRequestBytes,
+		latencyBudget:               10 * time.Second,
+		latencyBudgetWarnPercent:    80,
+		mutatePath:                  defaultMutatePath,
+		tiers:                       defaultTiers(),
+		validatePath:                defaultValidatePath,
+
+		ownerResolutionFailurePolicy: ownerResolutionFallBackToLabels,
+		metricsWorkloads:             newWorkloadLabelSet(defaultMetricsWorkloadLimit),
+
+		reservations: newPlacementReservations(defaultReservationWindow),
+
+		informermanager: informermanager.NewSingleClusterManager(ctx, client, informerOpts...),
 		stopCh:          make(chan struct{}),
-	}, nil
+	}
+	app.strategy = newPlacementStrategy(app, app.capacityMode)
+	app.setReloadableConfig(app.envConfig)
+
+	return app
 }
 
 func (app *App) StartInformer() {
@@ -83,19 +292,61 @@ func (app *App) StopInformer() {
 	close(app.stopCh)
 }
 
-// isControllerNamespace is controller namespace
+// isControllerNamespace is controller namespace, the first source with an opinion decides:
+// namespace annotation > namespace label selector > CONTROLLED_NAMESPACES or notControllerNamespace env
 func (app *App) isControllerNamespace(namespace string) bool {
-	_, ok := app.notControllerNamespace[namespace]
+	config := app.reloadableConfig()
+
+	ns, err := app.GetNamespace(namespace, metav1.GetOptions{})
+	if err != nil {
+		if config.namespaceSelector != nil {
+			klog.V(4).Infof("get namespace %s: %v, controlled=%v by default", namespace, err, config.namespaceSelectorDefault)
+			return config.namespaceSelectorDefault
+		}
+
+		klog.V(4).Infof("get namespace %s: %v, decide by the namespace lists", namespace, err)
+	} else {
+		if val, ok := ns.Annotations[mixSchedulerKey]; ok {
+			klog.V(4).Infof("namespace %s controlled=%v by annotation %s", namespace, val == "true", mixSchedulerKey)
+			return val == "true"
+		}
+
+		if config.namespaceSelector != nil {
+			controlled := config.namespaceSelector.Matches(labels.Set(ns.Labels))
+			klog.V(4).Infof("namespace %s controlled=%v by selector %s", namespace, controlled, config.namespaceSelector)
+			return controlled
+		}
+	}
+
+	if config.controlledNamespaces != nil {
+		_, ok := config.controlledNamespaces[namespace]
+		klog.V(4).Infof("namespace %s controlled=%v by CONTROLLED_NAMESPACES", namespace, ok)
+		return ok
+	}
+
+	_, ok := config.notControllerNamespace[namespace]
+	klog.V(4).Infof("namespace %s controlled=%v by notControllerNamespace", namespace, !ok)
 	return !ok
 }
 
 // instanceIsSkip skip instance
-func (app *App) instanceIsSkip(namespace string, labels map[string]string) bool {
+func (app *App) instanceIsSkip(namespace string, podLabels map[string]string) bool {
 	if !app.isControllerNamespace(namespace) {
 		return true
 	}
 
-	if val, ok := labels[mixSchedulerKey]; ok && val != "" && val != "true" {
+	// without labels the siblings and the anti-affinity selector would match every pod of the namespace
+	if len(podLabels) == 0 {
+		klog.Warningf("instance in namespace %s without labels, not controllable", namespace)
+		return true
+	}
+
+	if val, ok := podLabels[mixSchedulerKey]; ok && val != "" && val != "true" {
+		return true
+	}
+
+	if app.controlledPodSelector != nil && !app.controlledPodSelector.Matches(labels.Set(podLabels)) {
+		klog.V(4).Infof("instance in namespace %s does not match %s, not controlled", namespace, app.controlledPodSelector)
 		return true
 	}
 
@@ -103,72 +354,265 @@ func (app *App) instanceIsSkip(namespace string, labels map[string]string) bool
 		return true
 	}
 
+	// nothing to keep on either capacity
+	if ondemandMin, spotMin := app.minPodNums(namespace); ondemandMin == 0 && spotMin == 0 && app.ondemandMinPercent == 0 && !app.fixedTierMinimum() && forcedCapacity(podLabels) == "" {
+		if _, _, weighted := podWeights(podLabels); app.capacityMode != capacityWeighted || !weighted {
+			return true
+		}
+	}
+
 	return false
 }
 
+// startAdmission reads the AdmissionReview and takes an admission slot, the checks shared by the admission
+// handlers before the object is looked at. When ok is false the request is answered, otherwise release
+// frees the slot
+func (app *App) startAdmission(w http.ResponseWriter, r *http.Request, admissionReview *admissionv1.AdmissionReview) (release func(), ok bool) {
+	// read the AdmissionReview from the request json body
+	err := readJSON(w, r, admissionReview, app.maxRequestBytes)
+	if err != nil {
+		recordAdmission(admissionReview, decisionDenied)
+		app.HandleError(w, r, admissionReview, err)
+		return nil, false
+	}
+
+	if admissionReview.Request == nil {
+		recordAdmission(admissionReview, decisionDenied)
+		app.HandleError(w, r, admissionReview, errMissingRequest)
+		return nil, false
+	}
+
+	release, err = app.admissionLimiter.acquire(r.Context())
+	if err != nil {
+		recordAdmission(admissionReview, decisionDenied)
+		app.HandleError(w, r, admissionReview, err)
+		return nil, false
+	}
+
+	// during startup rather allow the request than list from the API server for every request
+	if !app.waitForCacheSync(r.Context()) {
+		klog.Warningf("informer cache not synced within %v, allow %s %s/%s unchanged", app.cacheSyncWait,
+			admissionReview.Request.Kind.Kind, admissionReview.Request.Namespace, admissionReview.Request.Name)
+		recordAdmission(admissionReview, decisionSkipped)
+		writeNil(w, admissionReview)
+		release()
+		return nil, false
+	}
+
+	return release, true
+}
+
+// admissionPod decodes the pod of the request, the old object of a delete, and runs the checks shared by
+// the admission handlers on it. When ok is false the pod is not controlled and the request is answered
+func (app *App) admissionPod(w http.ResponseWriter, r *http.Request, admissionReview *admissionv1.AdmissionReview, timer *requestTimer) (*corev1.Pod, bool) {
+	// unmarshal the pod from the AdmissionRequest
+	raw := admissionReview.Request.Object.Raw
+	if admissionReview.Request.Operation == admissionv1.Delete {
+		raw = admissionReview.Request.OldObject.Raw
+	}
+
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		recordAdmission(admissionReview, decisionDenied)
+		app.HandleError(w, r, admissionReview, fmt.Errorf("unmarshal to pod: %v", err))
+		return nil, false
+	}
+
+	timer.mark("decode")
+
+	if podBypassed(pod) || app.daemonSetPod(pod) {
+		recordAdmission(admissionReview, decisionSkipped)
+		writeNil(w, admissionReview)
+		return nil, false
+	}
+
+	// the namespace is defaulted by the API server after the admission, take the request's
+	if pod.Namespace == "" {
+		pod.Namespace = admissionReview.Request.Namespace
+	}
+
+	// an empty namespace would list the pods of all namespaces
+	if pod.Namespace == "" {
+		klog.Warningf("pod %s without namespace, skip", pod.Name)
+		namespacelessPodsTotal.Inc()
+		recordAdmission(admissionReview, decisionSkipped)
+		writeNil(w, admissionReview)
+		return nil, false
+	}
+
+	if app.instanceIsSkip(pod.Namespace, pod.Labels) {
+		klog.Info("instance is skip")
+		recordAdmission(admissionReview, decisionSkipped)
+		writeNil(w, admissionReview, labelWarnings(pod.Labels)...)
+		return nil, false
+	}
+
+	return pod, true
+}
+
 func (app *App) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startRequestSpan(r, "HandleMutate")
+	timer := newRequestTimer()
 	admissionReview := &admissionv1.AdmissionReview{}
+	defer func() {
+		app.observeLatency(timer, admissionReview)
+		endRequestSpan(ctx, span, timer, admissionReview)
+	}()
 
-	// read the AdmissionReview from the request json body
-	err := readJSON(r, admissionReview)
-	if err != nil {
-		app.HandleError(w, r, err)
+	release, ok := app.startAdmission(w, r, admissionReview)
+	if !ok {
 		return
 	}
+	defer release()
 
 	if admissionReview.Request.Kind.Kind == "Pod" {
-		// unmarshal the pod from the AdmissionRequest
-		pod := &corev1.Pod{}
-		if admissionReview.Request.Operation == admissionv1.Delete {
-			if err := json.Unmarshal(admissionReview.Request.OldObject.Raw, pod); err != nil {
-				app.HandleError(w, r, fmt.Errorf("unmarshal to pod: %v", err))
+		pod, ok := app.admissionPod(w, r, admissionReview, timer)
+		if !ok {
+			return
+		}
+
+		// leave a degenerate pod to the API server's validation rather than patching paths it lacks
+		if admissionReview.Request.Operation == admissionv1.Create {
+			if err := patchableShape(admissionReview.Request.Object.Raw, pod); err != nil {
+				klog.Warningf("pod %s/%s not patchable: %v, skip", pod.Namespace, pod.Name, err)
+				recordAdmission(admissionReview, decisionSkipped)
+				writeNil(w, admissionReview)
 				return
 			}
-		} else {
-			if err := json.Unmarshal(admissionReview.Request.Object.Raw, pod); err != nil {
-				app.HandleError(w, r, fmt.Errorf("unmarshal to pod: %v", err))
+		}
+
+		// preferentially scale pods on spot nodes
+		if admissionReview.Request.Operation == admissionv1.Delete && app.enforceScaleDownOrder && app.nodeCapacity(pod.Spec.NodeName) == ondemandKey {
+			opts, err := deleteOptions(admissionReview.Request)
+			if err != nil {
+				recordAdmission(admissionReview, decisionDenied)
+				app.HandleError(w, r, admissionReview, err)
 				return
 			}
-		}
 
-		if app.instanceIsSkip(pod.Namespace, pod.Labels) {
-			klog.Info("instance is skip")
-			writeNil(w, admissionReview)
-			return
-		}
+			if app.deleteGuardSkipped(opts) {
+				klog.Infof("pod %s/%s deleted with propagation policy %s, skip", pod.Namespace, pod.Name, *opts.PropagationPolicy)
+				recordAdmission(admissionReview, decisionAllowed)
+				writeNil(w, admissionReview)
+				return
+			}
 
-		// preferentially scale pods on spot nodes
-		if admissionReview.Request.Operation == admissionv1.Delete && app.nodeCapacity(pod.Spec.NodeName) == ondemandKey {
-			if app.podExistOnNodeCapacityNum(spotKey, pod) >= app.SpotMinPodNum && app.podExistOnNodeCapacityNum(ondemandKey, pod) < app.OnDemandMinPodNum {
-				app.HandleError(w, r, fmt.Errorf("preferentially scale pods on spot nodes"))
+			if app.allowScaleToZeroDelete {
+				scaledToZero, err := app.ownerScaledToZero(pod)
+				if err != nil {
+					if app.ownerResolutionFailed(pod, err) {
+						recordAdmission(admissionReview, decisionSkipped)
+						writeNil(w, admissionReview)
+						return
+					}
+				} else if scaledToZero {
+					klog.Infof("pod %s/%s owner scaled to zero, skip", pod.Namespace, pod.Name)
+					recordAdmission(admissionReview, decisionAllowed)
+					writeNil(w, admissionReview)
+					return
+				}
+			}
+
+			// only ready pods are serving, judge the scale down on them, OnDemandMinPodNum is the number
+			// of ready on-demand pods to keep, so the delete is denied when it would leave fewer
+			ondemandMin, spotMin := app.minPodNums(pod.Namespace)
+			spotReady, ondemandLeft, err := app.scaleDownReadyCounts(pod)
+			timer.mark("count")
+			if err != nil {
+				recordAdmission(admissionReview, decisionDenied)
+				app.HandleError(w, r, admissionReview, err)
+				return
+			}
+			if spotReady >= spotMin && ondemandLeft < ondemandMin {
+				counts := scaleDownCounts(ondemandLeft, ondemandMin, spotReady, spotMin)
+
+				// the disruption budgets of the workload own its scale down
+				if app.deleteGuardRespectPDB {
+					allowed, err := app.pdbAllowsDisruption(pod)
+					if err != nil {
+						recordAdmission(admissionReview, decisionDenied)
+						app.HandleError(w, r, admissionReview, err)
+						return
+					}
+
+					if allowed {
+						klog.Infof("pod %s/%s delete allowed by its pod disruption budgets: %s", pod.Namespace, pod.Name, counts)
+						recordAdmission(admissionReview, decisionAllowed)
+						writeNil(w, admissionReview, fmt.Sprintf("%s pod deleted below the minimum, allowed by its PodDisruptionBudgets: %s", ondemandKey, counts))
+						return
+					}
+				}
+
+				app.recordEvent(pod, corev1.EventTypeWarning, eventReasonScaleDownDenied,
+					"delete of pod %s on %s node %s denied: %s, preferentially scale pods on spot nodes", pod.Name, ondemandKey, pod.Spec.NodeName, counts)
+				recordAdmission(admissionReview, decisionDenied)
+				app.HandleError(w, r, admissionReview, fmt.Errorf("cannot delete %s pod %s/%s: %s, preferentially scale pods on spot nodes",
+					ondemandKey, pod.Namespace, pod.Name, counts))
 				return
 			}
 
 			klog.Info("preferentially scale pods on spot nodes")
 
+			recordAdmission(admissionReview, decisionAllowed)
 			writeNil(w, admissionReview)
 			return
 		}
 
 		if admissionReview.Request.Operation == admissionv1.Create {
 			respAdmissionReview, err := podCreateOperation(app, admissionReview, pod)
+			timer.mark("placement")
 			if err != nil {
-				app.HandleError(w, r, err)
+				if admissionReview.Request.DryRun == nil || !*admissionReview.Request.DryRun {
+					app.recordEvent(pod, corev1.EventTypeWarning, eventReasonPlacementRejected, "pod rejected: %v", err)
+				}
+				recordAdmission(admissionReview, decisionDenied)
+				app.HandleError(w, r, admissionReview, err)
 				return
 			} else if respAdmissionReview == nil {
+				recordAdmission(admissionReview, decisionAllowed)
 				writeNil(w, admissionReview)
 				return
 			}
 
+			recordAdmission(admissionReview, decisionMutated)
 			jsonOk(w, &respAdmissionReview)
 			return
 		}
 
+		recordAdmission(admissionReview, decisionAllowed)
 		writeNil(w, admissionReview)
 		return
 	}
 
-	klog.Errorf("unknown kind: %s", admissionReview.Request.Object.Object.GetObjectKind().GroupVersionKind().Kind)
+	if (admissionReview.Request.Kind.Kind == "Deployment" || admissionReview.Request.Kind.Kind == "StatefulSet") &&
+		admissionReview.Request.Operation == admissionv1.Create {
+		respAdmissionReview, err := workloadCreateOperation(app, admissionReview)
+		if err != nil {
+			recordAdmission(admissionReview, decisionDenied)
+			app.HandleError(w, r, admissionReview, err)
+			return
+		} else if respAdmissionReview == nil {
+			recordAdmission(admissionReview, decisionAllowed)
+			writeNil(w, admissionReview)
+			return
+		}
+
+		recordAdmission(admissionReview, decisionMutated)
+		jsonOk(w, &respAdmissionReview)
+		return
+	}
+
+	if admissionReview.Request.SubResource == evictionSubResource {
+		app.handleEviction(w, r, admissionReview)
+		return
+	}
+
+	// the raw object is never decoded into Object.Object, the kind comes with the request
+	kind := admissionReview.Request.Kind
+	klog.Warningf("unsupported %s of %s %s/%s, allow it unchanged", admissionReview.Request.Operation, kind.String(),
+		admissionReview.Request.Namespace, admissionReview.Request.Name)
+	unknownKindsTotal.WithLabelValues(kind.Group, kind.Kind).Inc()
+	recordAdmission(admissionReview, decisionAllowed)
 	writeNil(w, admissionReview)
 }
 
@@ -178,75 +622,332 @@ type JSONPatchEntry struct {
 	Value json.RawMessage `json:"value,omitempty"`
 }
 
+// FillAffinity the pod's affinity with the pod anti-affinity present, the user's terms are kept
 func FillAffinity(podSpec corev1.PodSpec) *corev1.Affinity {
 	var affinity *corev1.Affinity
 	if podSpec.Affinity == nil {
-		affinity = &corev1.Affinity{
-			PodAntiAffinity: &corev1.PodAntiAffinity{
-				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{},
-			},
-		}
+		affinity = &corev1.Affinity{}
 	} else {
 		affinity = podSpec.Affinity
 	}
 
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+
+	if affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution == nil {
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []corev1.WeightedPodAffinityTerm{}
+	}
+
 	return affinity
 }
 
+// controllerLabelKeys the pod labels set by the workload controllers, they differ between the replicas
+// or revisions of a workload, e.g. statefulset.kubernetes.io/pod-name is unique to each pod
+var controllerLabelKeys = []string{
+	appsv1.DefaultDeploymentUniqueLabelKey,
+	appsv1.ControllerRevisionHashLabelKey,
+	appsv1.StatefulSetPodNameLabel,
+	appsv1.PodIndexLabel,
+}
+
+// antiAffinitySelector the selector of the pods of the workload, without the labels of the controllers
+// so the term matches all replicas and is the same whether injected into the template or the pod
+func antiAffinitySelector(podLabels map[string]string) *metav1.LabelSelector {
+	matchLabels := make(map[string]string, len(podLabels))
+	for key, value := range podLabels {
+		matchLabels[key] = value
+	}
+	for _, key := range controllerLabelKeys {
+		delete(matchLabels, key)
+	}
+
+	return &metav1.LabelSelector{MatchLabels: matchLabels}
+}
+
+// appendPodAntiAffinityTerm appends the term to the preferred pod anti-affinity unless a term of the same
+// topology key and selector is already there, e.g. the one injected into the workload's template
+func appendPodAntiAffinityTerm(affinity *corev1.Affinity, term corev1.WeightedPodAffinityTerm) {
+	for _, existing := range affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if existing.PodAffinityTerm.TopologyKey == term.PodAffinityTerm.TopologyKey &&
+			equality.Semantic.DeepEqual(existing.PodAffinityTerm.LabelSelector, term.PodAffinityTerm.LabelSelector) {
+			return
+		}
+	}
+
+	affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, term)
+}
+
 func podCreateOperation(app *App, admissionReview *admissionv1.AdmissionReview, pod *corev1.Pod) (*admissionv1.AdmissionReview, error) {
-	if app.podExistOnNodeCapacityNum(ondemandKey, pod) >= app.OnDemandMinPodNum {
+	dryRun := admissionReview.Request.DryRun != nil && *admissionReview.Request.DryRun
+
+	if app.belowMinReplicasToAct(pod) {
+		return nil, nil
+	}
+
+	patch, err := app.placementPatch(pod, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	patch = append(patch, app.annotationPatch(pod)...)
+
+	if len(patch) == 0 {
 		return nil, nil
 	}
 
-	klog.Info("preferentially scale pods on ondemand nodes")
+	warnings := capacityOverrideWarnings(pod, patch)
 
-	nodeSelector := map[string]string{
-		capacityKey: ondemandKey,
+	if app.patchMode == patchModeMerged {
+		patch, err = mergePatch(pod, patch)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// marshal the nodeSelector
-	nodeSelectorBytes, err := json.Marshal(nodeSelector)
+	// dry run, log what would be patched and allow the pod unchanged
+	if app.dryRun {
+		patchBytes, err := json.Marshal(&patch)
+		if err != nil {
+			return nil, internalErrorf("marshal patch: %v", err)
+		}
+
+		klog.Infof("dry run, pod %s/%s patch: %s", pod.Namespace, pod.Name, patchBytes)
+		return nil, nil
+	}
+
+	respAdmissionReview, err := patchAdmissionReview(admissionReview, patch)
 	if err != nil {
-		return nil, fmt.Errorf("marshal affinity: %v", err)
+		return nil, err
+	}
+
+	respAdmissionReview.Response.Warnings = warnings
+	return respAdmissionReview, nil
+}
+
+// placementPatch the patch placing the pod on its capacity, nil when the pod is left to the scheduler
+// server-side dry runs compute the same patch without recording the create or the placement
+func (app *App) placementPatch(pod *corev1.Pod, dryRun bool) ([]JSONPatchEntry, error) {
+	record := func(capacity string) {
+		if !dryRun {
+			app.recordPlacement(pod, capacity)
+			if capacity != unpinnedCapacity && !app.dryRun {
+				app.reservations.reserve(pod, capacity, time.Now())
+			}
+		}
+	}
+
+	// during a burst of creates only prefer on-demand, pinning all of them would defeat the scale up
+	var bursting bool
+	if app.burstDetector != nil {
+		if dryRun {
+			bursting = app.burstDetector.peek(pod, time.Now())
+		} else {
+			bursting = app.burstDetector.observe(pod, time.Now())
+		}
+	}
+
+	// above the on-demand floor the pods are left to the scheduler, free to run on spot
+	plan, err := app.strategy.Decide(app.Ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := plan.Capacity
+	if capacity == unpinnedCapacity {
+		patch, err := app.nodeWeightPatch(pod)
+		if err != nil {
+			return nil, err
+		}
+
+		record(unpinnedCapacity)
+		return append(patch, app.tolerationPatch(pod)...), nil
+	}
+
+	// the pod bypasses the scheduler, a nodeSelector not matching its node would fail it on the kubelet
+	if pod.Spec.NodeName != "" {
+		nodeCapacity := app.nodeCapacity(pod.Spec.NodeName)
+		if nodeCapacity != capacity && app.nodeNamePolicy == nodeNameReject {
+			return nil, fmt.Errorf("pod assigned to %s node %s while %s placement is required", nodeCapacity, pod.Spec.NodeName, capacity)
+		}
+
+		klog.Infof("pod %s/%s assigned to node %s, skip", pod.Namespace, pod.Name, pod.Spec.NodeName)
+		record(unpinnedCapacity)
+		return nil, nil
+	}
+
+	// a pin to a capacity without nodes leaves the pod pending, a workload pinning itself accepts that
+	var emptyCapacity bool
+	if !plan.Forced && app.emptyCapacityPolicy != emptyCapacityPin {
+		schedulable, err := app.capacityHasSchedulableNodes(capacity)
+		if err != nil {
+			return nil, err
+		}
+
+		if !schedulable && app.emptyCapacityPolicy == emptyCapacitySkip {
+			klog.Infof("no schedulable %s nodes for pod %s/%s, fall back to the scheduler", capacity, pod.Namespace, pod.Name)
+			record(unpinnedCapacity)
+			return nil, nil
+		}
+		emptyCapacity = !schedulable
 	}
 
 	// pod anti-affinity
 	affinity := FillAffinity(pod.Spec)
 
-	affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []corev1.WeightedPodAffinityTerm{
-		corev1.WeightedPodAffinityTerm{
-			Weight: 100,
+	if !app.nodeAffinityAllowsCapacity(pod.Spec, capacity) {
+		switch app.nodeAffinityConflictPolicy {
+		case nodeAffinityConflictDeny:
+			return nil, fmt.Errorf("pod node affinity conflicts with %s placement", capacity)
+		case nodeAffinityConflictOverrideWithSelector:
+			klog.Infof("pod %s/%s node affinity conflicts with %s placement, override it", pod.Namespace, pod.Name, capacity)
+			dropCapacityNodeAffinity(affinity)
+		default:
+			klog.Infof("pod %s/%s node affinity conflicts with %s placement, respect it", pod.Namespace, pod.Name, capacity)
+			record(unpinnedCapacity)
+			return nil, nil
+		}
+	}
+
+	if app.checkVolumeNodeAffinity {
+		allowed, err := app.volumesAllowCapacity(pod, capacity)
+		if err != nil {
+			return nil, err
+		}
+
+		if !allowed {
+			klog.Infof("pod %s/%s volumes node affinity excludes %s nodes, skip", pod.Namespace, pod.Name, capacity)
+			record(unpinnedCapacity)
+			return nil, nil
+		}
+	}
+
+	if app.validateNodeAffinity {
+		satisfiable, err := app.placementSatisfiable(pod, affinity, capacity)
+		if err != nil {
+			return nil, err
+		}
+
+		if !satisfiable {
+			if app.unsatisfiableAffinityPolicy == unsatisfiableAffinityDeny {
+				return nil, fmt.Errorf("no %s node satisfies the pod node affinity", capacity)
+			}
+
+			klog.Infof("no %s node satisfies pod %s/%s node affinity, fall back to the scheduler", capacity, pod.Namespace, pod.Name)
+			record(unpinnedCapacity)
+			return nil, nil
+		}
+	}
+
+	placementMode := app.placementMode
+	if plan.Forced {
+		// pinned by the workload, the scheduler must not fall back to the other capacity
+		placementMode = placementNodeSelector
+	} else if emptyCapacity {
+		klog.Infof("no schedulable %s nodes for pod %s/%s, prefer them", capacity, pod.Namespace, pod.Name)
+		placementMode = placementPreferredAffinity
+	} else if bursting {
+		klog.Infof("pod %s/%s workload is bursting, prefer %s nodes", pod.Namespace, pod.Name, capacity)
+		placementMode = placementPreferredAffinity
+	} else {
+		klog.Infof("preferentially scale pods on %s nodes", capacity)
+	}
+
+	switch placementMode {
+	case placementPreferredAffinity:
+		preferCapacityNodeAffinity(affinity, app.capacityValues(capacity), 100)
+	case placementRequiredAffinity:
+		requireCapacityNodeAffinity(affinity, app.capacityValues(capacity))
+	}
+
+	if app.nodeWeightAffinity {
+		if _, err := app.preferNodeWeights(affinity, capacity); err != nil {
+			return nil, err
+		}
+	}
+
+	if app.skipAntiAffinity(pod.Spec, app.AntiAffinityTopologyKey) {
+		klog.Infof("pod %s/%s topology spread constraints cover %s, skip anti-affinity", pod.Namespace, pod.Name, app.AntiAffinityTopologyKey)
+	} else {
+		appendPodAntiAffinityTerm(affinity, corev1.WeightedPodAffinityTerm{
+			Weight: app.AntiAffinityWeight,
 			PodAffinityTerm: corev1.PodAffinityTerm{
-				TopologyKey:   "kubernetes.io/hostname",
-				LabelSelector: &metav1.LabelSelector{MatchLabels: pod.Labels},
+				TopologyKey:   app.AntiAffinityTopologyKey,
+				LabelSelector: antiAffinitySelector(pod.Labels),
 			},
-		},
+		})
 	}
 
 	// marshal the affinity back into the AdmissionReview
 	affinityBytes, err := json.Marshal(affinity)
 	if err != nil {
-		return nil, fmt.Errorf("marshal affinity: %v", err)
+		return nil, internalErrorf("marshal affinity: %v", err)
 	}
 
-	// create the patch
+	// create the patch, "add" replaces the member when it exists
 	patch := []JSONPatchEntry{
 		{
-			OP:    "replace",
-			Path:  "/spec/nodeSelector",
-			Value: nodeSelectorBytes,
-		},
-
-		{
-			OP:    "replace",
+			OP:    "add",
 			Path:  "/spec/affinity",
 			Value: affinityBytes,
 		},
 	}
 
+	if placementMode == placementNodeSelector {
+		// a nodeSelector can only pin one value, spot pods go to the first spot value
+		nodeSelectorPatch, err := nodeSelectorPatch(pod, app.capacityValues(capacity)[0])
+		if err != nil {
+			return nil, err
+		}
+		patch = append([]JSONPatchEntry{nodeSelectorPatch}, patch...)
+	}
+
+	if capacity == spotKey {
+		requestsPatch, err := app.spotRequestsPatch(pod)
+		if err != nil {
+			return nil, err
+		}
+		patch = append(append(patch, app.tolerationPatch(pod)...), requestsPatch...)
+	}
+
+	record(capacity)
+
+	return patch, nil
+}
+
+// nodeSelectorPatch the patch setting the capacity key of the pod's nodeSelector, the user's keys are kept
+func nodeSelectorPatch(pod *corev1.Pod, capacity string) (JSONPatchEntry, error) {
+	if pod.Spec.NodeSelector == nil {
+		// marshal the nodeSelector
+		nodeSelectorBytes, err := json.Marshal(map[string]string{capacityKey: capacity})
+		if err != nil {
+			return JSONPatchEntry{}, fmt.Errorf("marshal nodeSelector: %v", err)
+		}
+
+		return JSONPatchEntry{
+			OP:    "add",
+			Path:  "/spec/nodeSelector",
+			Value: nodeSelectorBytes,
+		}, nil
+	}
+
+	capacityBytes, err := json.Marshal(capacity)
+	if err != nil {
+		return JSONPatchEntry{}, fmt.Errorf("marshal nodeSelector: %v", err)
+	}
+
+	return JSONPatchEntry{
+		OP:    "add",
+		Path:  "/spec/nodeSelector/" + escapeJSONPointer(capacityKey),
+		Value: capacityBytes,
+	}, nil
+}
+
+// patchAdmissionReview the AdmissionReview response allowing the request with the JSONPatch
+func patchAdmissionReview(admissionReview *admissionv1.AdmissionReview, patch []JSONPatchEntry) (*admissionv1.AdmissionReview, error) {
 	patchBytes, err := json.Marshal(&patch)
 	if err != nil {
-		return nil, fmt.Errorf("marshal patch: %v", err)
+		return nil, internalErrorf("marshal patch: %v", err)
 	}
 
 	patchType := admissionv1.PatchTypeJSONPatch
@@ -259,10 +960,7 @@ func podCreateOperation(app *App, admissionReview *admissionv1.AdmissionReview,
 	}
 
 	respAdmissionReview := &admissionv1.AdmissionReview{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "AdmissionReview",
-			APIVersion: "admission.k8s.io/v1",
-		},
+		TypeMeta: responseTypeMeta(admissionReview),
 		Response: admissionResponse,
 	}
 
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// pod updates, e.g. in-place resizes, are not registered, the webhook never re-runs placement for them
+func TestPodUpdateNotRegistered(t *testing.T) {
+	r, _ := newTestRegistration(t, "ca-1")
+
+	for _, rule := range r.configuration([]byte("ca-1")).Webhooks[0].Rules {
+		for _, operation := range rule.Operations {
+			if operation == admissionregistrationv1.Update || operation == admissionregistrationv1.OperationAll {
+				t.Errorf("%s registered for %v", operation, rule.Resources)
+			}
+		}
+	}
+}
+
+// an in-place resize reaching the webhook anyway is allowed unchanged
+func TestPodResizeAllowedUnchanged(t *testing.T) {
+	oldPod := testPod("web-1", "web", "od-1")
+	newPod := oldPod.DeepCopy()
+	newPod.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}
+
+	for name, subResource := range map[string]string{"update": "", "resize subresource": "resize"} {
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), oldPod)
+			app.envConfig.OnDemandMinPodNum = 2
+			app.setReloadableConfig(app.envConfig)
+
+			review := podReview(t, admissionv1.Update, newPod)
+			review.Request.SubResource = subResource
+			raw, err := json.Marshal(oldPod)
+			if err != nil {
+				t.Fatalf("marshal pod: %v", err)
+			}
+			review.Request.OldObject = runtime.RawExtension{Raw: raw}
+
+			resp := mutate(t, app, review)
+			if !resp.Allowed || len(resp.Patch) != 0 {
+				t.Errorf("resize allowed %v patch %s, want allowed unchanged", resp.Allowed, resp.Patch)
+			}
+		})
+	}
+}
+
+func TestNamespacelessPodSkipped(t *testing.T) {
+	client := fake.NewSimpleClientset(testNode("od-1", ondemandKey))
+	app := newTestAppWithClient(t, client)
+	setMinimums(app, 1, 0)
+
+	pod := testCreatedPod("web")
+	pod.Namespace = ""
+
+	before := counterValue(t, namespacelessPodsTotal)
+	resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Errorf("namespace-less pod allowed %v patch %s, want allowed unchanged", resp.Allowed, resp.Patch)
+	}
+	if got := counterValue(t, namespacelessPodsTotal) - before; got != 1 {
+		t.Errorf("mix_scheduler_namespaceless_pods_total increased by %v, want 1", got)
+	}
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "pods" {
+			t.Errorf("pods listed in namespace %q for a namespace-less pod", action.GetNamespace())
+		}
+	}
+}
+
+// a pod without labels selects every pod of the namespace, it is not controllable
+func TestLabellessPodSkipped(t *testing.T) {
+	for name, podLabels := range map[string]map[string]string{"nil labels": nil, "empty labels": {}} {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(testNode("od-1", ondemandKey), testPod("web-1", "web", "od-1"))
+			app := newTestAppWithClient(t, client)
+			setMinimums(app, 2, 0)
+
+			pod := testCreatedPod("web")
+			pod.Labels = podLabels
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+			if !resp.Allowed || len(resp.Patch) != 0 {
+				t.Errorf("label-less pod allowed %v patch %s, want allowed unchanged", resp.Allowed, resp.Patch)
+			}
+
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "list" && action.GetResource().Resource == "pods" {
+					t.Errorf("pods listed for a label-less pod")
+				}
+			}
+		})
+	}
+}
+
+// the API server defaults the namespace after the admission, the siblings are counted in the request's
+func TestPodNamespaceFromRequest(t *testing.T) {
+	client := fake.NewSimpleClientset(testNode("od-1", ondemandKey), testPod("web-1", "web", "od-1"))
+	app := newTestAppWithClient(t, client)
+	setMinimums(app, 1, 0)
+
+	pod := testCreatedPod("web")
+	pod.Namespace = ""
+	review := podReview(t, admissionv1.Create, pod)
+	review.Request.Namespace = testNamespace
+
+	if resp := mutate(t, app, review); len(resp.Patch) != 0 {
+		t.Errorf("create pinned although its on-demand sibling exists in %s: %s", testNamespace, resp.Patch)
+	}
+
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "pods" && action.GetNamespace() != testNamespace {
+			t.Errorf("pods listed in namespace %q, want %q", action.GetNamespace(), testNamespace)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// burstDetector detects bursts of pod creates for the same workload, e.g. while the
+// cluster-autoscaler scales up, during which the placement is relaxed to a preference
+type burstDetector struct {
+	threshold int
+	window    time.Duration
+
+	mu      sync.Mutex
+	creates map[string][]time.Time
+}
+
+func newBurstDetector(threshold int, window time.Duration) *burstDetector {
+	return &burstDetector{
+		threshold: threshold,
+		window:    window,
+		creates:   make(map[string][]time.Time),
+	}
+}
+
+// burstKey pods of a workload share the namespace and labels
+func burstKey(pod *corev1.Pod) string {
+	return pod.Namespace + "/" + labels.Set(pod.Labels).String()
+}
+
+// observe records a create of the pod's workload at now and reports whether the workload is bursting
+func (b *burstDetector) observe(pod *corev1.Pod, now time.Time) bool {
+	key := burstKey(pod)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// forget the creates which left the window, also of other workloads so the map does not grow unbounded
+	for k, creates := range b.creates {
+		i := 0
+		for i < len(creates) && now.Sub(creates[i]) > b.window {
+			i++
+		}
+
+		if i == len(creates) {
+			delete(b.creates, k)
+		} else if i > 0 {
+			b.creates[k] = creates[i:]
+		}
+	}
+
+	b.creates[key] = append(b.creates[key], now)
+	return len(b.creates[key]) >= b.threshold
+}
+
+// peek reports whether the workload would be bursting with a create at now, without recording it
+func (b *burstDetector) peek(pod *corev1.Pod, now time.Time) bool {
+	key := burstKey(pod)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := 1
+	for _, create := range b.creates[key] {
+		if now.Sub(create) <= b.window {
+			count++
+		}
+	}
+
+	return count >= b.threshold
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestBurstDetector(t *testing.T) {
+	b := newBurstDetector(3, time.Minute)
+	now := time.Now()
+	web, api := testCreatedPod("web"), testCreatedPod("api")
+
+	if b.observe(web, now) || b.observe(web, now.Add(time.Second)) {
+		t.Fatalf("bursting below the threshold")
+	}
+	if b.observe(api, now.Add(time.Second)) {
+		t.Errorf("another workload's creates counted toward the burst")
+	}
+	if !b.peek(web, now.Add(2*time.Second)) {
+		t.Errorf("peek at the threshold not bursting")
+	}
+	if !b.observe(web, now.Add(2*time.Second)) {
+		t.Errorf("not bursting at the threshold")
+	}
+
+	// the creates left the window
+	if b.observe(web, now.Add(2*time.Minute)) {
+		t.Errorf("bursting after the window")
+	}
+}
+
+// a burst of simultaneous creates only prefers on-demand once the threshold is reached
+func TestBurstRelaxesPlacement(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	setMinimums(app, 10, 0)
+	app.burstDetector = newBurstDetector(3, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+		patch := patchOf(t, resp)
+
+		_, pinned := findPatch(patch, "/spec/nodeSelector")
+		if want := i < 2; pinned != want {
+			t.Errorf("create %d pinned by nodeSelector %v, want %v", i, pinned, want)
+		}
+		if pinned {
+			continue
+		}
+
+		var affinity corev1.Affinity
+		decodePatchValue(t, patch, "/spec/affinity", &affinity)
+		if affinity.NodeAffinity == nil || len(affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution) != 1 {
+			t.Errorf("create %d during the burst without the on-demand preference: %s", i, resp.Patch)
+		}
+	}
+}
+
+func TestBurstWindowFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default", want: 10 * time.Second},
+		{name: "set", window: "30s", want: 30 * time.Second},
+		{name: "zero", window: "0s", wantErr: true},
+		{name: "negative", window: "-5s", wantErr: true},
+		{name: "invalid", window: "brief", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BURST_WINDOW", tt.window)
+
+			window, err := positiveDurationFromEnv("BURST_WINDOW", 10*time.Second)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("window %v, want an error", window)
+				}
+				if !strings.Contains(err.Error(), "BURST_WINDOW") {
+					t.Errorf("error %q does not name BURST_WINDOW", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("burst window: %v", err)
+			}
+			if window != tt.want {
+				t.Errorf("window %v, want %v", window, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// bypassAnnotation lets an operator take a pod out of the webhook entirely, e.g. while debugging,
+// regardless of the mix-scheduler label and the namespace settings
+const bypassAnnotation = "mix-scheduler/bypass"
+
+// podBypassed reports whether the pod bypasses the webhook
+func podBypassed(pod *corev1.Pod) bool {
+	if pod.Annotations[bypassAnnotation] != "true" {
+		return false
+	}
+
+	klog.Infof("pod %s/%s annotated %s=true, bypass", pod.Namespace, pod.Name, bypassAnnotation)
+	return true
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestBypassAnnotation(t *testing.T) {
+	annotated := func(pod *corev1.Pod, value string) *corev1.Pod {
+		pod.Annotations = map[string]string{bypassAnnotation: value}
+		// the label asks for the webhook, the annotation wins
+		pod.Labels[mixSchedulerKey] = "true"
+		return pod
+	}
+
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		value     string
+		bypassed  bool
+	}{
+		{name: "create bypassed", operation: admissionv1.Create, value: "true", bypassed: true},
+		{name: "delete bypassed", operation: admissionv1.Delete, value: "true", bypassed: true},
+		{name: "create not bypassed", operation: admissionv1.Create, value: "false"},
+		{name: "delete not bypassed", operation: admissionv1.Delete, value: "yes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, existing := newLastOnDemandApp(t)
+			app.mixSchedulerRequierd = true
+			setMinimums(app, 2, 0)
+
+			pod := annotated(testCreatedPod("web"), tt.value)
+			if tt.operation == admissionv1.Delete {
+				pod = annotated(existing.DeepCopy(), tt.value)
+			}
+
+			resp := mutate(t, app, podReview(t, tt.operation, pod))
+			if tt.bypassed {
+				if !resp.Allowed || len(resp.Patch) != 0 {
+					t.Errorf("bypassed pod allowed %v patch %s, want allowed unchanged", resp.Allowed, resp.Patch)
+				}
+				return
+			}
+
+			// a create below the minimum is pinned, a delete of the last on-demand pod denied
+			if tt.operation == admissionv1.Create && len(resp.Patch) == 0 {
+				t.Errorf("create not bypassed left unchanged")
+			}
+			if tt.operation == admissionv1.Delete && resp.Allowed {
+				t.Errorf("delete not bypassed allowed")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	cacheSyncInitialDelay = 50 * time.Millisecond
+	cacheSyncMaxDelay     = 500 * time.Millisecond
+)
+
+// waitForCacheSync waits up to cacheSyncWait for the informer cache to sync, polling with a jittered
+// exponential backoff, reports whether it is synced, always true when the wait is disabled so the
+// helpers fall back to live API calls
+func (app *App) waitForCacheSync(ctx context.Context) bool {
+	if app.cacheSyncWait == 0 || app.informermanager.IsSynced() {
+		return true
+	}
+
+	deadline := time.Now().Add(app.cacheSyncWait)
+	delay := cacheSyncInitialDelay
+	for !app.informermanager.IsSynced() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+
+		sleep := wait.Jitter(delay, 0.5)
+		if sleep > remaining {
+			sleep = remaining
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(sleep):
+		}
+
+		if delay *= 2; delay > cacheSyncMaxDelay {
+			delay = cacheSyncMaxDelay
+		}
+	}
+
+	return true
+}
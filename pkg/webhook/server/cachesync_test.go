@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newUnsyncedApp an App whose informers are started but never sync, the PersistentVolumes can not be listed
+func newUnsyncedApp(t *testing.T, objects ...runtime.Object) *App {
+	t.Helper()
+
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("list", "persistentvolumes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("persistentvolumes unavailable")
+	})
+
+	app := newTestAppWithClient(t, client)
+	app.StartInformer()
+	t.Cleanup(app.StopInformer)
+
+	return app
+}
+
+func TestWaitForCacheSyncUnsynced(t *testing.T) {
+	app := newUnsyncedApp(t, testNode("od-1", ondemandKey))
+	app.cacheSyncWait = 200 * time.Millisecond
+
+	start := time.Now()
+	if app.waitForCacheSync(app.Ctx) {
+		t.Fatal("waitForCacheSync reported synced")
+	}
+	if elapsed := time.Since(start); elapsed < app.cacheSyncWait || elapsed > app.cacheSyncWait+time.Second {
+		t.Errorf("waitForCacheSync returned after %v, want about %v", elapsed, app.cacheSyncWait)
+	}
+
+	// past the wait the pod is allowed unchanged instead of listing live
+	resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Errorf("response allowed=%v patch=%s, want allowed unchanged", resp.Allowed, resp.Patch)
+	}
+
+	rec := httptest.NewRecorder()
+	app.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz %d, want %d while unsynced", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestUnsyncedWithoutWaitListsLive(t *testing.T) {
+	app := newUnsyncedApp(t, testNode("od-1", ondemandKey))
+
+	// CACHE_SYNC_WAIT 0 places the pod on the live lists
+	resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if _, ok := findPatch(patchOf(t, resp), "/spec/nodeSelector"); !ok {
+		t.Errorf("patch %s, want the on-demand nodeSelector from the live lists", resp.Patch)
+	}
+}
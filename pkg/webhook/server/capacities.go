@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// parseSpotValues parses the comma separated capacity label values of the interruptible nodes,
+// e.g. spot,preemptible
+func parseSpotValues(val string) ([]string, error) {
+	var values []string
+	seen := make(map[string]struct{})
+	for _, v := range strings.Split(val, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if v == ondemandKey {
+			return nil, fmt.Errorf("%s can not be a spot value", ondemandKey)
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid spot value %q: %s", v, strings.Join(errs, ", "))
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		values = append(values, v)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no spot value in %q", val)
+	}
+
+	return values, nil
+}
+
+// capacityValues the capacity label values of the capacity's nodes, the spot values for spot
+func (app *App) capacityValues(capacity string) []string {
+	if capacity == spotKey {
+		return app.spotValues
+	}
+	return []string{capacity}
+}
+
+// capacitySelector selects the nodes labeled with any value of the capacity
+func (app *App) capacitySelector(capacity string) labels.Selector {
+	values := app.capacityValues(capacity)
+	if len(values) == 1 {
+		return labels.Set{capacityKey: values[0]}.AsSelector()
+	}
+
+	requirement, err := labels.NewRequirement(capacityKey, selection.In, values)
+	if err != nil {
+		// the spot values are validated as label values on startup
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// capacityOfLabel the capacity of a node by its capacity label value, the spot values are spot
+// and a missing label is the unlabeled node capacity
+func (app *App) capacityOfLabel(value string) string {
+	if value == "" {
+		return app.unlabeledNodeCapacity
+	}
+
+	for _, v := range app.spotValues {
+		if v == value {
+			return spotKey
+		}
+	}
+
+	return value
+}
+
+// nodeAffinityAllowsCapacity reports whether the pod's required node affinity can be satisfied
+// by a node of any value of the capacity
+func (app *App) nodeAffinityAllowsCapacity(podSpec corev1.PodSpec, capacity string) bool {
+	for _, value := range app.capacityValues(capacity) {
+		if nodeAffinityAllowsCapacity(podSpec, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// podPinnedToCapacity reports whether the pod can only run on nodes of the capacity,
+// by its nodeSelector or its required node affinity
+func (app *App) podPinnedToCapacity(podSpec corev1.PodSpec, capacity string) bool {
+	if val, ok := podSpec.NodeSelector[capacityKey]; ok {
+		return app.capacityOfLabel(val) == capacity
+	}
+
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil ||
+		podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+
+	// pinned when no other capacity is allowed
+	for _, other := range []string{ondemandKey, spotKey} {
+		if other != capacity && app.nodeAffinityAllowsCapacity(podSpec, other) {
+			return false
+		}
+	}
+
+	return app.nodeAffinityAllowsCapacity(podSpec, capacity)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestUnlabeledNodeCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity string
+		// whether the pod on the unlabeled node counts toward OnDemandMinPodNum
+		ondemand bool
+		spot     bool
+	}{
+		{name: "not counted by default"},
+		{name: "counted as on-demand", capacity: ondemandKey, ondemand: true},
+		{name: "counted as spot", capacity: spotKey, spot: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("plain-1", ""), testPod("web-1", "web", "plain-1"))
+			app.unlabeledNodeCapacity = tt.capacity
+			setMinimums(app, 1, 0)
+
+			if got := app.nodeCapacity("plain-1"); got != tt.capacity {
+				t.Errorf("node capacity %q, want %q", got, tt.capacity)
+			}
+
+			for capacity, want := range map[string]bool{ondemandKey: tt.ondemand, spotKey: tt.spot} {
+				num, err := app.podExistOnNodeCapacityNum(capacity, testCreatedPod("web"))
+				if err != nil {
+					t.Fatalf("count %s pods: %v", capacity, err)
+				}
+				if counted := num == 1; counted != want {
+					t.Errorf("pod on the unlabeled node counted as %s %v, want %v", capacity, counted, want)
+				}
+			}
+
+			// the pod on the unlabeled node satisfies the on-demand minimum only when counted as on-demand
+			resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+			if pinned := len(resp.Patch) != 0; pinned == tt.ondemand {
+				t.Errorf("create pinned %v with the pod counted as on-demand %v", pinned, tt.ondemand)
+			}
+		})
+	}
+}
+
+func TestParseSpotValues(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    []string
+		wantErr bool
+	}{
+		{val: "spot", want: []string{"spot"}},
+		{val: " spot, preemptible ,spot", want: []string{"spot", "preemptible"}},
+		{val: "spot,on-demand", wantErr: true},
+		{val: "spot,not a value", wantErr: true},
+		{val: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSpotValues(tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parse %q: error %v, want error %v", tt.val, err, tt.wantErr)
+			continue
+		}
+		if !equalStrings(got, tt.want) {
+			t.Errorf("parse %q: %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestSpotValues(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), testNode("pre-1", "preemptible"),
+		testPod("web-1", "web", "od-1"), testPod("web-2", "web", "spot-1"), testPod("web-3", "web", "pre-1"))
+	app.spotValues = []string{spotKey, "preemptible"}
+	setMinimums(app, 1, 2)
+
+	if got := app.nodeCapacity("pre-1"); got != spotKey {
+		t.Errorf("preemptible node capacity %q, want %s", got, spotKey)
+	}
+
+	num, err := app.podExistAndReadyOnNodeCapacityNum(spotKey, testCreatedPod("web"))
+	if err != nil {
+		t.Fatalf("count spot pods: %v", err)
+	}
+	if num != 2 {
+		t.Errorf("%d spot pods, want the spot and the preemptible one", num)
+	}
+
+	// the spot and preemptible pods meet the spot minimum, the last on-demand pod is kept
+	if resp := mutate(t, app, podReview(t, admissionv1.Delete, testPod("web-1", "web", "od-1"))); resp.Allowed {
+		t.Errorf("delete of the last on-demand pod allowed with the spot minimum met")
+	}
+
+	// a spot pod may go to either value, a nodeSelector pins only the first
+	pod := testCreatedPod("batch")
+	pod.Labels[capacityLabel] = spotKey
+	if patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod))); patched.Spec.NodeSelector[capacityKey] != spotKey {
+		t.Errorf("spot pod nodeSelector %v, want %s", patched.Spec.NodeSelector, spotKey)
+	}
+
+	// above the on-demand minimum the overflow is preferred to both values
+	app.overflowToSpot = true
+	app.strategy = newPlacementStrategy(app, app.capacityMode)
+	app.placementMode = placementPreferredAffinity
+	patched := applyPatch(t, testCreatedPod("web"), mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web"))))
+	if affinity := patched.Spec.Affinity.NodeAffinity; affinity == nil ||
+		!equalStrings(affinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Preference.MatchExpressions[0].Values, app.spotValues) {
+		t.Errorf("spot pod node affinity %+v, want a preference of %v", affinity, app.spotValues)
+	}
+}
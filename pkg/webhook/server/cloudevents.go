@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	cloudEventSpecVersion   = "1.0"
+	cloudEventPlacementType = "io.github.helen-frank.mix-scheduler.placement"
+	cloudEventDefaultSource = "/mix-scheduler-admission-webhook"
+)
+
+// cloudEventMode CloudEvents HTTP content mode
+type cloudEventMode string
+
+const (
+	// attributes in ce-* headers, the data is the body
+	cloudEventBinary cloudEventMode = "binary"
+	// attributes and data in a application/cloudevents+json body
+	cloudEventStructured cloudEventMode = "structured"
+)
+
+func parseCloudEventMode(val string) (cloudEventMode, error) {
+	switch mode := cloudEventMode(val); mode {
+	case cloudEventBinary, cloudEventStructured:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid cloudevents mode %q, must be one of %s|%s", val, cloudEventBinary, cloudEventStructured)
+	}
+}
+
+// placementDecision the data of a placement CloudEvent
+type placementDecision struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Workload  string `json:"workload"`
+	Capacity  string `json:"capacity"`
+}
+
+type cloudEvent struct {
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	SpecVersion     string            `json:"specversion"`
+	Type            string            `json:"type"`
+	Time            time.Time         `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	Data            placementDecision `json:"data"`
+}
+
+// cloudEventSink posts placement decisions as CloudEvents to the sink url,
+// events are sent in the background and dropped when the sink falls behind
+type cloudEventSink struct {
+	url    string
+	source string
+	mode   cloudEventMode
+
+	client *http.Client
+	events chan cloudEvent
+}
+
+func newCloudEventSink(url, source string, mode cloudEventMode) *cloudEventSink {
+	return &cloudEventSink{
+		url:    url,
+		source: source,
+		mode:   mode,
+		client: &http.Client{Timeout: 5 * time.Second},
+		events: make(chan cloudEvent, 1024),
+	}
+}
+
+// Emit queue the decision, never blocks the admission
+func (s *cloudEventSink) Emit(decision placementDecision) {
+	event := cloudEvent{
+		ID:              newCloudEventID(),
+		Source:          s.source,
+		SpecVersion:     cloudEventSpecVersion,
+		Type:            cloudEventPlacementType,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            decision,
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		klog.Warningf("cloudevents sink queue full, drop event %s", event.ID)
+	}
+}
+
+// Run send the queued events until stopCh is closed
+func (s *cloudEventSink) Run(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case event := <-s.events:
+			if err := s.send(event); err != nil {
+				klog.Errorf("send cloudevent %s: %v", event.ID, err)
+			}
+		}
+	}
+}
+
+func (s *cloudEventSink) send(event cloudEvent) error {
+	req, err := s.newRequest(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (s *cloudEventSink) newRequest(event cloudEvent) (*http.Request, error) {
+	if s.mode == cloudEventStructured {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("marshal cloudevent: %v", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+		return req, nil
+	}
+
+	body, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, fmt.Errorf("marshal cloudevent data: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", event.DataContentType)
+	req.Header.Set("ce-id", event.ID)
+	req.Header.Set("ce-source", event.Source)
+	req.Header.Set("ce-specversion", event.SpecVersion)
+	req.Header.Set("ce-type", event.Type)
+	req.Header.Set("ce-time", event.Time.Format(time.RFC3339Nano))
+	return req, nil
+}
+
+func newCloudEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sinkRequest a request received by the sink
+type sinkRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// sendPlacement emits the decision to a sink of the mode, returns the request the sink received
+func sendPlacement(t *testing.T, mode cloudEventMode, decision placementDecision) sinkRequest {
+	t.Helper()
+
+	received := make(chan sinkRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- sinkRequest{header: r.Header.Clone(), body: body}
+	}))
+	defer server.Close()
+
+	sink := newCloudEventSink(server.URL, cloudEventDefaultSource, mode)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go sink.Run(stopCh)
+
+	sink.Emit(decision)
+
+	select {
+	case req := <-received:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the sink received no cloudevent")
+		return sinkRequest{}
+	}
+}
+
+func TestCloudEventBinary(t *testing.T) {
+	decision := placementDecision{Namespace: testNamespace, Pod: "web-1", Workload: "Deployment/web", Capacity: ondemandKey}
+	req := sendPlacement(t, cloudEventBinary, decision)
+
+	for header, want := range map[string]string{
+		"Content-Type":   "application/json",
+		"ce-specversion": cloudEventSpecVersion,
+		"ce-type":        cloudEventPlacementType,
+		"ce-source":      cloudEventDefaultSource,
+	} {
+		if got := req.header.Get(header); got != want {
+			t.Errorf("header %s %q, want %q", header, got, want)
+		}
+	}
+	if req.header.Get("ce-id") == "" {
+		t.Errorf("no ce-id header")
+	}
+	if _, err := time.Parse(time.RFC3339Nano, req.header.Get("ce-time")); err != nil {
+		t.Errorf("ce-time %q: %v", req.header.Get("ce-time"), err)
+	}
+
+	var data placementDecision
+	if err := json.Unmarshal(req.body, &data); err != nil {
+		t.Fatalf("unmarshal body %s: %v", req.body, err)
+	}
+	if data != decision {
+		t.Errorf("data %+v, want %+v", data, decision)
+	}
+}
+
+func TestCloudEventStructured(t *testing.T) {
+	decision := placementDecision{Namespace: testNamespace, Pod: "web-1", Workload: "Deployment/web", Capacity: spotKey}
+	req := sendPlacement(t, cloudEventStructured, decision)
+
+	if got := req.header.Get("Content-Type"); got != "application/cloudevents+json" {
+		t.Errorf("Content-Type %q, want application/cloudevents+json", got)
+	}
+	if got := req.header.Get("ce-type"); got != "" {
+		t.Errorf("ce-type header %q in structured mode", got)
+	}
+
+	var event cloudEvent
+	if err := json.Unmarshal(req.body, &event); err != nil {
+		t.Fatalf("unmarshal body %s: %v", req.body, err)
+	}
+	if event.SpecVersion != cloudEventSpecVersion || event.Type != cloudEventPlacementType || event.Source != cloudEventDefaultSource || event.ID == "" {
+		t.Errorf("event attributes %+v", event)
+	}
+	if event.Data != decision {
+		t.Errorf("data %+v, want %+v", event.Data, decision)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errAdmissionSaturated every admission slot stayed taken for the queue wait
+var errAdmissionSaturated = errors.New("too many admission requests in flight")
+
+// admissionLimiter bounds the admission requests processed at once, each counts and lists
+// pods and nodes, so a stampede of creates would otherwise load the cache and the API server
+type admissionLimiter struct {
+	slots chan struct{}
+	// how long a request waits for a slot
+	wait time.Duration
+}
+
+func newAdmissionLimiter(maxInFlight int, wait time.Duration) *admissionLimiter {
+	return &admissionLimiter{
+		slots: make(chan struct{}, maxInFlight),
+		wait:  wait,
+	}
+}
+
+// acquire takes a slot, the returned func gives it back, nil safe, a request not getting
+// a slot within the wait fails with an internal error so it goes through the failure policy
+func (l *admissionLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	admissionsSaturatedTotal.Inc()
+	return nil, internalErrorf("%w, %d processed at once", errAdmissionSaturated, cap(l.slots))
+}
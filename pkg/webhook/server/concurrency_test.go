@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestAdmissionLimiterCapsConcurrency(t *testing.T) {
+	limiter := newAdmissionLimiter(2, 5*time.Second)
+
+	var inFlight, maxInFlight int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := limiter.acquire(context.Background())
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			defer release()
+
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("%d processed at once, want at most the 2 slots", maxInFlight)
+	}
+}
+
+func TestAdmissionLimiterSaturated(t *testing.T) {
+	limiter := newAdmissionLimiter(1, 10*time.Millisecond)
+	release, err := limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	before := counterValue(t, admissionsSaturatedTotal)
+	if _, err := limiter.acquire(context.Background()); !errors.Is(err, errAdmissionSaturated) || !isInternalError(err) {
+		t.Errorf("acquire of a taken slot: %v, want an internal saturated error", err)
+	}
+	if got := counterValue(t, admissionsSaturatedTotal) - before; got != 1 {
+		t.Errorf("mix_scheduler_admissions_saturated_total increased by %v, want 1", got)
+	}
+
+	release()
+	if _, err := limiter.acquire(context.Background()); err != nil {
+		t.Errorf("acquire of a released slot: %v", err)
+	}
+}
+
+func TestSaturatedAdmissionFollowsFailurePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy  failurePolicy
+		allowed bool
+	}{
+		{policy: failurePolicyFail},
+		{policy: failurePolicyIgnore, allowed: true},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+			app.failurePolicy = tt.policy
+			app.admissionLimiter = newAdmissionLimiter(1, 10*time.Millisecond)
+
+			// a request in flight holds the only slot
+			release, err := app.admissionLimiter.acquire(context.Background())
+			if err != nil {
+				t.Fatalf("acquire: %v", err)
+			}
+			defer release()
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+			if resp.Allowed != tt.allowed || len(resp.Patch) != 0 {
+				t.Errorf("saturated create allowed %v patch %s, want allowed %v unchanged", resp.Allowed, resp.Patch, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// effectiveConfig the settings the webhook runs with, as served on /config
+type effectiveConfig struct {
+	OnDemandMinPodNum int `json:"onDemandMinPodNum"`
+	SpotMinPodNum     int `json:"spotMinPodNum"`
+
+	OnDemandMinPercent int `json:"onDemandMinPercent"`
+	MinReplicasToAct   int `json:"minReplicasToAct,omitempty"`
+
+	Tiers []string `json:"tiers"`
+
+	MutatePath   string `json:"mutatePath"`
+	ValidatePath string `json:"validatePath"`
+
+	DryRun               bool   `json:"dryRun"`
+	MixSchedulerRequired bool   `json:"mixSchedulerRequired"`
+	LeaderElection       bool   `json:"leaderElection"`
+	ClientTimeout        string `json:"clientTimeout"`
+	CacheSyncWait        string `json:"cacheSyncWait"`
+
+	MaxConcurrentAdmissions int    `json:"maxConcurrentAdmissions,omitempty"`
+	AdmissionQueueWait      string `json:"admissionQueueWait,omitempty"`
+
+	NotControllerNamespaces  []string `json:"notControllerNamespaces"`
+	ControlledNamespaces     []string `json:"controlledNamespaces,omitempty"`
+	NamespaceSelector        string   `json:"namespaceSelector,omitempty"`
+	NamespaceSelectorDefault bool     `json:"namespaceSelectorDefault"`
+	ControlledPodSelector    string   `json:"controlledPodSelector,omitempty"`
+	SpotValues               []string `json:"spotValues"`
+	UnlabeledNodeCapacity    string   `json:"unlabeledNodeCapacity,omitempty"`
+
+	OnDemandNodeSelector map[string]string `json:"onDemandNodeSelector"`
+	SpotNodeSelector     map[string]string `json:"spotNodeSelector"`
+
+	CapacityMode                string `json:"capacityMode"`
+	OverflowToSpot              bool   `json:"overflowToSpot"`
+	StatefulSetOrdinalPlacement bool   `json:"statefulSetOrdinalPlacement"`
+	PlacementMode               string `json:"placementMode"`
+	PatchMode                   string `json:"patchMode"`
+	FailurePolicy               string `json:"failurePolicy"`
+	EvictionGuardPolicy         string `json:"evictionGuardPolicy"`
+	NodeAffinityConflictPolicy  string `json:"nodeAffinityConflictPolicy"`
+	ValidateNodeAffinity        bool   `json:"validateNodeAffinity"`
+	UnsatisfiableAffinityPolicy string `json:"unsatisfiableAffinityPolicy"`
+	CheckVolumeNodeAffinity     bool   `json:"checkVolumeNodeAffinity"`
+	TopologySpreadPolicy        string `json:"topologySpreadPolicy"`
+	NodeNamePolicy              string `json:"nodeNamePolicy"`
+	EmptyCapacityPolicy         string `json:"emptyCapacityPolicy"`
+	OwnerResolutionFailure      string `json:"ownerResolutionFailure"`
+
+	AntiAffinityTopologyKey string `json:"antiAffinityTopologyKey"`
+	AntiAffinityWeight      int32  `json:"antiAffinityWeight"`
+
+	SpotToleration     bool `json:"spotToleration"`
+	NodeWeightAffinity bool `json:"nodeWeightAffinity"`
+
+	SpotRequestFactors map[corev1.ResourceName]float64 `json:"spotRequestFactors,omitempty"`
+
+	ExcludeCordonedFromFloor           bool     `json:"excludeCordonedFromFloor"`
+	DrainTaintKeys                     []string `json:"drainTaintKeys,omitempty"`
+	CountSiblingsByOwner               bool     `json:"countSiblingsByOwner"`
+	SkipDaemonSetPods                  bool     `json:"skipDaemonSetPods"`
+	EnforceScaleDownOrder              bool     `json:"enforceScaleDownOrder"`
+	DeleteGuardRespectPDB              bool     `json:"deleteGuardRespectPDB"`
+	DeleteGuardSkipPropagationPolicies []string `json:"deleteGuardSkipPropagationPolicies,omitempty"`
+	AllowScaleToZeroDelete             bool     `json:"allowScaleToZeroDelete"`
+	ReadinessContainers                []string `json:"readinessContainers,omitempty"`
+
+	ReservationWindow    string `json:"reservationWindow,omitempty"`
+	BurstCreateThreshold int    `json:"burstCreateThreshold,omitempty"`
+	BurstWindow          string `json:"burstWindow,omitempty"`
+
+	AnnotationTemplate       map[string]string `json:"annotationTemplate,omitempty"`
+	MetricsWorkloadAllowlist []string          `json:"metricsWorkloadAllowlist,omitempty"`
+	MetricsWorkloadLimit     int               `json:"metricsWorkloadLimit"`
+	CloudEventsSink          string            `json:"cloudEventsSink,omitempty"`
+
+	MaxRequestBytes int64  `json:"maxRequestBytes"`
+	LatencyBudget   string `json:"latencyBudget"`
+
+	SlowRequestThreshold string `json:"slowRequestThreshold,omitempty"`
+
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+// effectiveConfig the config relevant fields of the app, the credentials of the CloudEvents sink URL are redacted
+func (app *App) effectiveConfig() *effectiveConfig {
+	reloadable := app.reloadableConfig()
+
+	config := &effectiveConfig{
+		OnDemandMinPodNum: reloadable.OnDemandMinPodNum,
+		SpotMinPodNum:     reloadable.SpotMinPodNum,
+
+		OnDemandMinPercent: app.ondemandMinPercent,
+		MinReplicasToAct:   app.minReplicasToAct,
+
+		MutatePath:   app.mutatePath,
+		ValidatePath: app.validatePath,
+
+		DryRun:               app.dryRun,
+		MixSchedulerRequired: app.mixSchedulerRequierd,
+		LeaderElection:       app.leaderElection,
+		ClientTimeout:        app.clientTimeout.String(),
+		CacheSyncWait:        app.cacheSyncWait.String(),
+
+		NotControllerNamespaces:  sortedKeys(reloadable.notControllerNamespace),
+		ControlledNamespaces:     sortedKeys(reloadable.controlledNamespaces),
+		NamespaceSelectorDefault: reloadable.namespaceSelectorDefault,
+		SpotValues:               app.spotValues,
+		UnlabeledNodeCapacity:    app.unlabeledNodeCapacity,
+
+		OnDemandNodeSelector: app.ondemandNodeSelector,
+		SpotNodeSelector:     app.spotNodeSelector,
+
+		CapacityMode:                string(app.capacityMode),
+		OverflowToSpot:              app.overflowToSpot,
+		StatefulSetOrdinalPlacement: app.statefulSetOrdinalPlacement,
+		PlacementMode:               string(app.placementMode),
+		PatchMode:                   string(app.patchMode),
+		FailurePolicy:               string(app.failurePolicy),
+		EvictionGuardPolicy:         string(app.evictionGuardPolicy),
+		NodeAffinityConflictPolicy:  string(app.nodeAffinityConflictPolicy),
+		ValidateNodeAffinity:        app.validateNodeAffinity,
+		UnsatisfiableAffinityPolicy: string(app.unsatisfiableAffinityPolicy),
+		CheckVolumeNodeAffinity:     app.checkVolumeNodeAffinity,
+		TopologySpreadPolicy:        string(app.topologySpreadPolicy),
+		NodeNamePolicy:              string(app.nodeNamePolicy),
+		EmptyCapacityPolicy:         string(app.emptyCapacityPolicy),
+		OwnerResolutionFailure:      string(app.ownerResolutionFailurePolicy),
+
+		AntiAffinityTopologyKey: app.AntiAffinityTopologyKey,
+		AntiAffinityWeight:      app.AntiAffinityWeight,
+
+		SpotToleration:     app.spotToleration != nil,
+		NodeWeightAffinity: app.nodeWeightAffinity,
+		SpotRequestFactors: app.spotRequestFactors,
+
+		ExcludeCordonedFromFloor: app.excludeCordonedFromFloor,
+		DrainTaintKeys:           sortedKeys(app.drainTaintKeys),
+		CountSiblingsByOwner:     app.countSiblingsByOwner,
+		SkipDaemonSetPods:        app.skipDaemonSetPods,
+		EnforceScaleDownOrder:    app.enforceScaleDownOrder,
+		DeleteGuardRespectPDB:    app.deleteGuardRespectPDB,
+		AllowScaleToZeroDelete:   app.allowScaleToZeroDelete,
+		ReadinessContainers:      sortedKeys(app.readinessContainers),
+
+		AnnotationTemplate:       app.annotationTemplateRaw,
+		MetricsWorkloadAllowlist: sortedKeys(app.metricsWorkloadAllowlist),
+		MetricsWorkloadLimit:     app.metricsWorkloads.limit,
+
+		MaxRequestBytes: app.maxRequestBytes,
+		LatencyBudget:   app.latencyBudget.String(),
+	}
+
+	if app.slowRequestThreshold > 0 {
+		config.SlowRequestThreshold = app.slowRequestThreshold.String()
+	}
+
+	if app.configMap != "" {
+		config.ConfigMap = app.configMap
+	}
+
+	if app.controlledPodSelector != nil {
+		config.ControlledPodSelector = app.controlledPodSelector.String()
+	}
+
+	if reloadable.namespaceSelector != nil {
+		config.NamespaceSelector = reloadable.namespaceSelector.String()
+	}
+
+	for _, tier := range app.tiers {
+		config.Tiers = append(config.Tiers, tier.String())
+	}
+
+	for policy := range app.deleteGuardSkipPropagationPolicies {
+		config.DeleteGuardSkipPropagationPolicies = append(config.DeleteGuardSkipPropagationPolicies, string(policy))
+	}
+	sort.Strings(config.DeleteGuardSkipPropagationPolicies)
+
+	if app.admissionLimiter != nil {
+		config.MaxConcurrentAdmissions = cap(app.admissionLimiter.slots)
+		config.AdmissionQueueWait = app.admissionLimiter.wait.String()
+	}
+
+	if app.reservations != nil {
+		config.ReservationWindow = app.reservations.window.String()
+	}
+
+	if app.burstDetector != nil {
+		config.BurstCreateThreshold = app.burstDetector.threshold
+		config.BurstWindow = app.burstDetector.window.String()
+	}
+
+	if app.cloudEventSink != nil {
+		config.CloudEventsSink = redactURL(app.cloudEventSink.url)
+	}
+
+	return config
+}
+
+// HandleConfig serves the effective config as JSON
+func (app *App) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	jsonOk(w, app.effectiveConfig())
+}
+
+// sortedKeys the keys of the set in order, nil for an empty set
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// redactURL drops the user info and query of the URL, which may carry credentials
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	u.RawQuery = ""
+
+	return u.String()
+}
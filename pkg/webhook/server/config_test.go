@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigAnnotationTemplateNotExpanded(t *testing.T) {
+	t.Setenv("TEAM_TOKEN", "s3cr3t")
+
+	template, err := parseAnnotationTemplate("team=platform,token=${TEAM_TOKEN}")
+	if err != nil {
+		t.Fatalf("parse annotation template: %v", err)
+	}
+
+	app := newTestApp(t)
+	app.annotationTemplateRaw = template
+	app.annotationTemplate = expandAnnotationTemplate(template)
+	if got := app.annotationTemplate["token"]; got != "s3cr3t" {
+		t.Fatalf("token annotation %q, want the expanded env", got)
+	}
+
+	rec := httptest.NewRecorder()
+	app.HandleConfig(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleConfig answered %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "s3cr3t") {
+		t.Fatalf("/config exposes the expanded env: %s", rec.Body.String())
+	}
+
+	var config effectiveConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	if got := config.AnnotationTemplate["token"]; got != "${TEAM_TOKEN}" {
+		t.Errorf("served token annotation %q, want the unexpanded ${TEAM_TOKEN}", got)
+	}
+}
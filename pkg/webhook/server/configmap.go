@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// namespace of the CONFIG_CONFIGMAP, the namespace the webhook is deployed to
+	defaultConfigMapNamespace = "mix-scheduler-system"
+
+	// result label of the ConfigMap reloads
+	reloadApplied = "applied"
+	reloadInvalid = "invalid"
+	// the ConfigMap was deleted, the env config is back
+	reloadReverted = "reverted"
+)
+
+// reloadableConfig the settings the CONFIG_CONFIGMAP may change at runtime, its keys are named after the env
+type reloadableConfig struct {
+	OnDemandMinPodNum int
+	SpotMinPodNum     int
+
+	notControllerNamespace map[string]struct{}
+	// only these namespaces are controlled instead of all but notControllerNamespace, nil for the denylist
+	controlledNamespaces map[string]struct{}
+	// namespaces whose labels match are controlled, nil to decide by the namespace lists
+	namespaceSelector labels.Selector
+	// whether a namespace is controlled when the selector can not be evaluated on it
+	namespaceSelectorDefault bool
+}
+
+// reloadableConfig the current snapshot of the reloadable config, read it once per decision
+// so the settings it is made with are consistent
+func (app *App) reloadableConfig() *reloadableConfig {
+	return app.config.Load()
+}
+
+// setReloadableConfig swaps in a copy of the config, the requests in flight keep reading the previous one
+func (app *App) setReloadableConfig(config reloadableConfig) {
+	app.config.Store(&config)
+}
+
+// reloadableConfigFromConfigMap the config of the ConfigMap's data on top of the env config,
+// keys missing from the ConfigMap keep their env value
+func reloadableConfigFromConfigMap(env reloadableConfig, data map[string]string) (reloadableConfig, error) {
+	config := env
+
+	for _, key := range []string{"OnDemandMinPodNum", "SpotMinPodNum"} {
+		val, ok := data[key]
+		if !ok {
+			continue
+		}
+
+		num, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return config, fmt.Errorf("parse %s: %v", key, err)
+		}
+		if num < 0 {
+			return config, fmt.Errorf("%s must not be negative, got %d", key, num)
+		}
+
+		if key == "OnDemandMinPodNum" {
+			config.OnDemandMinPodNum = num
+		} else {
+			config.SpotMinPodNum = num
+		}
+	}
+
+	notControlled, notControlledOk := data["notControllerNamespace"]
+	controlled, controlledOk := data["CONTROLLED_NAMESPACES"]
+	switch {
+	case notControlledOk && controlledOk:
+		return config, fmt.Errorf("CONTROLLED_NAMESPACES and notControllerNamespace are mutually exclusive")
+	case notControlledOk:
+		config.notControllerNamespace = parseNamespaceSet(notControlled)
+		config.controlledNamespaces = nil
+	case controlledOk:
+		config.controlledNamespaces = parseNamespaceSet(controlled)
+		config.notControllerNamespace = nil
+	}
+
+	if val, ok := data["CONTROLLED_NAMESPACE_SELECTOR"]; ok {
+		config.namespaceSelector = nil
+		if val = strings.TrimSpace(val); val != "" {
+			selector, err := labels.Parse(val)
+			if err != nil {
+				return config, fmt.Errorf("parse CONTROLLED_NAMESPACE_SELECTOR: %v", err)
+			}
+			config.namespaceSelector = selector
+		}
+	}
+
+	if val, ok := data["CONTROLLED_NAMESPACE_DEFAULT"]; ok {
+		config.namespaceSelectorDefault = strings.TrimSpace(val) == "true"
+	}
+
+	return config, nil
+}
+
+// parseNamespaceSet the comma separated namespaces as a set, never nil
+func parseNamespaceSet(val string) map[string]struct{} {
+	namespaces := make(map[string]struct{})
+	for _, ns := range strings.Split(val, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces[ns] = struct{}{}
+		}
+	}
+
+	return namespaces
+}
+
+// applyConfigMap reloads the config from the ConfigMap, an invalid ConfigMap keeps the current config
+func (app *App) applyConfigMap(cm *corev1.ConfigMap) {
+	config, err := reloadableConfigFromConfigMap(app.envConfig, cm.Data)
+	if err != nil {
+		configReloadsTotal.WithLabelValues(reloadInvalid).Inc()
+		klog.Errorf("configmap %s/%s: %v, keep the current config", cm.Namespace, cm.Name, err)
+		return
+	}
+
+	app.setReloadableConfig(config)
+
+	configReloadsTotal.WithLabelValues(reloadApplied).Inc()
+	klog.Infof("configmap %s/%s resourceVersion %s applied, OnDemandMinPodNum %d SpotMinPodNum %d", cm.Namespace, cm.Name,
+		cm.ResourceVersion, config.OnDemandMinPodNum, config.SpotMinPodNum)
+}
+
+// revertConfigMap drops the overrides of a deleted ConfigMap, the env config applies again
+func (app *App) revertConfigMap(namespace, name string) {
+	app.setReloadableConfig(app.envConfig)
+
+	configReloadsTotal.WithLabelValues(reloadReverted).Inc()
+	klog.Infof("configmap %s/%s deleted, reverted to the env config, OnDemandMinPodNum %d SpotMinPodNum %d", namespace, name,
+		app.envConfig.OnDemandMinPodNum, app.envConfig.SpotMinPodNum)
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigMapUpdateChangesMinimum(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), testPod("web-1", "web", "od-1"))
+	setMinimums(app, 1, 0)
+
+	capacityOf := func() string {
+		t.Helper()
+		pod := testCreatedPod("web")
+		patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+		return patched.Spec.NodeSelector[capacityKey]
+	}
+
+	if got := capacityOf(); got != "" {
+		t.Fatalf("nodeSelector capacity %q above the env minimum, want none", got)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mix-scheduler", Namespace: defaultConfigMapNamespace, ResourceVersion: "1"},
+		Data:       map[string]string{"OnDemandMinPodNum": "2"},
+	}
+	app.applyConfigMap(cm)
+	if got := capacityOf(); got != ondemandKey {
+		t.Errorf("nodeSelector capacity %q below the ConfigMap's minimum, want %q", got, ondemandKey)
+	}
+
+	// an invalid update keeps the minimum of the last valid one
+	invalid := cm.DeepCopy()
+	invalid.ResourceVersion = "2"
+	invalid.Data["OnDemandMinPodNum"] = "two"
+	app.applyConfigMap(invalid)
+	if config := app.reloadableConfig(); config.OnDemandMinPodNum != 2 {
+		t.Errorf("OnDemandMinPodNum %d after an invalid update, want 2", config.OnDemandMinPodNum)
+	}
+}
+
+func TestConfigMapDeleteRevertsToEnv(t *testing.T) {
+	app := newTestApp(t)
+	app.envConfig.OnDemandMinPodNum = 2
+	app.envConfig.SpotMinPodNum = 1
+	app.setReloadableConfig(app.envConfig)
+
+	app.applyConfigMap(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mix-scheduler", Namespace: defaultConfigMapNamespace},
+		Data:       map[string]string{"OnDemandMinPodNum": "5", "CONTROLLED_NAMESPACES": "team-a"},
+	})
+	if config := app.reloadableConfig(); config.OnDemandMinPodNum != 5 || config.controlledNamespaces == nil {
+		t.Fatalf("ConfigMap not applied: OnDemandMinPodNum %d controlled namespaces %v", config.OnDemandMinPodNum, config.controlledNamespaces)
+	}
+
+	app.revertConfigMap(defaultConfigMapNamespace, "mix-scheduler")
+
+	config := app.reloadableConfig()
+	if config.OnDemandMinPodNum != 2 || config.SpotMinPodNum != 1 {
+		t.Errorf("OnDemandMinPodNum %d SpotMinPodNum %d after the delete, want the env's 2 and 1", config.OnDemandMinPodNum, config.SpotMinPodNum)
+	}
+	if config.controlledNamespaces != nil {
+		t.Errorf("controlled namespaces %v after the delete, want the env's denylist", config.controlledNamespaces)
+	}
+}
+
+// TestConfigReloadConcurrentReads run with -race, the reads in HandleMutate and instanceIsSkip
+// go to one snapshot while a writer keeps swapping the config
+func TestConfigReloadConcurrentReads(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), testPod("web-1", "web", "od-1"))
+	setMinimums(app, 1, 0)
+
+	stop := make(chan struct{})
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			app.applyConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "mix-scheduler", Namespace: defaultConfigMapNamespace, ResourceVersion: strconv.Itoa(i)},
+				Data: map[string]string{
+					"OnDemandMinPodNum":      strconv.Itoa(i % 3),
+					"notControllerNamespace": "kube-system,ns-" + strconv.Itoa(i),
+				},
+			})
+		}
+	}()
+
+	review := podReview(t, admissionv1.Create, testCreatedPod("web"))
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; i < 50; i++ {
+				app.instanceIsSkip(testNamespace, map[string]string{"app": "web"})
+				if code, resp := postReview(t, app.HandleMutate, review); code != http.StatusOK || resp == nil || !resp.Response.Allowed {
+					t.Errorf("HandleMutate answered %d %+v during a reload", code, resp)
+					return
+				}
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(stop)
+	writer.Wait()
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// cordoned the node marked unschedulable
+func cordoned(node *corev1.Node) *corev1.Node {
+	node.Spec.Unschedulable = true
+	return node
+}
+
+// the create floor leaves the pods of cordoned nodes out, the delete guard still counts them
+func TestCordonedNodesCreateAndDelete(t *testing.T) {
+	for _, exclude := range []bool{false, true} {
+		newApp := func() (*corev1.Pod, *App) {
+			serving := testPod("web-2", "web", "od-2")
+			app := newTestApp(t, cordoned(testNode("od-1", ondemandKey)), testNode("od-2", ondemandKey),
+				testPod("web-1", "web", "od-1"), serving)
+			app.excludeCordonedFromFloor = exclude
+			return serving, app
+		}
+
+		_, app := newApp()
+		setMinimums(app, 2, 0)
+		resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+		if _, pinned := findPatch(patchOf(t, resp), "/spec/nodeSelector"); pinned != exclude {
+			t.Errorf("exclude cordoned %v: create pinned %v, want %v", exclude, pinned, exclude)
+		}
+
+		serving, app := newApp()
+		setMinimums(app, 1, 0)
+		if resp := mutate(t, app, podReview(t, admissionv1.Delete, serving)); !resp.Allowed {
+			t.Errorf("exclude cordoned %v: delete denied although the pod on the cordoned node still serves: %v", exclude, resp.Result)
+		}
+	}
+}
+
+// a node tainted by the cluster autoscaler or Karpenter is drained like a cordoned one
+func TestDrainTaintedNodeNotCounted(t *testing.T) {
+	tests := []struct {
+		name   string
+		taint  string
+		pinned bool
+	}{
+		{name: "cluster autoscaler", taint: "ToBeDeletedByClusterAutoscaler", pinned: true},
+		{name: "karpenter", taint: "karpenter.sh/disrupted", pinned: true},
+		{name: "unrelated taint", taint: "dedicated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tainted := testNode("od-1", ondemandKey)
+			tainted.Spec.Taints = []corev1.Taint{{Key: tt.taint, Effect: corev1.TaintEffectNoSchedule}}
+			app := newTestApp(t, tainted, testNode("od-2", ondemandKey), testPod("web-1", "web", "od-1"))
+			setMinimums(app, 1, 0)
+			app.excludeCordonedFromFloor = true
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+			if _, pinned := findPatch(patchOf(t, resp), "/spec/nodeSelector"); pinned != tt.pinned {
+				t.Errorf("taint %s: create pinned %v, want %v", tt.taint, pinned, tt.pinned)
+			}
+		})
+	}
+}
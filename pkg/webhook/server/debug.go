@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// debugCount the counts of a workload as the webhook sees them, as served on /debug/count
+type debugCount struct {
+	Namespace     string `json:"namespace"`
+	LabelSelector string `json:"labelSelector"`
+	Synced        bool   `json:"synced"`
+
+	OnDemandReady int `json:"onDemandReady"`
+	SpotReady     int `json:"spotReady"`
+	// pods on the capacity regardless of readiness, including those pinned to it and not yet scheduled
+	OnDemandExist int `json:"onDemandExist"`
+	SpotExist     int `json:"spotExist"`
+
+	OnDemandMin int `json:"onDemandMin"`
+	SpotMin     int `json:"spotMin"`
+}
+
+// HandleDebugCount serves the counts of the workload selected by the namespace and labelSelector
+// query params, the selector is matched like the pod labels of an admission request, so only
+// equality requirements are supported
+func (app *App) HandleDebugCount(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		jsonError(w, "namespace is required", http.StatusBadRequest)
+		return
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		jsonError(w, fmt.Sprintf("parse labelSelector: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	podLabels, err := labels.ConvertSelectorToLabelsMap(selector.String())
+	if err != nil || len(podLabels) == 0 {
+		jsonError(w, "labelSelector must be a non-empty list of key=value requirements", http.StatusBadRequest)
+		return
+	}
+
+	// the helpers count the siblings of a pod, a pod carrying the workload's labels stands in for it
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Labels:    podLabels,
+		},
+	}
+
+	ondemandMin, spotMin := app.minPodNums(namespace)
+	count := &debugCount{
+		Namespace:     namespace,
+		LabelSelector: podLabels.String(),
+		Synced:        app.informermanager.IsSynced(),
+		OnDemandMin:   ondemandMin,
+		SpotMin:       spotMin,
+	}
+
+	for _, c := range []struct {
+		num   *int
+		count func(capacity string, pod *corev1.Pod) (int, error)
+		key   string
+	}{
+		{&count.OnDemandReady, app.podExistAndReadyOnNodeCapacityNum, ondemandKey},
+		{&count.SpotReady, app.podExistAndReadyOnNodeCapacityNum, spotKey},
+		{&count.OnDemandExist, app.podExistOnNodeCapacityNum, ondemandKey},
+		{&count.SpotExist, app.podExistOnNodeCapacityNum, spotKey},
+	} {
+		num, err := c.count(c.key, pod)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		*c.num = num
+	}
+
+	jsonOk(w, count)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHandleDebugCount(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey),
+		testPod("web-1", "web", "od-1"), notReady(testPod("web-2", "web", "od-1")),
+		testPod("web-3", "web", "spot-1"), testPod("api-1", "api", "spot-1"))
+	setMinimums(app, 2, 1)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		code  int
+		want  debugCount
+	}{
+		{
+			name:  "workload counts",
+			query: url.Values{"namespace": {testNamespace}, "labelSelector": {"app=web"}},
+			code:  http.StatusOK,
+			want: debugCount{
+				Namespace: testNamespace, LabelSelector: "app=web",
+				OnDemandReady: 1, SpotReady: 1, OnDemandExist: 2, SpotExist: 1,
+				OnDemandMin: 2, SpotMin: 1,
+			},
+		},
+		{name: "without namespace", query: url.Values{"labelSelector": {"app=web"}}, code: http.StatusBadRequest},
+		{name: "without selector", query: url.Values{"namespace": {testNamespace}}, code: http.StatusBadRequest},
+		{name: "set based selector", query: url.Values{"namespace": {testNamespace}, "labelSelector": {"app in (web,api)"}}, code: http.StatusBadRequest},
+		{name: "invalid selector", query: url.Values{"namespace": {testNamespace}, "labelSelector": {"app=="}}, code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			app.HandleDebugCount(rec, httptest.NewRequest(http.MethodGet, "/debug/count?"+tt.query.Encode(), nil))
+
+			if rec.Code != tt.code {
+				t.Fatalf("answered %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var got debugCount
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode counts %s: %v", rec.Body, err)
+			}
+			if got != tt.want {
+				t.Errorf("counts %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
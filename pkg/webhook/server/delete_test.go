@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newLastOnDemandApp an App keeping one on-demand pod of web, the on-demand pod web-1 is its only one
+func newLastOnDemandApp(t *testing.T, objects ...runtime.Object) (*App, *corev1.Pod) {
+	t.Helper()
+
+	pod := testPod("web-1", "web", "od-1")
+	app := newTestApp(t, append([]runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey), pod}, objects...)...)
+	setMinimums(app, 1, 0)
+
+	return app, pod
+}
+
+// deleteReview the AdmissionReview of the delete of the pod with the options, nil for none
+func deleteReview(t *testing.T, pod *corev1.Pod, opts *metav1.DeleteOptions) *admissionv1.AdmissionReview {
+	t.Helper()
+
+	review := podReview(t, admissionv1.Delete, pod)
+	if opts != nil {
+		raw, err := json.Marshal(opts)
+		if err != nil {
+			t.Fatalf("marshal delete options: %v", err)
+		}
+		review.Request.Options = runtime.RawExtension{Raw: raw}
+	}
+	return review
+}
+
+func TestDeleteOptions(t *testing.T) {
+	propagation := func(policy metav1.DeletionPropagation) *metav1.DeleteOptions {
+		return &metav1.DeleteOptions{PropagationPolicy: &policy}
+	}
+
+	tests := []struct {
+		name    string
+		opts    *metav1.DeleteOptions
+		allowed bool
+	}{
+		{name: "no options"},
+		{name: "skipped propagation policy", opts: propagation(metav1.DeletePropagationOrphan), allowed: true},
+		{name: "other propagation policy", opts: propagation(metav1.DeletePropagationForeground)},
+		{name: "grace period only", opts: &metav1.DeleteOptions{GracePeriodSeconds: new(int64)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, pod := newLastOnDemandApp(t)
+			app.deleteGuardSkipPropagationPolicies = map[metav1.DeletionPropagation]struct{}{metav1.DeletePropagationOrphan: {}}
+
+			resp := mutate(t, app, deleteReview(t, pod, tt.opts))
+			if resp.Allowed != tt.allowed {
+				t.Errorf("delete allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestDeleteOptionsInvalid(t *testing.T) {
+	app, pod := newLastOnDemandApp(t)
+
+	review := podReview(t, admissionv1.Delete, pod)
+	review.Request.Options = runtime.RawExtension{Raw: []byte(`{"propagationPolicy":1}`)}
+
+	resp := mutate(t, app, review)
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusBadRequest {
+		t.Errorf("delete with invalid options allowed %v result %v, want a 400 denial", resp.Allowed, resp.Result)
+	}
+}
+
+func TestDeleteScaledToZero(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int32
+		allow    bool
+		allowed  bool
+	}{
+		{name: "scaled to zero", replicas: 0, allow: true, allowed: true},
+		{name: "scaled down", replicas: 1, allow: true},
+		{name: "scale to zero guarded", replicas: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := ownedBy(testPod("web-1", "web", "od-1"), "ReplicaSet", "web-5d4f8c")
+			app := newTestApp(t, testNode("od-1", ondemandKey), pod, testReplicaSet("web-5d4f8c", "web", tt.replicas))
+			setMinimums(app, 1, 0)
+			app.allowScaleToZeroDelete = tt.allow
+
+			resp := mutate(t, app, podReview(t, admissionv1.Delete, pod))
+			if resp.Allowed != tt.allowed {
+				t.Errorf("delete allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestDeleteStatefulSetScaledToZero(t *testing.T) {
+	replicas := int32(0)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: testNamespace},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+	}
+	pod := statefulSetPod("db-0", "db", "od-1")
+
+	app := newTestApp(t, testNode("od-1", ondemandKey), pod, sts)
+	setMinimums(app, 1, 0)
+
+	if resp := mutate(t, app, podReview(t, admissionv1.Delete, pod)); !resp.Allowed {
+		t.Errorf("delete of the last pod of a StatefulSet scaled to zero denied: %v", resp.Result)
+	}
+}
+
+func TestScaleDownOrderDisabled(t *testing.T) {
+	for _, enforce := range []bool{true, false} {
+		app, pod := newLastOnDemandApp(t)
+		app.enforceScaleDownOrder = enforce
+
+		resp := mutate(t, app, deleteReview(t, pod, nil))
+		if resp.Allowed == enforce {
+			t.Errorf("ENFORCE_SCALE_DOWN_ORDER %v: delete of the last on-demand pod allowed %v", enforce, resp.Allowed)
+		}
+		if len(resp.Patch) != 0 || len(resp.Warnings) != 0 {
+			t.Errorf("ENFORCE_SCALE_DOWN_ORDER %v: delete patched %s warned %q", enforce, resp.Patch, resp.Warnings)
+		}
+		if events := recordedEvents(app); !enforce && len(events) != 0 {
+			t.Errorf("delete passed through with events %v", events)
+		}
+	}
+}
+
+func TestDeleteDenialMessage(t *testing.T) {
+	app, pod := newLastOnDemandApp(t, testPod("web-2", "web", "spot-1"), testPod("web-3", "web", "spot-1"))
+	setMinimums(app, 2, 1)
+
+	resp := mutate(t, app, deleteReview(t, pod, nil))
+	if resp.Allowed {
+		t.Fatalf("delete of an on-demand pod below the minimum allowed")
+	}
+
+	want := "cannot delete on-demand pod default/web-1: on-demand ready left=0 < min=2, spot ready=2 >= min=1, preferentially scale pods on spot nodes"
+	if resp.Result == nil || resp.Result.Message != want {
+		t.Errorf("denial message %q, want %q", resp.Result.Message, want)
+	}
+}
+
+func TestDeleteGuardRespectPDB(t *testing.T) {
+	tests := []struct {
+		name    string
+		respect bool
+		pdb     *policyv1.PodDisruptionBudget
+		allowed bool
+	}{
+		{name: "budget allowing the disruption", respect: true, pdb: testPDB("web", 1), allowed: true},
+		{name: "budget allowing no disruption", respect: true, pdb: testPDB("web", 0)},
+		{name: "budget of another workload", respect: true, pdb: testPDB("api", 1)},
+		{name: "budgets not respected", pdb: testPDB("web", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, pod := newLastOnDemandApp(t, tt.pdb)
+			app.deleteGuardRespectPDB = tt.respect
+
+			resp := mutate(t, app, deleteReview(t, pod, nil))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			// a delete below the minimum the budget allows is surfaced to the user
+			if tt.allowed && len(resp.Warnings) != 1 {
+				t.Errorf("warnings %q, want one about the minimum", resp.Warnings)
+			}
+		})
+	}
+}
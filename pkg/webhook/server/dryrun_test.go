@@ -0,0 +1,63 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestDryRunMode(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	setMinimums(app, 1, 0)
+	app.dryRun = true
+
+	resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if !resp.Allowed {
+		t.Fatalf("pod denied in dry run: %v", resp.Result)
+	}
+	if len(resp.Patch) != 0 || resp.PatchType != nil {
+		t.Errorf("patch %s in dry run, want none", resp.Patch)
+	}
+}
+
+// a server-side dry run gets the patch of a real create without the create being recorded
+func TestAdmissionRequestDryRun(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	setMinimums(app, 1, 0)
+
+	dryRunReview := func() *admissionv1.AdmissionReview {
+		review := podReview(t, admissionv1.Create, ownedBy(testCreatedPod("web"), "StatefulSet", "web"))
+		dryRun := true
+		review.Request.DryRun = &dryRun
+		return review
+	}
+
+	placements := placementsTotal.WithLabelValues(testNamespace, "StatefulSet/web", ondemandKey)
+	before := counterValue(t, placements)
+
+	// not reserved, the second dry run is pinned like the first
+	for i := 0; i < 2; i++ {
+		resp := mutate(t, app, dryRunReview())
+		if _, ok := findPatch(patchOf(t, resp), "/spec/nodeSelector"); !ok {
+			t.Fatalf("dry run %d not pinned: %s", i, resp.Patch)
+		}
+	}
+	if got := counterValue(t, placements) - before; got != 0 {
+		t.Errorf("dry runs counted %v placements, want none", got)
+	}
+	if events := recordedEvents(app); len(events) != 0 {
+		t.Errorf("dry runs recorded events %v", events)
+	}
+
+	// the real create is recorded and reserves the on-demand slot
+	mutate(t, app, podReview(t, admissionv1.Create, ownedBy(testCreatedPod("web"), "StatefulSet", "web")))
+	if got := counterValue(t, placements) - before; got != 1 {
+		t.Errorf("create counted %v placements, want 1", got)
+	}
+	if events := recordedEvents(app); len(events) != 1 {
+		t.Errorf("create recorded events %v, want one", events)
+	}
+	if resp := mutate(t, app, dryRunReview()); len(resp.Patch) != 0 {
+		t.Errorf("dry run after the reserved create pinned: %s", resp.Patch)
+	}
+}
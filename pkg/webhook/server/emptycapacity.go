@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultDrainTaintKeys the taints the cluster autoscaler and Karpenter put on the nodes they scale down
+const defaultDrainTaintKeys = "ToBeDeletedByClusterAutoscaler,karpenter.sh/disrupted"
+
+// parseDrainTaintKeys parses the comma separated taint keys, empty for none besides the cordon
+func parseDrainTaintKeys(val string) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, key := range strings.Split(val, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// emptyCapacityPolicy decides how a pod is placed when its capacity has no schedulable node,
+// a nodeSelector pin would leave it pending until a node of the capacity joins
+type emptyCapacityPolicy string
+
+const (
+	// only prefer the capacity, the pod runs on the other one meanwhile
+	emptyCapacityPrefer emptyCapacityPolicy = "prefer"
+	// leave the pod to the scheduler
+	emptyCapacitySkip emptyCapacityPolicy = "skip"
+	// pin the pod anyway, e.g. when the cluster autoscaler scales the node group up from zero
+	emptyCapacityPin emptyCapacityPolicy = "pin"
+)
+
+func parseEmptyCapacityPolicy(val string) (emptyCapacityPolicy, error) {
+	switch policy := emptyCapacityPolicy(val); policy {
+	case emptyCapacityPrefer, emptyCapacitySkip, emptyCapacityPin:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid empty capacity policy %q, must be one of %s|%s|%s", val, emptyCapacityPrefer, emptyCapacitySkip, emptyCapacityPin)
+	}
+}
+
+// capacityHasSchedulableNodes reports whether a node labeled with the capacity accepts pods and is not draining,
+// the placement only targets labeled nodes so the unlabeled ones are not considered
+func (app *App) capacityHasSchedulableNodes(capacity string) (bool, error) {
+	nodes, err := app.ListNode(app.capacitySelector(capacity))
+	if err != nil {
+		return false, internalErrorf("get %s nodes: %v", capacity, err)
+	}
+
+	for _, node := range nodes {
+		if !app.nodeDraining(node) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// the pod is below the on-demand minimum while no schedulable on-demand node exists
+func TestNoOndemandNodes(t *testing.T) {
+	preferOndemand := &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+			Weight: 100,
+			Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: capacityKey, Operator: corev1.NodeSelectorOpIn, Values: []string{ondemandKey}},
+			}},
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		policy emptyCapacityPolicy
+		nodes  []runtime.Object
+		// the capacity of the nodeSelector, empty for none
+		selector     string
+		nodeAffinity *corev1.NodeAffinity
+	}{
+		{name: "prefer", policy: emptyCapacityPrefer, nodeAffinity: preferOndemand},
+		{name: "skip", policy: emptyCapacitySkip},
+		{name: "pin", policy: emptyCapacityPin, selector: ondemandKey},
+		{name: "only a cordoned on-demand node", policy: emptyCapacityPrefer, nodes: []runtime.Object{cordoned(testNode("od-1", ondemandKey))}, nodeAffinity: preferOndemand},
+		{name: "a schedulable on-demand node", policy: emptyCapacityPrefer, nodes: []runtime.Object{testNode("od-1", ondemandKey)}, selector: ondemandKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append([]runtime.Object{testNode("spot-1", spotKey)}, tt.nodes...)...)
+			setMinimums(app, 1, 0)
+			app.emptyCapacityPolicy = tt.policy
+
+			pod := testCreatedPod("web")
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+			if !resp.Allowed {
+				t.Fatalf("pod denied: %v", resp.Result)
+			}
+
+			patched := applyPatch(t, pod, resp)
+			if got := patched.Spec.NodeSelector[capacityKey]; got != tt.selector {
+				t.Errorf("nodeSelector capacity %q, want %q", got, tt.selector)
+			}
+
+			var nodeAffinity *corev1.NodeAffinity
+			if patched.Spec.Affinity != nil {
+				nodeAffinity = patched.Spec.Affinity.NodeAffinity
+			}
+			if !equality.Semantic.DeepEqual(nodeAffinity, tt.nodeAffinity) {
+				t.Errorf("node affinity %+v, want %+v", nodeAffinity, tt.nodeAffinity)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventComponent the source component of the emitted events
+const eventComponent = "mix-scheduler-admission-webhook"
+
+// event reasons
+const (
+	eventReasonPinnedOnDemand    = "PinnedOnDemand"
+	eventReasonScaleDownDenied   = "ScaleDownDenied"
+	eventReasonEvictionDenied    = "EvictionDenied"
+	eventReasonPlacementRejected = "PlacementRejected"
+)
+
+// newEventRecorder records events to the API server through the client
+func newEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+}
+
+// eventTarget the object the events about the pod are recorded on, its controller when it has one
+// as the pod of a create has no name yet and the workload owner is who reads them, nil when there is none
+func eventTarget(pod *corev1.Pod) *corev1.ObjectReference {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return &corev1.ObjectReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Namespace:  pod.Namespace,
+			Name:       owner.Name,
+			UID:        owner.UID,
+		}
+	}
+
+	if pod.Name == "" {
+		return nil
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// recordEvent records an event about the pod on its event target
+func (app *App) recordEvent(pod *corev1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	if app.eventRecorder == nil {
+		return
+	}
+
+	target := eventTarget(pod)
+	if target == nil {
+		return
+	}
+
+	app.eventRecorder.Eventf(target, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDecisionEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		review func(t *testing.T, app *App) *admissionv1.AdmissionReview
+		// the FakeRecorder event prefix, type and reason, empty for no event
+		want string
+	}{
+		{
+			name: "pinned on-demand",
+			review: func(t *testing.T, app *App) *admissionv1.AdmissionReview {
+				return podReview(t, admissionv1.Create, ownedBy(testCreatedPod("web"), "StatefulSet", "web"))
+			},
+			want: corev1.EventTypeNormal + " " + eventReasonPinnedOnDemand,
+		},
+		{
+			name: "pod of a create without name or owner",
+			review: func(t *testing.T, app *App) *admissionv1.AdmissionReview {
+				return podReview(t, admissionv1.Create, testCreatedPod("web"))
+			},
+		},
+		{
+			name: "placement rejected",
+			review: func(t *testing.T, app *App) *admissionv1.AdmissionReview {
+				app.nodeNamePolicy = nodeNameReject
+				pod := ownedBy(testCreatedPod("web"), "StatefulSet", "web")
+				pod.Spec.NodeName = "spot-1"
+				return podReview(t, admissionv1.Create, pod)
+			},
+			want: corev1.EventTypeWarning + " " + eventReasonPlacementRejected,
+		},
+		{
+			name: "scale down denied",
+			review: func(t *testing.T, app *App) *admissionv1.AdmissionReview {
+				return podReview(t, admissionv1.Delete, testPod("web-1", "web", "od-1"))
+			},
+			want: corev1.EventTypeWarning + " " + eventReasonScaleDownDenied,
+		},
+		{
+			name: "eviction denied",
+			review: func(t *testing.T, app *App) *admissionv1.AdmissionReview {
+				app.evictionGuardPolicy = evictionGuardFloor
+				return evictionReview(t, testPod("web-1", "web", "od-1"))
+			},
+			want: corev1.EventTypeWarning + " " + eventReasonEvictionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), testPod("web-1", "web", "od-1"))
+			setMinimums(app, 2, 0)
+
+			mutate(t, app, tt.review(t, app))
+
+			events := recordedEvents(app)
+			if tt.want == "" {
+				if len(events) != 0 {
+					t.Errorf("events %v, want none", events)
+				}
+				return
+			}
+			if len(events) != 1 || !strings.HasPrefix(events[0], tt.want+" ") {
+				t.Errorf("events %v, want one %q", events, tt.want)
+			}
+		})
+	}
+}
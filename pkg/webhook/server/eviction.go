@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// evictionSubResource the pods subresource node drains and the descheduler create evictions through
+const evictionSubResource = "eviction"
+
+// evictionGuardPolicy decides whether evictions of on-demand pods go through the scale down guard
+type evictionGuardPolicy string
+
+const (
+	// allow every eviction
+	evictionGuardIgnore evictionGuardPolicy = "ignore"
+	// deny evictions dropping the on-demand pods below the floor, like deletes
+	evictionGuardFloor evictionGuardPolicy = "floor"
+	// deny evictions dropping the on-demand pods below the floor unless a PodDisruptionBudget
+	// governing the pod allows the disruption, the budget then owns the drain
+	evictionGuardFloorUnlessPDB evictionGuardPolicy = "floor-unless-pdb"
+)
+
+func parseEvictionGuardPolicy(val string) (evictionGuardPolicy, error) {
+	switch policy := evictionGuardPolicy(val); policy {
+	case evictionGuardIgnore, evictionGuardFloor, evictionGuardFloorUnlessPDB:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid eviction guard policy %q, must be one of %s|%s|%s", val,
+			evictionGuardIgnore, evictionGuardFloor, evictionGuardFloorUnlessPDB)
+	}
+}
+
+// governingPDBs the PodDisruptionBudgets whose selector matches the pod
+func (app *App) governingPDBs(pod *corev1.Pod) ([]*policyv1.PodDisruptionBudget, error) {
+	pdbs, err := app.ListPodDisruptionBudget(pod.Namespace)
+	if err != nil {
+		return nil, internalErrorf("list pod disruption budgets: %v", err)
+	}
+
+	var governing []*policyv1.PodDisruptionBudget
+	for _, pdb := range pdbs {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("pod disruption budget %s/%s selector: %v", pdb.Namespace, pdb.Name, err)
+		}
+
+		// a nil or empty selector of a policy/v1 budget selects no pods
+		if selector.Empty() {
+			continue
+		}
+
+		if selector.Matches(labels.Set(pod.Labels)) {
+			governing = append(governing, pdb)
+		}
+	}
+
+	return governing, nil
+}
+
+// pdbAllowsDisruption reports whether the pod is governed by PodDisruptionBudgets which all allow a disruption,
+// the API server rejects the eviction itself when one of them does not
+func (app *App) pdbAllowsDisruption(pod *corev1.Pod) (bool, error) {
+	pdbs, err := app.governingPDBs(pod)
+	if err != nil {
+		return false, err
+	}
+
+	if len(pdbs) == 0 {
+		return false, nil
+	}
+
+	for _, pdb := range pdbs {
+		if pdb.Status.DisruptionsAllowed <= 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// evictionAllowed decides an eviction of the pod on an on-demand node according to the eviction guard policy,
+// a denial comes with the counts it was judged on
+func (app *App) evictionAllowed(pod *corev1.Pod) (bool, string, error) {
+	if app.evictionGuardPolicy == evictionGuardIgnore {
+		return true, "", nil
+	}
+
+	ondemandMin, spotMin := app.minPodNums(pod.Namespace)
+	spotReady, ondemandLeft, err := app.scaleDownReadyCounts(pod)
+	if err != nil {
+		return false, "", err
+	}
+	if spotReady < spotMin || ondemandLeft >= ondemandMin {
+		return true, "", nil
+	}
+
+	counts := scaleDownCounts(ondemandLeft, ondemandMin, spotReady, spotMin)
+	if app.evictionGuardPolicy == evictionGuardFloorUnlessPDB {
+		allowed, err := app.pdbAllowsDisruption(pod)
+		return allowed, counts, err
+	}
+
+	return false, counts, nil
+}
+
+// handleEviction guards the eviction of on-demand pods, the request carries the Eviction so the pod is read from the cluster
+func (app *App) handleEviction(w http.ResponseWriter, r *http.Request, admissionReview *admissionv1.AdmissionReview) {
+	pod, err := app.GetPod(admissionReview.Request.Namespace, admissionReview.Request.Name, metav1.GetOptions{})
+	if err != nil {
+		// the API server answers the eviction of a missing pod itself
+		klog.Warningf("get evicted pod %s/%s: %v, skip", admissionReview.Request.Namespace, admissionReview.Request.Name, err)
+		recordAdmission(admissionReview, decisionSkipped)
+		writeNil(w, admissionReview)
+		return
+	}
+
+	if podBypassed(pod) || app.daemonSetPod(pod) || app.instanceIsSkip(pod.Namespace, pod.Labels) || app.nodeCapacity(pod.Spec.NodeName) != ondemandKey {
+		recordAdmission(admissionReview, decisionSkipped)
+		writeNil(w, admissionReview)
+		return
+	}
+
+	allowed, counts, err := app.evictionAllowed(pod)
+	if err != nil {
+		recordAdmission(admissionReview, decisionDenied)
+		app.HandleError(w, r, admissionReview, err)
+		return
+	}
+
+	if !allowed {
+		app.recordEvent(pod, corev1.EventTypeWarning, eventReasonEvictionDenied,
+			"eviction of pod %s on %s node %s denied: %s, preferentially evict pods on spot nodes", pod.Name, ondemandKey, pod.Spec.NodeName, counts)
+		recordAdmission(admissionReview, decisionDenied)
+		app.HandleError(w, r, admissionReview, fmt.Errorf("cannot evict %s pod %s/%s: %s, preferentially evict pods on spot nodes",
+			ondemandKey, pod.Namespace, pod.Name, counts))
+		return
+	}
+
+	klog.Infof("pod %s/%s eviction allowed", pod.Namespace, pod.Name)
+	recordAdmission(admissionReview, decisionAllowed)
+	writeNil(w, admissionReview)
+}
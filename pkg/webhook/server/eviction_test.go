@@ -0,0 +1,190 @@
+package server
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testPDB(app string, disruptionsAllowed int32) *policyv1.PodDisruptionBudget {
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: app, Namespace: testNamespace},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+		},
+		Status: policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: disruptionsAllowed},
+	}
+}
+
+func TestHandleEviction(t *testing.T) {
+	nodes := []runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+
+	bypassed := testPod("web-1", "web", "od-1")
+	bypassed.Annotations = map[string]string{bypassAnnotation: "true"}
+
+	tests := []struct {
+		name     string
+		policy   evictionGuardPolicy
+		existing []runtime.Object
+		evicted  *corev1.Pod
+		allowed  bool
+	}{
+		{
+			name:     "ignore allows the last on-demand pod",
+			policy:   evictionGuardIgnore,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1")},
+			evicted:  testPod("web-1", "web", "od-1"),
+			allowed:  true,
+		},
+		{
+			name:     "floor denies the last on-demand pod",
+			policy:   evictionGuardFloor,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1")},
+			evicted:  testPod("web-1", "web", "od-1"),
+		},
+		{
+			name:     "floor allows an on-demand pod above the minimum",
+			policy:   evictionGuardFloor,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "od-1")},
+			evicted:  testPod("web-1", "web", "od-1"),
+			allowed:  true,
+		},
+		{
+			name:     "floor allows spot pods",
+			policy:   evictionGuardFloor,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "spot-1")},
+			evicted:  testPod("web-2", "web", "spot-1"),
+			allowed:  true,
+		},
+		{
+			name:     "floor-unless-pdb leaves it to a budget allowing the disruption",
+			policy:   evictionGuardFloorUnlessPDB,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPDB("web", 1)},
+			evicted:  testPod("web-1", "web", "od-1"),
+			allowed:  true,
+		},
+		{
+			name:     "floor-unless-pdb denies when the budget allows no disruption",
+			policy:   evictionGuardFloorUnlessPDB,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPDB("web", 0)},
+			evicted:  testPod("web-1", "web", "od-1"),
+		},
+		{
+			name:     "a bypassed pod is allowed",
+			policy:   evictionGuardFloor,
+			existing: []runtime.Object{bypassed},
+			evicted:  bypassed,
+			allowed:  true,
+		},
+		{
+			name:    "a missing pod is left to the API server",
+			policy:  evictionGuardFloor,
+			evicted: testPod("web-1", "web", "od-1"),
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append(append([]runtime.Object{}, nodes...), tt.existing...)...)
+			app.evictionGuardPolicy = tt.policy
+			app.envConfig.OnDemandMinPodNum = 1
+			app.envConfig.SpotMinPodNum = 0
+			app.setReloadableConfig(app.envConfig)
+
+			resp := mutate(t, app, evictionReview(t, tt.evicted))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if len(resp.Patch) != 0 {
+				t.Errorf("eviction patched %s", resp.Patch)
+			}
+		})
+	}
+}
+
+func TestEvictionFloorAndPDB(t *testing.T) {
+	otherPDB := testPDB("api", 1)
+	secondPDB := testPDB("web", 0)
+	secondPDB.Name = "web-strict"
+
+	tests := []struct {
+		name     string
+		spotMin  int
+		existing []runtime.Object
+		allowed  bool
+	}{
+		{
+			name:     "no budget governs the pod",
+			existing: []runtime.Object{testPod("web-1", "web", "od-1")},
+		},
+		{
+			name:     "a budget of another workload",
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), otherPDB},
+		},
+		{
+			name:     "one of the governing budgets allows no disruption",
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPDB("web", 1), secondPDB},
+		},
+		{
+			name:     "above the floor without a budget",
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "od-1")},
+			allowed:  true,
+		},
+		{
+			name:     "the spot minimum is not met, the drain is not blocked",
+			spotMin:  1,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPDB("web", 0)},
+			allowed:  true,
+		},
+		{
+			name:     "the spot minimum is met and the budget allows no disruption",
+			spotMin:  1,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "spot-1"), testPDB("web", 0)},
+		},
+		{
+			name:     "the spot minimum is met and the budget allows the disruption",
+			spotMin:  1,
+			existing: []runtime.Object{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "spot-1"), testPDB("web", 1)},
+			allowed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append([]runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}, tt.existing...)...)
+			app.evictionGuardPolicy = evictionGuardFloorUnlessPDB
+			setMinimums(app, 1, tt.spotMin)
+
+			resp := mutate(t, app, evictionReview(t, testPod("web-1", "web", "od-1")))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestGoverningPDBs(t *testing.T) {
+	emptySelector := testPDB("empty", 1)
+	emptySelector.Spec.Selector = &metav1.LabelSelector{}
+	otherNamespace := testPDB("web", 1)
+	otherNamespace.Namespace = "team-a"
+
+	// through the clientset and through the PodDisruptionBudget informer
+	for name, newApp := range map[string]func(t *testing.T, objects ...runtime.Object) *App{"client": newTestApp, "informer": newSyncedApp} {
+		t.Run(name, func(t *testing.T) {
+			app := newApp(t, testPDB("web", 1), testPDB("api", 1), emptySelector, otherNamespace)
+
+			pdbs, err := app.governingPDBs(testPod("web-1", "web", "od-1"))
+			if err != nil {
+				t.Fatalf("governing pdbs: %v", err)
+			}
+			if len(pdbs) != 1 || pdbs[0].Name != "web" || pdbs[0].Namespace != testNamespace {
+				t.Errorf("governing pdbs %v, want default/web", pdbs)
+			}
+		})
+	}
+}
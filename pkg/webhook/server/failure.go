@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// failurePolicy decides what happens to the request when the webhook fails internally,
+// e.g. listing nodes fails during an API server blip, denials by policy are not affected
+type failurePolicy string
+
+const (
+	// allow the request unchanged, fail open
+	failurePolicyIgnore failurePolicy = "Ignore"
+	// deny the request with the error, fail closed
+	failurePolicyFail failurePolicy = "Fail"
+)
+
+func parseFailurePolicy(val string) (failurePolicy, error) {
+	switch policy := failurePolicy(val); policy {
+	case failurePolicyIgnore, failurePolicyFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid failure policy %q, must be one of %s|%s", val, failurePolicyIgnore, failurePolicyFail)
+	}
+}
+
+// internalError an error of the webhook itself rather than a denial of the request
+type internalError struct {
+	err error
+}
+
+func (e *internalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *internalError) Unwrap() error {
+	return e.err
+}
+
+// internalErrorf formats an internalError
+func internalErrorf(format string, args ...interface{}) error {
+	return &internalError{err: fmt.Errorf(format, args...)}
+}
+
+// isInternalError reports whether err is an internalError
+func isInternalError(err error) bool {
+	var ie *internalError
+	return errors.As(err, &ie)
+}
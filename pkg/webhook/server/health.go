@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/version"
+)
+
+// HandleHealthz liveness, ok as long as the process serves
+func (app *App) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	writeBytes(w, []byte("ok"))
+}
+
+// HandleVersion the build info of the running binary
+func (app *App) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	jsonOk(w, version.Get())
+}
+
+// HandleReadyz readiness, ok once the informer cache is synced so pods are not
+// judged on live lists while the webhook warms up
+func (app *App) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !app.informermanager.IsSynced() {
+		http.Error(w, "informer cache not synced", http.StatusServiceUnavailable)
+		return
+	}
+
+	if app.readyzCheckCert {
+		if err := checkCertExpiry(app.certReloader.Leaf(), time.Now(), app.readyzCertExpiryWindow); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeBytes(w, []byte("ok"))
+}
+
+// checkCertExpiry fails when the serving certificate is not yet valid, expired or expires within window
+func checkCertExpiry(cert *x509.Certificate, now time.Time, window time.Duration) error {
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("serving certificate not valid before %s", cert.NotBefore.Format(time.RFC3339))
+	}
+
+	if now.Add(window).After(cert.NotAfter) {
+		return fmt.Errorf("serving certificate expires at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
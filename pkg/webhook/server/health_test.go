@@ -0,0 +1,218 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/version"
+)
+
+// writeTestKeyPair writes a self-signed keypair of the common name valid from notBefore to notAfter
+// to tls.crt and tls.key in the dir, returns their paths
+func writeTestKeyPair(t *testing.T, dir, commonName string, notBefore, notAfter time.Time) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certPath, keyPath = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	return certPath, keyPath
+}
+
+// loadTestKeyPair a certReloader serving a keypair written like writeTestKeyPair
+func loadTestKeyPair(t *testing.T, dir string, notBefore, notAfter time.Time) *certReloader {
+	t.Helper()
+
+	reloader, err := newCertReloader(writeTestKeyPair(t, dir, "webhook-server", notBefore, notAfter))
+	if err != nil {
+		t.Fatalf("new cert reloader: %v", err)
+	}
+	return reloader
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+		wantErr   bool
+	}{
+		{name: "valid", notBefore: now.Add(-time.Hour), notAfter: now.Add(30 * 24 * time.Hour)},
+		{name: "expired", notBefore: now.Add(-48 * time.Hour), notAfter: now.Add(-time.Hour), wantErr: true},
+		{name: "expires within the window", notBefore: now.Add(-time.Hour), notAfter: now.Add(time.Hour), wantErr: true},
+		{name: "not yet valid", notBefore: now.Add(time.Hour), notAfter: now.Add(30 * 24 * time.Hour), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloader := loadTestKeyPair(t, t.TempDir(), tt.notBefore, tt.notAfter)
+
+			err := checkCertExpiry(reloader.Leaf(), now, 24*time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkCertExpiry error %v, want an error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadyzExpiredCert(t *testing.T) {
+	now := time.Now()
+
+	for _, check := range []bool{false, true} {
+		app := newSyncedApp(t)
+		app.certReloader = loadTestKeyPair(t, t.TempDir(), now.Add(-48*time.Hour), now.Add(-time.Hour))
+		app.readyzCheckCert = check
+
+		rec := httptest.NewRecorder()
+		app.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		want := http.StatusOK
+		if check {
+			want = http.StatusServiceUnavailable
+		}
+		if rec.Code != want {
+			t.Errorf("READYZ_CHECK_CERT %v: readyz %d with an expired cert, want %d", check, rec.Code, want)
+		}
+	}
+}
+
+// readiness reports on the keypair being served, not on the files on disk
+func TestReadyzChecksLoadedCert(t *testing.T) {
+	now := time.Now()
+
+	readyz := func(app *App) int {
+		rec := httptest.NewRecorder()
+		app.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	t.Run("rotated on disk before the reload", func(t *testing.T) {
+		dir := t.TempDir()
+		app := newSyncedApp(t)
+		app.certReloader = loadTestKeyPair(t, dir, now.Add(-48*time.Hour), now.Add(-time.Hour))
+		app.readyzCheckCert = true
+
+		// renewed on disk, still serving the expired one until the reload
+		writeTestKeyPair(t, dir, "webhook-server", now.Add(-time.Hour), now.Add(30*24*time.Hour))
+		touch(t, now.Add(time.Minute), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+		if code := readyz(app); code != http.StatusServiceUnavailable {
+			t.Errorf("readyz %d serving an expired cert, want %d", code, http.StatusServiceUnavailable)
+		}
+
+		if _, err := app.certReloader.reload(); err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		if code := readyz(app); code != http.StatusOK {
+			t.Errorf("readyz %d once the renewed cert is served, want %d", code, http.StatusOK)
+		}
+	})
+
+	t.Run("broken rotation", func(t *testing.T) {
+		dir := t.TempDir()
+		app := newSyncedApp(t)
+		app.certReloader = loadTestKeyPair(t, dir, now.Add(-time.Hour), now.Add(30*24*time.Hour))
+		app.readyzCheckCert = true
+
+		if err := os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("not a certificate"), 0o600); err != nil {
+			t.Fatalf("break certificate: %v", err)
+		}
+		touch(t, now.Add(time.Minute), filepath.Join(dir, "tls.crt"))
+		if _, err := app.certReloader.reload(); err == nil {
+			t.Fatalf("reload of a broken certificate succeeded")
+		}
+
+		if code := readyz(app); code != http.StatusOK {
+			t.Errorf("readyz %d still serving the valid cert, want %d", code, http.StatusOK)
+		}
+	})
+}
+
+func TestReadyzCertExpiryWindowFromEnv(t *testing.T) {
+	for val, want := range map[string]time.Duration{"": 0, "72h": 72 * time.Hour} {
+		t.Setenv("READYZ_CERT_EXPIRY_WINDOW", val)
+
+		window, err := positiveDurationFromEnv("READYZ_CERT_EXPIRY_WINDOW", 0)
+		if err != nil || window != want {
+			t.Errorf("READYZ_CERT_EXPIRY_WINDOW %q window %v error %v, want %v", val, window, err, want)
+		}
+	}
+
+	// a negative window would only fail readiness once the certificate expired that long ago
+	for _, val := range []string{"0s", "-24h", "a week"} {
+		t.Setenv("READYZ_CERT_EXPIRY_WINDOW", val)
+
+		if window, err := positiveDurationFromEnv("READYZ_CERT_EXPIRY_WINDOW", 0); err == nil {
+			t.Errorf("READYZ_CERT_EXPIRY_WINDOW %q accepted as %v", val, window)
+		}
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	injected := version.Info{Version: "v1.2.3", GitCommit: "abc1234", BuildDate: "2024-01-02T03:04:05Z"}
+
+	saved := version.Get()
+	version.Version, version.GitCommit, version.BuildDate = injected.Version, injected.GitCommit, injected.BuildDate
+	t.Cleanup(func() {
+		version.Version, version.GitCommit, version.BuildDate = saved.Version, saved.GitCommit, saved.BuildDate
+	})
+
+	rec := httptest.NewRecorder()
+	newTestApp(t).HandleVersion(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("version answered %d %s, want 200 application/json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var got version.Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode version %s: %v", rec.Body, err)
+	}
+	if got.Version != injected.Version || got.GitCommit != injected.GitCommit || got.BuildDate != injected.BuildDate {
+		t.Errorf("version %+v, want the injected %+v", got, injected)
+	}
+	if got.GoVersion != runtime.Version() {
+		t.Errorf("go version %q, want %q", got.GoVersion, runtime.Version())
+	}
+}
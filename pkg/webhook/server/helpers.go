@@ -1,28 +1,99 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/klog/v2"
 )
 
 // http helpers
 
-// HandleError depending on error type
-func (app *App) HandleError(w http.ResponseWriter, r *http.Request, err error) {
-	jsonError(w, err.Error(), http.StatusBadRequest)
+// HandleError depending on error type, internal errors allow the request with failurePolicy Ignore,
+// a parsed request is answered with an AdmissionReview
+// denying it with the error, the API server expects those with status 200 and the request's UID
+func (app *App) HandleError(w http.ResponseWriter, r *http.Request, admissionReview *admissionv1.AdmissionReview, err error) {
+	code, reason := http.StatusBadRequest, metav1.StatusReasonBadRequest
+	if errors.Is(err, errRequestTooLarge) {
+		code, reason = http.StatusRequestEntityTooLarge, metav1.StatusReasonRequestEntityTooLarge
+	} else if errors.Is(err, errAdmissionSaturated) {
+		code, reason = http.StatusTooManyRequests, metav1.StatusReasonTooManyRequests
+	}
+
+	if admissionReview == nil || admissionReview.Request == nil {
+		jsonError(w, err.Error(), code)
+		return
+	}
+
+	if app.failurePolicy == failurePolicyIgnore && isInternalError(err) {
+		klog.Errorf("admission request %s: %v, fail open", admissionReview.Request.UID, err)
+		writeNil(w, admissionReview)
+		return
+	}
+
+	// create the AdmissionResponse
+	admissionResponse := &admissionv1.AdmissionResponse{
+		UID:     admissionReview.Request.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  reason,
+			Code:    int32(code),
+		},
+	}
+
+	respAdmissionReview := &admissionv1.AdmissionReview{
+		TypeMeta: responseTypeMeta(admissionReview),
+		Response: admissionResponse,
+	}
+
+	jsonOk(w, respAdmissionReview)
 }
 
-// readJSON from request body
-func readJSON(r *http.Request, v interface{}) error {
-	err := json.NewDecoder(r.Body).Decode(v)
+// admissionV1beta1 the AdmissionReview version of API servers before 1.16, its JSON is the same as v1
+const admissionV1beta1 = "admission.k8s.io/v1beta1"
+
+// responseTypeMeta the TypeMeta of the response to the AdmissionReview, the API server
+// only accepts a response of the version it sent
+func responseTypeMeta(admissionReview *admissionv1.AdmissionReview) metav1.TypeMeta {
+	apiVersion := admissionv1.SchemeGroupVersion.String()
+	if admissionReview.APIVersion == admissionV1beta1 {
+		apiVersion = admissionV1beta1
+	}
+
+	return metav1.TypeMeta{
+		Kind:       "AdmissionReview",
+		APIVersion: apiVersion,
+	}
+}
+
+// errRequestTooLarge request body exceeds the configured limit
+var errRequestTooLarge = errors.New("request body too large")
+
+// errMissingRequest the AdmissionReview carries no request
+var errMissingRequest = errors.New("admission review without request")
+
+// readJSON from request body, at most limit bytes of it
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) error {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			rejectedOversizedTotal.Inc()
+			return errRequestTooLarge
+		}
 		return fmt.Errorf("invalid JSON input")
 	}
 
@@ -67,18 +138,17 @@ type jsonErr struct {
 	Err string `json:"err"`
 }
 
-func writeNil(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview) {
+// writeNil responds the AdmissionReview allowing it unchanged, the warnings are shown to the client
+func writeNil(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview, warnings ...string) {
 	// create the AdmissionResponse
 	admissionResponse := &admissionv1.AdmissionResponse{
-		UID:     admissionReview.Request.UID,
-		Allowed: true,
+		UID:      admissionReview.Request.UID,
+		Allowed:  true,
+		Warnings: warnings,
 	}
 
 	respAdmissionReview := &admissionv1.AdmissionReview{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "AdmissionReview",
-			APIVersion: "admission.k8s.io/v1",
-		},
+		TypeMeta: responseTypeMeta(admissionReview),
 		Response: admissionResponse,
 	}
 
@@ -94,31 +164,46 @@ func PodReady(pod *corev1.Pod) bool {
 	return false
 }
 
-func (app *App) podExistAndReadyOnNodeCapacity(capacity string, pod *corev1.Pod) bool {
-	capacityNodes := make(map[string]struct{})
+// podReady judges readiness on the configured readiness containers when the pod has any of them,
+// so not ready sidecars do not hold back a ready main container, falls back to PodReady otherwise
+func (app *App) podReady(pod *corev1.Pod) bool {
+	return podReadyWith(app.readinessContainers, pod)
+}
+
+// podReadyWith judges readiness on the readiness containers, see podReady
+func podReadyWith(readinessContainers map[string]struct{}, pod *corev1.Pod) bool {
+	if len(readinessContainers) == 0 {
+		return PodReady(pod)
+	}
 
-	if nodes, err := app.ListNode(labels.Set{capacityKey: capacity}.AsSelector()); err != nil {
-		klog.Errorf("get %s nodes: %v", capacity, err)
-		return false
-	} else {
-		if len(nodes) > 0 {
-			for ni := range nodes {
-				capacityNodes[nodes[ni].Name] = struct{}{}
-			}
-		} else {
-			klog.Infof("no %s nodes", capacity)
+	found := false
+	for ci := range pod.Status.ContainerStatuses {
+		if _, ok := readinessContainers[pod.Status.ContainerStatuses[ci].Name]; !ok {
+			continue
+		}
+
+		found = true
+		if !pod.Status.ContainerStatuses[ci].Ready {
 			return false
 		}
 	}
 
-	pods, err := app.ListPod(pod.Namespace, labels.Set(pod.Labels).AsSelector())
-	if err != nil {
-		klog.Errorf("get pod: %v", err)
-		return false
+	if !found {
+		return PodReady(pod)
 	}
 
-	for pi := range pods {
-		if _, ok := capacityNodes[pods[pi].Spec.NodeName]; ok && PodReady(pods[pi]) {
+	return true
+}
+
+// nodeDraining reports whether the node is cordoned or tainted by a drain, e.g. by the cluster autoscaler
+// scaling it down, its pods are about to be evicted
+func (app *App) nodeDraining(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return true
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if _, ok := app.drainTaintKeys[taint.Key]; ok {
 			return true
 		}
 	}
@@ -126,78 +211,213 @@ func (app *App) podExistAndReadyOnNodeCapacity(capacity string, pod *corev1.Pod)
 	return false
 }
 
-func (app *App) podExistAndReadyOnNodeCapacityNum(capacity string, pod *corev1.Pod) int {
-	capacityNodes := make(map[string]struct{})
+// capacityNodeNames names of the nodes labeled with the capacity, without draining nodes when excludeDraining,
+// the nodes without the capacity label are included for the unlabeled node capacity
+func (app *App) capacityNodeNames(capacity string, excludeDraining bool) (map[string]struct{}, error) {
+	nodes, err := app.ListNode(app.capacitySelector(capacity))
+	if err != nil {
+		return nil, fmt.Errorf("get %s nodes: %v", capacity, err)
+	}
+
+	if capacity == app.unlabeledNodeCapacity {
+		unlabeled, err := app.ListNode(unlabeledNodeSelector())
+		if err != nil {
+			return nil, fmt.Errorf("get nodes without %s: %v", capacityKey, err)
+		}
+		nodes = append(nodes, unlabeled...)
+	}
+
+	capacityNodes := make(map[string]struct{}, len(nodes))
+	for ni := range nodes {
+		if excludeDraining && app.nodeDraining(nodes[ni]) {
+			continue
+		}
+		capacityNodes[nodes[ni].Name] = struct{}{}
+	}
+
+	if len(capacityNodes) == 0 {
+		klog.Infof("no %s nodes", capacity)
+	}
 
-	if nodes, err := app.ListNode(labels.Set{capacityKey: capacity}.AsSelector()); err != nil {
-		klog.Errorf("get %s nodes: %v", capacity, err)
-		return 0
-	} else {
-		if len(nodes) > 0 {
-			for ni := range nodes {
-				capacityNodes[nodes[ni].Name] = struct{}{}
+	return capacityNodes, nil
+}
+
+// siblingPods the pods of the pod's workload, matched by the pod's labels or, with countSiblingsByOwner,
+// by its controller so ReplicaSets sharing labels during a rollout are counted apart and the pods of
+// a StatefulSet, each with its own statefulset.kubernetes.io/pod-name label, are counted together,
+// terminating pods are going away and are not siblings
+func (app *App) siblingPods(pod *corev1.Pod) ([]*corev1.Pod, error) {
+	owner := metav1.GetControllerOf(pod)
+	byOwner := app.countSiblingsByOwner && owner != nil
+
+	// the labels of the pods of an owner differ, list the namespace and match by the owner
+	selector := labels.Set(pod.Labels).AsSelector()
+	if byOwner {
+		selector = labels.Everything()
+	}
+
+	pods, err := app.ListPod(pod.Namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := make([]*corev1.Pod, 0, len(pods))
+	for pi := range pods {
+		if pods[pi].DeletionTimestamp != nil {
+			continue
+		}
+
+		if byOwner {
+			if siblingOwner := metav1.GetControllerOf(pods[pi]); siblingOwner == nil || siblingOwner.UID != owner.UID {
+				continue
 			}
-		} else {
-			klog.Infof("no %s nodes", capacity)
-			return 0
 		}
+
+		siblings = append(siblings, pods[pi])
 	}
 
-	pods, err := app.ListPod(pod.Namespace, labels.Set(pod.Labels).AsSelector())
+	return siblings, nil
+}
+
+// podExistAndReadyOnNodeCapacityNum number of sibling pods running and ready on capacity nodes,
+// i.e. the pods actually serving from the capacity, an error when the nodes or pods can not be listed
+func (app *App) podExistAndReadyOnNodeCapacityNum(capacity string, pod *corev1.Pod) (int, error) {
+	// the incremental counter matches the exact label set instead of the label selector,
+	// the pods of a workload share their labels, and knows nothing of owners
+	if counter := app.informermanager.PodCounter; counter != nil && app.informermanager.IsSynced() && !app.countSiblingsByOwner {
+		num := 0
+		for _, value := range app.capacityValues(capacity) {
+			num += counter.ReadyOnCapacity(pod.Namespace, pod.Labels, value)
+		}
+		return num, nil
+	}
+
+	capacityNodes, err := app.capacityNodeNames(capacity, false)
 	if err != nil {
-		klog.Errorf("get pod: %v", err)
-		return 0
+		return 0, internalErrorf("count ready %s pods: %v", capacity, err)
+	}
+
+	pods, err := app.siblingPods(pod)
+	if err != nil {
+		return 0, internalErrorf("count ready %s pods: get pod: %v", capacity, err)
 	}
 
 	num := 0
 	for pi := range pods {
-		if _, ok := capacityNodes[pods[pi].Spec.NodeName]; ok && PodReady(pods[pi]) {
+		if _, ok := capacityNodes[pods[pi].Spec.NodeName]; ok && app.podReady(pods[pi]) {
 			num++
 		}
 	}
 
-	return num
+	return num, nil
 }
 
-func (app *App) podExistOnNodeCapacityNum(capacity string, pod *corev1.Pod) int {
-	pods, err := app.ListPod(pod.Namespace, labels.Set(pod.Labels).AsSelector())
+// podExistOnNodeCapacityNum number of sibling pods on capacity nodes regardless of readiness,
+// pods not scheduled yet count for the capacity their nodeSelector or required node affinity pins them to,
+// i.e. the pods that will serve from the capacity once started,
+// pods on cordoned or drain tainted nodes are about to go away and do not count with excludeCordonedFromFloor
+func (app *App) podExistOnNodeCapacityNum(capacity string, pod *corev1.Pod) (int, error) {
+	num, _, err := app.podExistOnNodeCapacityNumSince(capacity, pod, time.Time{})
+	return num, err
+}
+
+// podExistOnNodeCapacityNumSince podExistOnNodeCapacityNum and how many of them were created after since
+func (app *App) podExistOnNodeCapacityNumSince(capacity string, pod *corev1.Pod, since time.Time) (num, recent int, err error) {
+	capacityNodes, err := app.capacityNodeNames(capacity, app.excludeCordonedFromFloor)
 	if err != nil {
-		klog.Errorf("get pod: %v", err)
-		return 0
+		return 0, 0, internalErrorf("count %s pods: %v", capacity, err)
+	}
+
+	pods, err := app.siblingPods(pod)
+	if err != nil {
+		return 0, 0, internalErrorf("count %s pods: get pod: %v", capacity, err)
 	}
 
-	num := 0
 	for pi := range pods {
-		if pods[pi].Spec.NodeSelector[capacityKey] == capacity {
-			num++
+		if pods[pi].Spec.NodeName == "" {
+			if !app.podPinnedToCapacity(pods[pi].Spec, capacity) {
+				continue
+			}
+		} else if _, ok := capacityNodes[pods[pi].Spec.NodeName]; !ok {
+			continue
+		}
+
+		num++
+		if pods[pi].CreationTimestamp.Time.After(since) {
+			recent++
 		}
 	}
 
-	return num
+	return num, recent, nil
 }
 
+// nodeCapacity the capacity of the node by its capacity label, cached as the labels rarely change,
+// see capacityOfLabel
 func (app *App) nodeCapacity(nodeName string) string {
+	if capacity, ok := app.informermanager.NodeCache.Get(nodeName); ok {
+		return app.capacityOfLabel(capacity)
+	}
+
 	klog.Infof("nodeCapacity, nodeName: %s", nodeName)
 	node, err := app.GetNode(nodeName, metav1.GetOptions{})
 	if err != nil {
 		klog.Errorf("get node: %v", err)
 		return ""
 	}
-	return node.Labels[capacityKey]
+
+	capacity, ok := node.Labels[capacityKey]
+	if !ok {
+		klog.Warningf("node %s has no %s label, counted as %q", nodeName, capacityKey, app.unlabeledNodeCapacity)
+	}
+
+	app.informermanager.NodeCache.Set(nodeName, capacity)
+	return app.capacityOfLabel(capacity)
+}
+
+// unlabeledNodeSelector selects the nodes without the capacity label
+func unlabeledNodeSelector() labels.Selector {
+	requirement, err := labels.NewRequirement(capacityKey, selection.DoesNotExist, nil)
+	if err != nil {
+		// the capacity key is a valid label key
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// clientContext bounds a call to the API server by the client timeout, so a stuck API server
+// fails the call instead of the admission request hitting the webhook timeout
+func (app *App) clientContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(app.Ctx, app.clientTimeout)
+}
+
+// clientError turns a timed out call into an internal error, which goes through the failure policy
+func clientError(err error) error {
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		return internalErrorf("api server call timed out: %v", err)
+	}
+	return err
 }
 
 func (app *App) GetNamespace(name string, opts metav1.GetOptions) (*corev1.Namespace, error) {
 	if app.informermanager.IsSynced() {
 		return app.informermanager.NamespaceLister.Get(name)
 	}
-	return app.Client.CoreV1().Namespaces().Get(app.Ctx, name, opts)
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.CoreV1().Namespaces().Get(ctx, name, opts)
+	return obj, clientError(err)
 }
 
 func (app *App) GetPod(namespace, name string, opts metav1.GetOptions) (*corev1.Pod, error) {
 	if app.informermanager.IsSynced() {
 		return app.informermanager.PodLister.Pods(namespace).Get(name)
 	}
-	return app.Client.CoreV1().Pods(namespace).Get(app.Ctx, name, opts)
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.CoreV1().Pods(namespace).Get(ctx, name, opts)
+	return obj, clientError(err)
 }
 
 func (app *App) ListPod(namespace string, selector labels.Selector) ([]*corev1.Pod, error) {
@@ -207,9 +427,12 @@ func (app *App) ListPod(namespace string, selector labels.Selector) ([]*corev1.P
 
 	opts := metav1.ListOptions{LabelSelector: selector.String()}
 
-	pods, err := app.Client.CoreV1().Pods(namespace).List(app.Ctx, opts)
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	pods, err := app.Client.CoreV1().Pods(namespace).List(ctx, opts)
 	if err != nil {
-		return nil, err
+		return nil, clientError(err)
 	}
 
 	podList := make([]*corev1.Pod, len(pods.Items))
@@ -224,7 +447,11 @@ func (app *App) GetNode(name string, opts metav1.GetOptions) (*corev1.Node, erro
 	if app.informermanager.IsSynced() {
 		return app.informermanager.NodeLister.Get(name)
 	}
-	return app.Client.CoreV1().Nodes().Get(app.Ctx, name, opts)
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.CoreV1().Nodes().Get(ctx, name, opts)
+	return obj, clientError(err)
 }
 
 func (app *App) ListNode(selector labels.Selector) ([]*corev1.Node, error) {
@@ -234,9 +461,12 @@ func (app *App) ListNode(selector labels.Selector) ([]*corev1.Node, error) {
 
 	opts := metav1.ListOptions{LabelSelector: selector.String()}
 
-	nodes, err := app.Client.CoreV1().Nodes().List(app.Ctx, opts)
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	nodes, err := app.Client.CoreV1().Nodes().List(ctx, opts)
 	if err != nil {
-		return nil, err
+		return nil, clientError(err)
 	}
 
 	nodeList := make([]*corev1.Node, len(nodes.Items))
@@ -246,3 +476,68 @@ func (app *App) ListNode(selector labels.Selector) ([]*corev1.Node, error) {
 
 	return nodeList, nil
 }
+
+func (app *App) GetReplicaSet(namespace, name string, opts metav1.GetOptions) (*appsv1.ReplicaSet, error) {
+	if app.informermanager.IsSynced() {
+		return app.informermanager.ReplicaSetLister.ReplicaSets(namespace).Get(name)
+	}
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.AppsV1().ReplicaSets(namespace).Get(ctx, name, opts)
+	return obj, clientError(err)
+}
+
+func (app *App) GetStatefulSet(namespace, name string, opts metav1.GetOptions) (*appsv1.StatefulSet, error) {
+	if app.informermanager.IsSynced() {
+		return app.informermanager.StatefulSetLister.StatefulSets(namespace).Get(name)
+	}
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.AppsV1().StatefulSets(namespace).Get(ctx, name, opts)
+	return obj, clientError(err)
+}
+
+func (app *App) GetPersistentVolumeClaim(namespace, name string, opts metav1.GetOptions) (*corev1.PersistentVolumeClaim, error) {
+	if app.informermanager.IsSynced() {
+		return app.informermanager.PersistentVolumeClaimLister.PersistentVolumeClaims(namespace).Get(name)
+	}
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, opts)
+	return obj, clientError(err)
+}
+
+func (app *App) GetPersistentVolume(name string, opts metav1.GetOptions) (*corev1.PersistentVolume, error) {
+	if app.informermanager.IsSynced() {
+		return app.informermanager.PersistentVolumeLister.Get(name)
+	}
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	obj, err := app.Client.CoreV1().PersistentVolumes().Get(ctx, name, opts)
+	return obj, clientError(err)
+}
+
+func (app *App) ListPodDisruptionBudget(namespace string) ([]*policyv1.PodDisruptionBudget, error) {
+	if app.informermanager.IsSynced() {
+		return app.informermanager.PodDisruptionBudgetLister.PodDisruptionBudgets(namespace).List(labels.Everything())
+	}
+
+	ctx, cancel := app.clientContext()
+	defer cancel()
+
+	pdbs, err := app.Client.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, clientError(err)
+	}
+
+	pdbList := make([]*policyv1.PodDisruptionBudget, len(pdbs.Items))
+	for i := range pdbs.Items {
+		pdbList[i] = &pdbs.Items[i]
+	}
+
+	return pdbList, nil
+}
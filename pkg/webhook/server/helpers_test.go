@@ -0,0 +1,354 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// failingNodeList a clientset of the objects whose nodes can not be listed, the nodes can still be got
+func failingNodeList(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("nodes unavailable")
+	})
+	return client
+}
+
+// slowNodeList a clientset of the objects whose node lists hang for the delay and then fail like a
+// client-go call whose context ran out, the fake clientset does not watch the context itself
+func slowNodeList(delay time.Duration, objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(delay)
+		return true, nil, fmt.Errorf("list nodes: %w", context.DeadlineExceeded)
+	})
+	return client
+}
+
+func TestSlowClientFollowsFailurePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy  failurePolicy
+		allowed bool
+	}{
+		{policy: failurePolicyFail},
+		{policy: failurePolicyIgnore, allowed: true},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			app := newTestAppWithClient(t, slowNodeList(50*time.Millisecond, testNode("od-1", ondemandKey)))
+			app.clientTimeout = 10 * time.Millisecond
+			app.failurePolicy = tt.policy
+			setMinimums(app, 1, 0)
+
+			if _, err := app.ListNode(labels.Everything()); !isInternalError(err) {
+				t.Errorf("timed out list error %v, want an internal error", err)
+			}
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+			if resp.Allowed != tt.allowed || len(resp.Patch) != 0 {
+				t.Errorf("allowed %v patch %s, want allowed %v unchanged", resp.Allowed, resp.Patch, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCountErrorsFollowFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    failurePolicy
+		operation admissionv1.Operation
+		allowed   bool
+	}{
+		{name: "create fails closed", policy: failurePolicyFail, operation: admissionv1.Create},
+		{name: "create fails open", policy: failurePolicyIgnore, operation: admissionv1.Create, allowed: true},
+		{name: "delete fails closed", policy: failurePolicyFail, operation: admissionv1.Delete},
+		{name: "delete fails open", policy: failurePolicyIgnore, operation: admissionv1.Delete, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := testPod("web-1", "web", "od-1")
+			app := newTestAppWithClient(t, failingNodeList(testNode("od-1", ondemandKey), existing))
+			app.failurePolicy = tt.policy
+			app.envConfig.OnDemandMinPodNum = 1
+			app.setReloadableConfig(app.envConfig)
+
+			pod := testCreatedPod("web")
+			if tt.operation == admissionv1.Delete {
+				pod = existing
+			}
+
+			resp := mutate(t, app, podReview(t, tt.operation, pod))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if len(resp.Patch) != 0 {
+				t.Errorf("patch %s on a failed count, want none", resp.Patch)
+			}
+		})
+	}
+}
+
+func TestCountErrorIsInternal(t *testing.T) {
+	app := newTestAppWithClient(t, failingNodeList())
+
+	for name, count := range map[string]func() (int, error){
+		"ready": func() (int, error) { return app.podExistAndReadyOnNodeCapacityNum(ondemandKey, testCreatedPod("web")) },
+		"exist": func() (int, error) { return app.podExistOnNodeCapacityNum(ondemandKey, testCreatedPod("web")) },
+	} {
+		if _, err := count(); !isInternalError(err) {
+			t.Errorf("%s count error %v, want an internal error", name, err)
+		}
+	}
+}
+
+// sidecarNotReady the pod with a ready main container and a sidecar not ready, so the pod is not Ready
+func sidecarNotReady(pod *corev1.Pod) *corev1.Pod {
+	pod.Status.Conditions[0].Status = corev1.ConditionFalse
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "main", Ready: true},
+		{Name: "sidecar", Ready: false},
+	}
+	return pod
+}
+
+func TestReadinessContainers(t *testing.T) {
+	tests := []struct {
+		name       string
+		containers map[string]struct{}
+		ready      bool
+	}{
+		{name: "pod ready condition", ready: false},
+		{name: "main container", containers: map[string]struct{}{"main": {}}, ready: true},
+		{name: "sidecar", containers: map[string]struct{}{"sidecar": {}}, ready: false},
+		{name: "containers not in the pod", containers: map[string]struct{}{"proxy": {}}, ready: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podReadyWith(tt.containers, sidecarNotReady(testPod("web-1", "web", "od-1"))); got != tt.ready {
+				t.Errorf("ready %v, want %v", got, tt.ready)
+			}
+		})
+	}
+}
+
+// the delete guard counts a pod whose sidecar is not ready as serving when its main container is ready
+func TestReadinessContainersDeleteGuard(t *testing.T) {
+	for _, containers := range []map[string]struct{}{nil, {"main": {}}} {
+		deleted := testPod("web-2", "web", "od-1")
+		app := newTestApp(t, testNode("od-1", ondemandKey), sidecarNotReady(testPod("web-1", "web", "od-1")), deleted)
+		setMinimums(app, 1, 0)
+		app.readinessContainers = containers
+
+		resp := mutate(t, app, podReview(t, admissionv1.Delete, deleted))
+		if want := containers != nil; resp.Allowed != want {
+			t.Errorf("readiness containers %v: delete allowed %v, want %v", containers, resp.Allowed, want)
+		}
+	}
+}
+
+// notReady the pod with the Ready condition false, e.g. still starting
+func notReady(pod *corev1.Pod) *corev1.Pod {
+	pod.Status.Conditions[0].Status = corev1.ConditionFalse
+	return pod
+}
+
+func TestExistAndReadyCounts(t *testing.T) {
+	pending := testPod("web-3", "web", "")
+	pending.Spec.NodeSelector = map[string]string{capacityKey: ondemandKey}
+
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey),
+		testPod("web-1", "web", "od-1"), notReady(testPod("web-2", "web", "od-1")), pending, testPod("web-4", "web", "spot-1"))
+
+	exist, err := app.podExistOnNodeCapacityNum(ondemandKey, testCreatedPod("web"))
+	if err != nil {
+		t.Fatalf("count existing pods: %v", err)
+	}
+	if exist != 3 {
+		t.Errorf("%d on-demand pods exist, want 3: ready, starting and pending pinned", exist)
+	}
+
+	ready, err := app.podExistAndReadyOnNodeCapacityNum(ondemandKey, testCreatedPod("web"))
+	if err != nil {
+		t.Fatalf("count ready pods: %v", err)
+	}
+	if ready != 1 {
+		t.Errorf("%d on-demand pods ready, want 1", ready)
+	}
+}
+
+// creates count the pods starting on-demand, deletes only the ready ones
+func TestCreateCountsExistingDeleteCountsReady(t *testing.T) {
+	starting := notReady(testPod("web-1", "web", "od-1"))
+	ready := testPod("web-2", "web", "od-1")
+
+	app := newTestApp(t, testNode("od-1", ondemandKey), starting)
+	setMinimums(app, 1, 0)
+	resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if len(resp.Patch) != 0 {
+		t.Errorf("create pinned while a pod is starting on on-demand: %s", resp.Patch)
+	}
+
+	app = newTestApp(t, testNode("od-1", ondemandKey), starting, ready)
+	setMinimums(app, 1, 0)
+	if resp := mutate(t, app, podReview(t, admissionv1.Delete, ready)); resp.Allowed {
+		t.Errorf("delete of the only ready on-demand pod allowed while the other is starting")
+	}
+}
+
+// oversizedReview a create of a pod whose annotation makes the review larger than size bytes
+func oversizedReview(t *testing.T, size int) *admissionv1.AdmissionReview {
+	t.Helper()
+
+	pod := testCreatedPod("web")
+	pod.Annotations = map[string]string{"padding": strings.Repeat("x", size)}
+	return podReview(t, admissionv1.Create, pod)
+}
+
+func TestOversizedRequestCounted(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	app.maxRequestBytes = 4096
+
+	before := counterValue(t, rejectedOversizedTotal)
+
+	code, resp := postReview(t, app.HandleMutate, oversizedReview(t, 8192))
+	if code != http.StatusRequestEntityTooLarge || resp != nil {
+		t.Errorf("oversized request answered %d, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+
+	if got := counterValue(t, rejectedOversizedTotal) - before; got != 1 {
+		t.Errorf("mix_scheduler_rejected_oversized_total increased by %v, want 1", got)
+	}
+}
+
+func TestMissingRequestIsBadRequest(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+
+	bodies := map[string]string{
+		"no request":   `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`,
+		"null request": `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":null}`,
+		"invalid JSON": `{"apiVersion":`,
+	}
+	handlers := map[string]http.HandlerFunc{"mutate": app.HandleMutate, "validate": app.HandleValidate}
+
+	for handlerName, handler := range handlers {
+		for name, body := range bodies {
+			t.Run(handlerName+" "+name, func(t *testing.T) {
+				code, resp := postBody(t, handler, []byte(body))
+				if code != http.StatusBadRequest || resp != nil {
+					t.Errorf("answered %d, want %d without an AdmissionReview", code, http.StatusBadRequest)
+				}
+			})
+		}
+	}
+}
+
+func TestErrorResponseShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  failurePolicy
+		err     error
+		allowed bool
+		code    int32
+	}{
+		{name: "denial", policy: failurePolicyIgnore, err: errors.New("cannot delete"), code: http.StatusBadRequest},
+		{name: "saturated", policy: failurePolicyFail, err: errAdmissionSaturated, code: http.StatusTooManyRequests},
+		{name: "internal error fails closed", policy: failurePolicyFail, err: internalErrorf("list pods"), code: http.StatusBadRequest},
+		{name: "internal error fails open", policy: failurePolicyIgnore, err: internalErrorf("list pods"), allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			app.failurePolicy = tt.policy
+			review := podReview(t, admissionv1.Create, testCreatedPod("web"))
+
+			rec := httptest.NewRecorder()
+			app.HandleError(rec, httptest.NewRequest(http.MethodPost, defaultMutatePath, nil), review, tt.err)
+
+			// the API server expects every admission answer with status 200
+			if rec.Code != http.StatusOK {
+				t.Fatalf("answered %d, want 200", rec.Code)
+			}
+
+			resp := &admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil || resp.Response == nil {
+				t.Fatalf("answer %s is not an AdmissionReview: %v", rec.Body, err)
+			}
+			if resp.Kind != "AdmissionReview" || resp.APIVersion != admissionv1.SchemeGroupVersion.String() {
+				t.Errorf("answered %s %s, want AdmissionReview %s", resp.APIVersion, resp.Kind, admissionv1.SchemeGroupVersion)
+			}
+			if resp.Response.UID != review.Request.UID {
+				t.Errorf("response UID %q, want the request's %q", resp.Response.UID, review.Request.UID)
+			}
+			if resp.Response.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v", resp.Response.Allowed, tt.allowed)
+			}
+
+			if tt.allowed {
+				if resp.Response.Result != nil && resp.Response.Result.Status == metav1.StatusFailure {
+					t.Errorf("allowed answer carries a failure %v", resp.Response.Result)
+				}
+				return
+			}
+			result := resp.Response.Result
+			if result == nil || result.Status != metav1.StatusFailure || result.Code != tt.code || result.Message != tt.err.Error() {
+				t.Errorf("result %+v, want a failure of code %d with message %q", result, tt.code, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestAdmissionReviewVersionRoundTrip(t *testing.T) {
+	reviews := map[string]func(t *testing.T) *admissionv1.AdmissionReview{
+		"patched create": func(t *testing.T) *admissionv1.AdmissionReview {
+			return podReview(t, admissionv1.Create, testCreatedPod("web"))
+		},
+		"allowed create": func(t *testing.T) *admissionv1.AdmissionReview {
+			pod := testCreatedPod("web")
+			pod.Labels[mixSchedulerKey] = "false"
+			return podReview(t, admissionv1.Create, pod)
+		},
+		"denied delete": func(t *testing.T) *admissionv1.AdmissionReview {
+			return podReview(t, admissionv1.Delete, testPod("web-1", "web", "od-1"))
+		},
+	}
+
+	for _, apiVersion := range []string{admissionv1.SchemeGroupVersion.String(), admissionV1beta1} {
+		for name, review := range reviews {
+			t.Run(apiVersion+" "+name, func(t *testing.T) {
+				app := newTestApp(t, testNode("od-1", ondemandKey), testPod("web-1", "web", "od-1"))
+				setMinimums(app, 2, 0)
+
+				req := review(t)
+				req.APIVersion = apiVersion
+
+				code, resp := postReview(t, app.HandleMutate, req)
+				if code != http.StatusOK || resp == nil {
+					t.Fatalf("answered %d without an AdmissionReview", code)
+				}
+				if resp.APIVersion != apiVersion || resp.Kind != "AdmissionReview" {
+					t.Errorf("answered %s %s, want AdmissionReview %s", resp.APIVersion, resp.Kind, apiVersion)
+				}
+				if resp.Response.UID != req.Request.UID {
+					t.Errorf("response UID %q, want the request's %q", resp.Response.UID, req.Request.UID)
+				}
+			})
+		}
+	}
+}
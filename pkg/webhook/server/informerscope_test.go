@@ -0,0 +1,63 @@
+package server
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestPodFieldSelector(t *testing.T) {
+	notControllerNamespace := map[string]struct{}{"kube-system": {}, "mix-scheduler-system": {}}
+
+	tests := []struct {
+		name              string
+		scope             string
+		namespaceSelector labels.Selector
+		configMapName     string
+		// the field selector, empty for the whole cluster
+		want    string
+		wantErr bool
+	}{
+		{name: "unscoped"},
+		{name: "scoped", scope: "true", want: "metadata.namespace!=kube-system,metadata.namespace!=mix-scheduler-system"},
+		{name: "scoped with a configmap", scope: "true", configMapName: "mix-scheduler-config",
+			want: "metadata.namespace!=kube-system,metadata.namespace!=mix-scheduler-system"},
+		{name: "scoped with a namespace selector", scope: "true", namespaceSelector: labels.SelectorFromSet(labels.Set{"mix-scheduler": "enabled"}), wantErr: true},
+		{name: "namespace selector unscoped", namespaceSelector: labels.SelectorFromSet(labels.Set{"mix-scheduler": "enabled"})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INFORMER_SCOPE_PODS", tt.scope)
+
+			selector, err := podFieldSelectorFromEnv(notControllerNamespace, tt.namespaceSelector, tt.configMapName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+
+			var got string
+			if selector != nil {
+				got = selector.String()
+			}
+			if got != tt.want {
+				t.Errorf("field selector %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPodFieldSelectorExcludesNotControllerNamespace(t *testing.T) {
+	t.Setenv("INFORMER_SCOPE_PODS", "true")
+
+	selector, err := podFieldSelectorFromEnv(map[string]struct{}{"kube-system": {}}, nil, "")
+	if err != nil {
+		t.Fatalf("scope pods: %v", err)
+	}
+
+	for namespace, cached := range map[string]bool{"kube-system": false, "default": true} {
+		if got := selector.Matches(fields.Set{"metadata.namespace": namespace}); got != cached {
+			t.Errorf("pods of %s cached %v, want %v", namespace, got, cached)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog/v2"
+)
+
+func TestLatencyBudgetFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  string
+		percent string
+		want    time.Duration
+		warn    int
+		wantErr bool
+	}{
+		{name: "defaults", want: 10 * time.Second, warn: 80},
+		{name: "set", budget: "5s", percent: "50", want: 5 * time.Second, warn: 50},
+		{name: "percent bounds", budget: "1s", percent: "100", want: time.Second, warn: 100},
+		{name: "zero budget", budget: "0s", wantErr: true},
+		{name: "negative budget", budget: "-1s", wantErr: true},
+		{name: "invalid budget", budget: "soon", wantErr: true},
+		{name: "negative percent", percent: "-1", wantErr: true},
+		{name: "percent above 100", percent: "101", wantErr: true},
+		{name: "invalid percent", percent: "most", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LATENCY_BUDGET", tt.budget)
+			t.Setenv("LATENCY_BUDGET_WARN_PERCENT", tt.percent)
+
+			budget, warn, err := latencyBudgetFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("budget %v warn %d, want an error", budget, warn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("latency budget: %v", err)
+			}
+			if budget != tt.want || warn != tt.warn {
+				t.Errorf("budget %v warn %d, want %v and %d", budget, warn, tt.want, tt.warn)
+			}
+		})
+	}
+}
+
+func TestLatencyBudgetRecorded(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	setMinimums(app, 1, 0)
+
+	before := metricOf(t, admissionBudgetUsed).GetHistogram().GetSampleCount()
+	mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+
+	if got := metricOf(t, admissionBudgetUsed).GetHistogram().GetSampleCount() - before; got != 1 {
+		t.Errorf("mix_scheduler_admission_budget_used_ratio observed %d times, want 1", got)
+	}
+}
+
+// syncBuffer a buffer klog can write to from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs sends the klog output to the returned buffer for the rest of the test
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+
+	state := klog.CaptureState()
+	t.Cleanup(state.Restore)
+
+	buf := &syncBuffer{}
+	klog.LogToStderr(false)
+	klog.SetOutput(buf)
+	return buf
+}
+
+func TestSlowRequestWarning(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		delay time.Duration
+		warns bool
+	}{
+		{name: "slow node list", delay: 50 * time.Millisecond, warns: true},
+		{name: "fast request"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(testNode("od-1", ondemandKey))
+			client.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+				time.Sleep(tt.delay)
+				return false, nil, nil
+			})
+			app := newTestAppWithClient(t, client)
+			setMinimums(app, 1, 0)
+			app.slowRequestThreshold = 20 * time.Millisecond
+
+			logs := captureLogs(t)
+			mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+			klog.Flush()
+
+			warned := strings.Contains(logs.String(), "above the 20ms threshold, slowest phase placement")
+			if warned != tt.warns {
+				t.Errorf("slow request warning %v, want %v: %s", warned, tt.warns, logs)
+			}
+		})
+	}
+}
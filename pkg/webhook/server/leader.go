@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultLeaseName      = "mix-scheduler-admission-webhook"
+	defaultLeaseNamespace = "mix-scheduler-system"
+
+	// set on the admission requests a follower forwards, the receiver answers them itself
+	// even when it lost the Lease meanwhile, so a request is forwarded at most once
+	leaderForwardedHeader = "X-Mix-Scheduler-Forwarded"
+)
+
+// leading reports whether the replica makes the counting dependent decisions, always without leader election.
+// The replicas count on their own informer cache, the followers forward the admission requests to the leader
+func (app *App) leading() bool {
+	return !app.leaderElection || app.isLeader.Load()
+}
+
+// leaderIdentity the Lease holder identity of the replica, the hostname and the address it serves on
+func leaderIdentity(hostname, address string) string {
+	return hostname + "_" + address
+}
+
+// leaderAddressOf the address of the Lease holder identity, empty when it has none
+func leaderAddressOf(identity string) string {
+	_, address, ok := strings.Cut(identity, "_")
+	if !ok {
+		return ""
+	}
+	return address
+}
+
+// leaderAddress the address of the current leader, empty until one is observed
+func (app *App) leaderAddress() string {
+	if address := app.leader.Load(); address != nil {
+		return *address
+	}
+	return ""
+}
+
+// newLeaderClient the client forwarding to the leader, it verifies the leader's certificate for the service
+// against the CA bundle the API server trusts, read on each handshake so a rotated CA is picked up
+func newLeaderClient(caPath, serverName string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				// the leader is dialed by its pod IP, its certificate is verified for the service name below
+				InsecureSkipVerify: true,
+				VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+					return verifyLeaderCertificate(caPath, serverName, rawCerts)
+				},
+			},
+		},
+	}
+}
+
+// verifyLeaderCertificate verifies the certificate chain the leader presented for the service name
+func verifyLeaderCertificate(caPath, serverName string, rawCerts [][]byte) error {
+	caBundle, err := os.ReadFile(caPath)
+	if err != nil {
+		return fmt.Errorf("read ca bundle: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		return fmt.Errorf("no certificate in ca bundle %s", caPath)
+	}
+
+	if len(rawCerts) == 0 {
+		return errors.New("leader presented no certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parse leader certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// forwardToLeader hands the admission requests a follower receives to the leader, so only the leader's cache
+// decides. The answer of the leader is passed on as is, a failed forward is answered through FAILURE_POLICY
+func (app *App) forwardToLeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.leading() || r.Header.Get(leaderForwardedHeader) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// one byte over the limit, so readJSON still rejects an oversized body
+		body, err := io.ReadAll(io.LimitReader(r.Body, app.maxRequestBytes+1))
+		if err != nil {
+			jsonError(w, fmt.Sprintf("read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// the malformed requests are rejected the same everywhere, without bothering the leader
+		admissionReview := &admissionv1.AdmissionReview{}
+		if int64(len(body)) > app.maxRequestBytes || json.Unmarshal(body, admissionReview) != nil || admissionReview.Request == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := app.forward(w, r, body); err != nil {
+			klog.Errorf("forward admission request %s to the leader: %v", admissionReview.Request.UID, err)
+			app.HandleError(w, r, admissionReview, internalErrorf("forward to the leader: %v", err))
+		}
+	})
+}
+
+// forward posts the body to the same path of the leader and copies its answer, nothing is written on an error
+func (app *App) forward(w http.ResponseWriter, r *http.Request, body []byte) error {
+	address := app.leaderAddress()
+	if address == "" {
+		return errors.New("no leader elected")
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, app.leaderScheme+"://"+address+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	req.Header.Set(leaderForwardedHeader, "true")
+
+	resp, err := app.leaderClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read answer of %s: %v", address, err)
+	}
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	writeBytes(w, answer)
+	return nil
+}
+
+// runLeaderElection campaigns for the Lease until ctx is done, the Lease is released on the way out,
+// with the address the followers forward to in the identity
+func (app *App) runLeaderElection(ctx context.Context, leaseName, leaseNamespace, address string) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	identity := leaderIdentity(hostname, address)
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaseName,
+			Namespace: leaseNamespace,
+		},
+		Client: app.Client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				klog.Infof("%s started leading", identity)
+				app.isLeader.Store(true)
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("%s stopped leading", identity)
+				app.isLeader.Store(false)
+			},
+			OnNewLeader: func(leader string) {
+				klog.Infof("leader is %s", leader)
+				address := leaderAddressOf(leader)
+				app.leader.Store(&address)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// a lost Lease returns Run, campaign again until shutdown
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+
+	return nil
+}
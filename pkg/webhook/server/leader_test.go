@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// leaderServer serves the leader's router over TLS with a certificate for the service name,
+// returns its address and the CA bundle the followers verify it against
+func leaderServer(t *testing.T, leader *App, serviceName string) (address, caPath string) {
+	t.Helper()
+
+	certPath, keyPath := writeTestKeyPair(t, t.TempDir(), serviceName, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("load keypair: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(BuildRouter(leader))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	// the self-signed certificate is its own CA
+	return srv.Listener.Addr().String(), certPath
+}
+
+// follower a replica that lost the election, it can not list nodes so any local decision fails
+func follower(t *testing.T, address string, client *http.Client) *App {
+	t.Helper()
+
+	app := newTestAppWithClient(t, failingNodeList(testNode("od-1", ondemandKey)))
+	setMinimums(app, 1, 0)
+	app.failurePolicy = failurePolicyFail
+	app.leaderElection = true
+	app.isLeader.Store(false)
+	app.leader.Store(&address)
+	app.leaderScheme = "https"
+	app.leaderClient = client
+
+	return app
+}
+
+func TestFollowerForwardsToLeader(t *testing.T) {
+	const serviceName = "webhook-server.mix-scheduler-system.svc"
+
+	existing := testPod("web-1", "web", "od-1")
+	leader := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), existing)
+	setMinimums(leader, 1, 0)
+	leader.evictionGuardPolicy = evictionGuardFloor
+	address, caPath := leaderServer(t, leader, serviceName)
+
+	app := follower(t, address, newLeaderClient(caPath, serviceName, time.Second))
+	if app.leading() {
+		t.Fatalf("follower leading")
+	}
+	router := BuildRouter(app)
+
+	// another workload without on-demand pods, the leader pins its first pod
+	code, created := postReview(t, router.ServeHTTP, podReview(t, admissionv1.Create, testCreatedPod("api")))
+	if code != http.StatusOK || created == nil || !created.Response.Allowed || len(created.Response.Patch) == 0 {
+		t.Fatalf("forwarded create answered %d %+v, want the leader's placement", code, created)
+	}
+
+	code, deleted := postReview(t, router.ServeHTTP, podReview(t, admissionv1.Delete, existing))
+	if code != http.StatusOK || deleted == nil || deleted.Response.Allowed {
+		t.Errorf("forwarded delete of the last on-demand pod answered %d %+v, want the leader's denial", code, deleted)
+	}
+
+	code, evicted := postReview(t, router.ServeHTTP, evictionReview(t, existing))
+	if code != http.StatusOK || evicted == nil || evicted.Response.Allowed {
+		t.Errorf("forwarded eviction of the last on-demand pod answered %d %+v, want the leader's denial", code, evicted)
+	}
+}
+
+func TestFailedForwardFollowsFailurePolicy(t *testing.T) {
+	const serviceName = "webhook-server.mix-scheduler-system.svc"
+
+	leader := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	setMinimums(leader, 1, 0)
+	address, caPath := leaderServer(t, leader, serviceName)
+
+	tests := []struct {
+		name    string
+		address string
+		client  *http.Client
+	}{
+		{name: "no leader elected", client: newLeaderClient(caPath, serviceName, time.Second)},
+		{name: "certificate for another service", address: address, client: newLeaderClient(caPath, "other.mix-scheduler-system.svc", time.Second)},
+		{name: "leader unreachable", address: "127.0.0.1:1", client: newLeaderClient(caPath, serviceName, time.Second)},
+	}
+	for _, tt := range tests {
+		for _, policy := range []failurePolicy{failurePolicyFail, failurePolicyIgnore} {
+			t.Run(tt.name+"/"+string(policy), func(t *testing.T) {
+				app := follower(t, tt.address, tt.client)
+				app.failurePolicy = policy
+
+				code, resp := postReview(t, BuildRouter(app).ServeHTTP, podReview(t, admissionv1.Create, testCreatedPod("web")))
+				if code != http.StatusOK || resp == nil {
+					t.Fatalf("answered %d without an AdmissionReview", code)
+				}
+				if allowed := policy == failurePolicyIgnore; resp.Response.Allowed != allowed || len(resp.Response.Patch) != 0 {
+					t.Errorf("allowed %v patch %s, want allowed %v unchanged", resp.Response.Allowed, resp.Response.Patch, allowed)
+				}
+			})
+		}
+	}
+}
+
+// a forwarded request is answered where it lands, even by a replica that lost the Lease meanwhile
+func TestForwardedRequestAnsweredLocally(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	setMinimums(app, 1, 0)
+	app.leaderElection = true
+	app.isLeader.Store(false)
+
+	body, err := json.Marshal(podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if err != nil {
+		t.Fatalf("marshal review: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, defaultMutatePath, bytes.NewReader(body))
+	req.Header.Set(leaderForwardedHeader, "true")
+	rec := httptest.NewRecorder()
+	BuildRouter(app).ServeHTTP(rec, req)
+
+	resp := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil || resp.Response == nil {
+		t.Fatalf("answered %d %s, want an AdmissionReview", rec.Code, rec.Body.String())
+	}
+	if !resp.Response.Allowed || len(resp.Response.Patch) == 0 {
+		t.Errorf("allowed %v patch %s, want the pod placed locally", resp.Response.Allowed, resp.Response.Patch)
+	}
+}
+
+func TestLeaderAddressOf(t *testing.T) {
+	for _, tt := range []struct {
+		identity string
+		address  string
+	}{
+		{identity: leaderIdentity("webhook-7d9f-x2k", "10.0.0.7:8443"), address: "10.0.0.7:8443"},
+		{identity: leaderIdentity("webhook-7d9f-x2k", "[fd00::7]:8443"), address: "[fd00::7]:8443"},
+		{identity: "webhook-7d9f-x2k", address: ""},
+	} {
+		if got := leaderAddressOf(tt.identity); got != tt.address {
+			t.Errorf("leaderAddressOf(%q) = %q, want %q", tt.identity, got, tt.address)
+		}
+	}
+}
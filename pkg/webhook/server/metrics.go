@@ -0,0 +1,228 @@
+package server
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// admission decisions
+	decisionMutated = "mutated"
+	decisionAllowed = "allowed"
+	decisionDenied  = "denied"
+	decisionSkipped = "skipped"
+
+	// placement label when the webhook leaves the pod to the scheduler
+	unpinnedCapacity = "unpinned"
+
+	unknownWorkload = "unknown"
+	otherWorkload   = "other"
+
+	// distinct workloads labeled on the metrics without an allowlist, the later ones are reported as "other"
+	defaultMetricsWorkloadLimit = 100
+)
+
+var (
+	placementsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mix_scheduler_placements_total",
+		Help: "Number of pod placement decisions by owning workload and capacity.",
+	}, []string{"namespace", "workload", "capacity"})
+
+	maxRequestBytesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mix_scheduler_max_request_bytes",
+		Help: "Configured max AdmissionReview request body size in bytes.",
+	})
+
+	admissionTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mix_scheduler_admission_total",
+		Help: "Number of admission requests by operation, decision and namespace.",
+	}, []string{"operation", "decision", "namespace"})
+
+	admissionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mix_scheduler_admission_duration_seconds",
+		Help:    "Latency of admission request handling in seconds.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	admissionBudgetUsed = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mix_scheduler_admission_budget_used_ratio",
+		Help:    "Fraction of the latency budget used by admission request handling.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 1},
+	})
+
+	ownerResolutionFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mix_scheduler_owner_resolution_failures_total",
+		Help: "Number of pods whose owning controller could not be resolved.",
+	})
+
+	namespacelessPodsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mix_scheduler_namespaceless_pods_total",
+		Help: "Number of pods skipped for having no namespace set.",
+	})
+
+	rejectedOversizedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mix_scheduler_rejected_oversized_total",
+		Help: "Number of AdmissionReview requests rejected for exceeding the max body size.",
+	})
+
+	admissionsSaturatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mix_scheduler_admissions_saturated_total",
+		Help: "Number of admission requests not processed for the concurrency limit.",
+	})
+
+	unknownKindsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mix_scheduler_unknown_kinds_total",
+		Help: "Number of admission requests of a kind or operation the webhook does not handle, allowed unchanged.",
+	}, []string{"group", "kind"})
+
+	handlerPanicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mix_scheduler_handler_panics_total",
+		Help: "Number of admission requests whose handler panicked, answered through the failure policy.",
+	}, []string{"path"})
+
+	configReloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mix_scheduler_config_reloads_total",
+		Help: "Number of CONFIG_CONFIGMAP reloads by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(placementsTotal, admissionTotal, admissionDuration, admissionBudgetUsed, ownerResolutionFailuresTotal, namespacelessPodsTotal, maxRequestBytesGauge, rejectedOversizedTotal,
+		admissionsSaturatedTotal, configReloadsTotal, unknownKindsTotal, handlerPanicsTotal)
+}
+
+// workloadLabel the owning workload as kind/name, bounded by the workload allowlist or limit,
+// "unknown" when the owner can not be resolved
+func (app *App) workloadLabel(pod *corev1.Pod) string {
+	owner, err := app.workloadOwner(pod)
+	if err != nil {
+		// counted like any other resolution failure, the placement is already decided so either policy
+		// leaves the label to the unknown workload
+		app.ownerResolutionFailed(pod, err)
+		return unknownWorkload
+	}
+
+	if owner == nil {
+		return unknownWorkload
+	}
+
+	return app.boundWorkload(owner.Kind + "/" + owner.Name)
+}
+
+// boundWorkload the workload label value, "other" when it is not in the allowlist or,
+// without an allowlist, beyond the first limit workloads seen
+func (app *App) boundWorkload(workload string) string {
+	if len(app.metricsWorkloadAllowlist) > 0 {
+		if _, ok := app.metricsWorkloadAllowlist[workload]; !ok {
+			return otherWorkload
+		}
+		return workload
+	}
+
+	return app.metricsWorkloads.bound(workload)
+}
+
+// workloadLabelSet the workloads labeled on the metrics, at most limit of them
+type workloadLabelSet struct {
+	limit int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newWorkloadLabelSet(limit int) *workloadLabelSet {
+	return &workloadLabelSet{
+		limit: limit,
+		seen:  make(map[string]struct{}),
+	}
+}
+
+// bound the workload when it was seen or there is room for it, "other" otherwise
+func (s *workloadLabelSet) bound(workload string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seen[workload]; ok {
+		return workload
+	}
+
+	if len(s.seen) >= s.limit {
+		return otherWorkload
+	}
+
+	s.seen[workload] = struct{}{}
+	return workload
+}
+
+// recordPlacement count a placement decision for the pod and emit it to the cloudevents sink
+func (app *App) recordPlacement(pod *corev1.Pod, capacity string) {
+	workload := app.workloadLabel(pod)
+	placementsTotal.WithLabelValues(pod.Namespace, workload, capacity).Inc()
+
+	if capacity == ondemandKey {
+		app.recordEvent(pod, corev1.EventTypeNormal, eventReasonPinnedOnDemand, "pod placed on %s nodes to keep the %s minimum", capacity, capacity)
+	}
+
+	if app.cloudEventSink != nil {
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+
+		app.cloudEventSink.Emit(placementDecision{
+			Namespace: pod.Namespace,
+			Pod:       name,
+			Workload:  workload,
+			Capacity:  capacity,
+		})
+	}
+}
+
+// recordAdmission count the decision of the admission request
+func recordAdmission(admissionReview *admissionv1.AdmissionReview, decision string) {
+	operation, namespace := "unknown", ""
+	if admissionReview.Request != nil {
+		operation = strings.ToLower(string(admissionReview.Request.Operation))
+		namespace = admissionReview.Request.Namespace
+	}
+
+	admissionTotal.WithLabelValues(operation, decision, namespace).Inc()
+}
+
+// observeLatency record the handling latency of the admission request and its share of the latency budget,
+// warn when the request used more than latencyBudgetWarnPercent of it
+func (app *App) observeLatency(timer *requestTimer, admissionReview *admissionv1.AdmissionReview) {
+	elapsed := timer.finish()
+	admissionDuration.Observe(elapsed.Seconds())
+
+	if app.slowRequestThreshold > 0 && elapsed > app.slowRequestThreshold {
+		uid, kind, name := "", "", ""
+		if admissionReview.Request != nil {
+			uid, kind = string(admissionReview.Request.UID), admissionReview.Request.Kind.Kind
+			name = admissionReview.Request.Namespace + "/" + admissionReview.Request.Name
+		}
+		slowest := timer.slowest()
+		klog.Warningf("admission request %s %s %s took %v, above the %v threshold, slowest phase %s took %v: %s",
+			uid, kind, name, elapsed, app.slowRequestThreshold, slowest.name, slowest.duration, timer)
+	}
+
+	if app.latencyBudget <= 0 {
+		return
+	}
+
+	used := elapsed.Seconds() / app.latencyBudget.Seconds()
+	admissionBudgetUsed.Observe(used)
+
+	if used*100 > float64(app.latencyBudgetWarnPercent) {
+		uid := ""
+		if admissionReview.Request != nil {
+			uid = string(admissionReview.Request.UID)
+		}
+		klog.Warningf("admission request %s took %v, %.0f%% of the %v latency budget", uid, elapsed, used*100, app.latencyBudget)
+	}
+}
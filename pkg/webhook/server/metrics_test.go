@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// metricOf the current value of the metric
+func metricOf(t *testing.T, metric prometheus.Metric) *dto.Metric {
+	t.Helper()
+
+	out := &dto.Metric{}
+	if err := metric.Write(out); err != nil {
+		t.Fatalf("write metric: %v", err)
+	}
+	return out
+}
+
+// counterValue the current value of the counter
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+
+	return metricOf(t, counter).GetCounter().GetValue()
+}
+
+func TestWorkloadLabelBounded(t *testing.T) {
+	app := newTestApp(t)
+	app.metricsWorkloads = newWorkloadLabelSet(2)
+
+	label := func(name string) string {
+		return app.workloadLabel(ownedBy(testCreatedPod(name), "StatefulSet", name))
+	}
+
+	for i, want := range []string{"StatefulSet/a", "StatefulSet/b", otherWorkload} {
+		if got := label(string(rune('a' + i))); got != want {
+			t.Errorf("workload %d labeled %q, want %q", i, got, want)
+		}
+	}
+
+	// a workload seen keeps its label
+	if got := label("a"); got != "StatefulSet/a" {
+		t.Errorf("seen workload labeled %q, want StatefulSet/a", got)
+	}
+}
+
+func TestWorkloadLabelAllowlist(t *testing.T) {
+	app := newTestApp(t)
+	app.metricsWorkloadAllowlist = map[string]struct{}{"StatefulSet/db": {}}
+	app.metricsWorkloads = newWorkloadLabelSet(0)
+
+	if got := app.workloadLabel(ownedBy(testCreatedPod("db"), "StatefulSet", "db")); got != "StatefulSet/db" {
+		t.Errorf("allowed workload labeled %q", got)
+	}
+	if got := app.workloadLabel(ownedBy(testCreatedPod("web"), "StatefulSet", "web")); got != otherWorkload {
+		t.Errorf("workload not allowed labeled %q, want %q", got, otherWorkload)
+	}
+}
+
+// the raw labels of pods without a resolvable owner never end up in the label values
+func TestWorkloadLabelUnresolvedOwner(t *testing.T) {
+	app := newTestApp(t)
+	before := counterValue(t, ownerResolutionFailuresTotal)
+
+	for i := 0; i < 3; i++ {
+		pod := ownedBy(testCreatedPod(fmt.Sprintf("web-%d", i)), "ReplicaSet", fmt.Sprintf("missing-%d", i))
+		if got := app.workloadLabel(pod); got != unknownWorkload {
+			t.Errorf("pod of a missing ReplicaSet labeled %q, want %q", got, unknownWorkload)
+		}
+	}
+	if got := counterValue(t, ownerResolutionFailuresTotal) - before; got != 3 {
+		t.Errorf("mix_scheduler_owner_resolution_failures_total increased by %v, want 3", got)
+	}
+
+	if got := app.workloadLabel(&corev1.Pod{}); got != unknownWorkload {
+		t.Errorf("pod without owner labeled %q, want %q", got, unknownWorkload)
+	}
+}
+
+func TestPlacementWorkloadLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		pod      *corev1.Pod
+		workload string
+	}{
+		{
+			name:     "deployment",
+			objects:  []runtime.Object{testReplicaSet("web-5d4f8c", "web", 2)},
+			pod:      ownedBy(testCreatedPod("web"), "ReplicaSet", "web-5d4f8c"),
+			workload: "Deployment/web",
+		},
+		{
+			name:     "statefulset",
+			pod:      ownedBy(testCreatedPod("db"), "StatefulSet", "db"),
+			workload: "StatefulSet/db",
+		},
+		{
+			name:     "bare pod",
+			pod:      testCreatedPod("job"),
+			workload: unknownWorkload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append([]runtime.Object{testNode("od-1", ondemandKey)}, tt.objects...)...)
+			setMinimums(app, 1, 0)
+
+			placements := placementsTotal.WithLabelValues(testNamespace, tt.workload, ondemandKey)
+			before := counterValue(t, placements)
+
+			mutate(t, app, podReview(t, admissionv1.Create, tt.pod))
+
+			if got := counterValue(t, placements) - before; got != 1 {
+				t.Errorf("%s on-demand placements of %s counted %v, want 1", testNamespace, tt.workload, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// namespace annotations overriding OnDemandMinPodNum and SpotMinPodNum
+	ondemandMinAnnotation = "mix-scheduler/on-demand-min"
+	spotMinAnnotation     = "mix-scheduler/spot-min"
+)
+
+// minPodNums the effective on-demand and spot minimums of the namespace,
+// the namespace annotations override the global defaults
+func (app *App) minPodNums(namespace string) (ondemandMin, spotMin int) {
+	config := app.reloadableConfig()
+	ondemandMin, spotMin = config.OnDemandMinPodNum, config.SpotMinPodNum
+
+	ns, err := app.GetNamespace(namespace, metav1.GetOptions{})
+	if err != nil {
+		klog.V(4).Infof("get namespace %s: %v, use the default minimums", namespace, err)
+		return ondemandMin, spotMin
+	}
+
+	if val, ok := ns.Annotations[ondemandMinAnnotation]; ok {
+		if num, err := strconv.Atoi(val); err != nil || num < 0 {
+			klog.Warningf("namespace %s invalid %s annotation %q, use the default", namespace, ondemandMinAnnotation, val)
+		} else {
+			ondemandMin = num
+		}
+	}
+
+	if val, ok := ns.Annotations[spotMinAnnotation]; ok {
+		if num, err := strconv.Atoi(val); err != nil || num < 0 {
+			klog.Warningf("namespace %s invalid %s annotation %q, use the default", namespace, spotMinAnnotation, val)
+		} else {
+			spotMin = num
+		}
+	}
+
+	return ondemandMin, spotMin
+}
+
+// belowMinReplicasToAct reports whether the pod's workload has fewer than minReplicasToAct replicas and is left
+// to the scheduler, the intended replicas are unknown at create time so the observed siblings plus the created
+// pod are counted, a pod pinned by its capacity label is always placed
+func (app *App) belowMinReplicasToAct(pod *corev1.Pod) bool {
+	if app.minReplicasToAct <= 1 || forcedCapacity(pod.Labels) != "" {
+		return false
+	}
+
+	siblings, err := app.siblingPods(pod)
+	if err != nil {
+		klog.Errorf("list siblings of pod %s/%s: %v, place it", pod.Namespace, pod.Name, err)
+		return false
+	}
+
+	// the created pod is not stored yet
+	replicas := len(siblings) + 1
+	if replicas >= app.minReplicasToAct {
+		return false
+	}
+
+	klog.Infof("pod %s/%s workload has %d replicas, below MIN_REPLICAS_TO_ACT %d, skip", pod.Namespace, pod.Name, replicas, app.minReplicasToAct)
+	return true
+}
+
+// ondemandReadyLeft the ready on-demand pods of the workload left once the pod is deleted or evicted,
+// the pod itself is only counted by ondemandReady while it is ready on an on-demand node and not terminating
+func (app *App) ondemandReadyLeft(pod *corev1.Pod, ondemandReady int) int {
+	counted := pod.DeletionTimestamp == nil && app.podReady(pod) && app.nodeCapacity(pod.Spec.NodeName) == ondemandKey
+	if ondemandReady > 0 && counted {
+		return ondemandReady - 1
+	}
+	return ondemandReady
+}
+
+// scaleDownReadyCounts the ready spot pods of the pod's workload and the ready on-demand ones left
+// once the pod is deleted or evicted, what a scale down is judged on
+func (app *App) scaleDownReadyCounts(pod *corev1.Pod) (spotReady, ondemandLeft int, err error) {
+	spotReady, err = app.podExistAndReadyOnNodeCapacityNum(spotKey, pod)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ondemandReady, err := app.podExistAndReadyOnNodeCapacityNum(ondemandKey, pod)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return spotReady, app.ondemandReadyLeft(pod, ondemandReady), nil
+}
+
+// scaleDownCounts describes the ready counts against the minimums a scale down is judged on
+func scaleDownCounts(ondemandLeft, ondemandMin, spotReady, spotMin int) string {
+	return fmt.Sprintf("%s ready left=%d < min=%d, %s ready=%d >= min=%d", ondemandKey, ondemandLeft, ondemandMin, spotKey, spotReady, spotMin)
+}
+
+// effectiveOnDemandMin the on-demand minimum of the pod's workload, at least ondemandMinPercent
+// of its pods including the created one, so the first pod counts as one replica,
+// the absolute minimum when the siblings can not be listed
+func (app *App) effectiveOnDemandMin(pod *corev1.Pod, ondemandMin int) int {
+	if app.ondemandMinPercent == 0 {
+		return ondemandMin
+	}
+
+	siblings, err := app.siblingPods(pod)
+	if err != nil {
+		klog.Errorf("get pod: %v, use the absolute on-demand minimum", err)
+		return ondemandMin
+	}
+
+	total := len(siblings) + 1
+	// ceil(percent * total / 100) without floating point
+	if num := (app.ondemandMinPercent*total + 99) / 100; num > ondemandMin {
+		return num
+	}
+
+	return ondemandMin
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestOndemandReadyLeft(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+
+	terminating := testPod("web-1", "web", "od-1")
+	terminating.DeletionTimestamp = &metav1.Time{}
+
+	notReady := testPod("web-1", "web", "od-1")
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+
+	tests := []struct {
+		name  string
+		pod   *corev1.Pod
+		ready int
+		want  int
+	}{
+		{name: "ready on-demand pod is counted", pod: testPod("web-1", "web", "od-1"), ready: 2, want: 1},
+		{name: "terminating pod is not counted", pod: terminating, ready: 2, want: 2},
+		{name: "pod not ready is not counted", pod: notReady, ready: 2, want: 2},
+		{name: "spot pod is not counted", pod: testPod("web-1", "web", "spot-1"), ready: 2, want: 2},
+		{name: "none ready", pod: testPod("web-1", "web", "od-1"), ready: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := app.ondemandReadyLeft(tt.pod, tt.ready); got != tt.want {
+				t.Errorf("ondemandReadyLeft %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// a terminating pod deleted again does not count itself twice against the floor
+func TestDeleteTerminatingPodAllowed(t *testing.T) {
+	terminating := testPod("web-1", "web", "od-1")
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	app := newTestApp(t, testNode("od-1", ondemandKey), terminating, testPod("web-2", "web", "od-1"))
+	app.envConfig.OnDemandMinPodNum = 1
+	app.envConfig.SpotMinPodNum = 0
+	app.setReloadableConfig(app.envConfig)
+
+	if resp := mutate(t, app, podReview(t, admissionv1.Delete, terminating)); !resp.Allowed {
+		t.Errorf("delete of a terminating pod denied: %v", resp.Result)
+	}
+}
+
+func TestNamespaceMinimumOverrides(t *testing.T) {
+	annotated := func(name string, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+
+	app := newTestApp(t,
+		annotated("team-a", map[string]string{ondemandMinAnnotation: "3", spotMinAnnotation: "0"}),
+		annotated("team-b", map[string]string{ondemandMinAnnotation: "2"}),
+		annotated("team-c", map[string]string{ondemandMinAnnotation: "-1", spotMinAnnotation: "many"}),
+		annotated("plain", nil),
+	)
+	setMinimums(app, 1, 1)
+
+	tests := []struct {
+		namespace              string
+		wantOndemand, wantSpot int
+	}{
+		{namespace: "team-a", wantOndemand: 3, wantSpot: 0},
+		{namespace: "team-b", wantOndemand: 2, wantSpot: 1},
+		{namespace: "team-c", wantOndemand: 1, wantSpot: 1},
+		{namespace: "plain", wantOndemand: 1, wantSpot: 1},
+		{namespace: "missing", wantOndemand: 1, wantSpot: 1},
+	}
+
+	for _, tt := range tests {
+		if ondemandMin, spotMin := app.minPodNums(tt.namespace); ondemandMin != tt.wantOndemand || spotMin != tt.wantSpot {
+			t.Errorf("namespace %s minimums %d/%d, want %d/%d", tt.namespace, ondemandMin, spotMin, tt.wantOndemand, tt.wantSpot)
+		}
+	}
+}
+
+// the create of a pod in an annotated namespace is pinned by the namespace's minimum
+func TestNamespaceMinimumPlacement(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace, Annotations: map[string]string{ondemandMinAnnotation: "2"}}}
+	app := newTestApp(t, ns, testNode("od-1", ondemandKey), testPod("web-1", "web", "od-1"))
+	setMinimums(app, 1, 0)
+
+	resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if _, ok := findPatch(patchOf(t, resp), "/spec/nodeSelector"); !ok {
+		t.Errorf("second pod not pinned with the namespace's on-demand minimum of 2: %s", resp.Patch)
+	}
+}
+
+// a terminating on-demand pod is about to leave, it does not count toward OnDemandMinPodNum
+func TestTerminatingPodNotCounted(t *testing.T) {
+	terminating := testPod("web-1", "web", "od-1")
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	app := newTestApp(t, testNode("od-1", ondemandKey), terminating)
+	setMinimums(app, 1, 0)
+
+	for name, count := range map[string]func(string, *corev1.Pod) (int, error){
+		"exist": app.podExistOnNodeCapacityNum,
+		"ready": app.podExistAndReadyOnNodeCapacityNum,
+	} {
+		num, err := count(ondemandKey, testCreatedPod("web"))
+		if err != nil {
+			t.Fatalf("%s count: %v", name, err)
+		}
+		if num != 0 {
+			t.Errorf("%s count %d with only a terminating pod, want 0", name, num)
+		}
+	}
+
+	var selector map[string]string
+	decodePatchValue(t, patchOf(t, mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))), "/spec/nodeSelector", &selector)
+	if selector[capacityKey] != ondemandKey {
+		t.Errorf("create pinned to %q next to a terminating pod, want %s", selector[capacityKey], ondemandKey)
+	}
+}
+
+func TestOndemandMinPercent(t *testing.T) {
+	tests := []struct {
+		name     string
+		percent  int
+		absolute int
+		siblings int
+		want     int
+	}{
+		{name: "first pod of the workload", percent: 30, siblings: 0, want: 1},
+		{name: "30% of 10", percent: 30, absolute: 1, siblings: 9, want: 3},
+		{name: "30% of 11 rounds up", percent: 30, absolute: 1, siblings: 10, want: 4},
+		{name: "absolute above the percentage", percent: 50, absolute: 5, siblings: 3, want: 5},
+		{name: "100% of 5", percent: 100, siblings: 4, want: 5},
+		{name: "disabled", absolute: 2, siblings: 9, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{testNode("spot-1", spotKey)}
+			for i := 0; i < tt.siblings; i++ {
+				objects = append(objects, testPod(fmt.Sprintf("web-%d", i), "web", "spot-1"))
+			}
+
+			app := newTestApp(t, objects...)
+			app.ondemandMinPercent = tt.percent
+
+			if got := app.effectiveOnDemandMin(testCreatedPod("web"), tt.absolute); got != tt.want {
+				t.Errorf("effective on-demand minimum %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOndemandMinPercentPins(t *testing.T) {
+	for _, tt := range []struct {
+		ondemand int
+		pinned   bool
+	}{
+		{ondemand: 3, pinned: true},
+		{ondemand: 4},
+	} {
+		// 30% of 12 pods is 4 on-demand
+		objects := []runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+		for i := 0; i < 11; i++ {
+			node := "spot-1"
+			if i < tt.ondemand {
+				node = "od-1"
+			}
+			objects = append(objects, testPod(fmt.Sprintf("web-%d", i), "web", node))
+		}
+
+		app := newTestApp(t, objects...)
+		app.ondemandMinPercent = 30
+		setMinimums(app, 1, 0)
+
+		resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web")))
+		if pinned := len(resp.Patch) != 0; pinned != tt.pinned {
+			t.Errorf("%d of 11 pods on-demand: create pinned %v, want %v", tt.ondemand, pinned, tt.pinned)
+		}
+	}
+}
+
+func TestMinReplicasToAct(t *testing.T) {
+	tests := []struct {
+		name     string
+		siblings int
+		capacity string
+		// the capacity of the nodeSelector, empty for a pod left to the scheduler
+		want string
+	}{
+		{name: "below the threshold", siblings: 1},
+		{name: "at the threshold", siblings: 2, want: ondemandKey},
+		{name: "above the threshold", siblings: 3, want: ondemandKey},
+		{name: "pinned by the capacity label", capacity: spotKey, want: spotKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+			for i := 0; i < tt.siblings; i++ {
+				objects = append(objects, testPod(fmt.Sprintf("web-%d", i), "web", "od-1"))
+			}
+			app := newTestApp(t, objects...)
+			setMinimums(app, 5, 0)
+			app.minReplicasToAct = 3
+
+			pod := testCreatedPod("web")
+			if tt.capacity != "" {
+				pod.Labels[capacityLabel] = tt.capacity
+			}
+			patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+			if got := patched.Spec.NodeSelector[capacityKey]; got != tt.want {
+				t.Errorf("%d siblings with MIN_REPLICAS_TO_ACT 3: nodeSelector capacity %q, want %q", tt.siblings, got, tt.want)
+			}
+		})
+	}
+}
+
+// OnDemandMinPodNum is the number of on-demand pods to reach: the Nth create is the last one pinned
+func TestOndemandMinBoundary(t *testing.T) {
+	for _, min := range []int{0, 1, 2, 3} {
+		t.Run(fmt.Sprintf("min %d", min), func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, min, 0)
+
+			var pins []bool
+			for i := 0; i < 5; i++ {
+				pod := testCreatedPod("web")
+				patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+				pinned := patched.Spec.NodeSelector[capacityKey] == ondemandKey
+				pins = append(pins, pinned)
+
+				// the create is scheduled and ready before the next one
+				nodeName := "spot-1"
+				if pinned {
+					nodeName = "od-1"
+				}
+				created := testPod(fmt.Sprintf("web-%d", i), "web", nodeName)
+				created.CreationTimestamp = metav1.Now()
+				if _, err := app.Client.CoreV1().Pods(testNamespace).Create(app.Ctx, created, metav1.CreateOptions{}); err != nil {
+					t.Fatalf("create pod: %v", err)
+				}
+			}
+
+			for i, pinned := range pins {
+				if want := i < min; pinned != want {
+					t.Errorf("create %d of 5 pinned %v, want %v, pins %v", i+1, pinned, want, pins)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// testNamespaceObject the namespace with the labels and the mixSchedulerKey annotation, not annotated for an empty one
+func testNamespaceObject(name string, nsLabels map[string]string, annotation string) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nsLabels}}
+	if annotation != "" {
+		ns.Annotations = map[string]string{mixSchedulerKey: annotation}
+	}
+	return ns
+}
+
+func TestControllerNamespacePrecedence(t *testing.T) {
+	selector := labels.SelectorFromSet(labels.Set{"mix-scheduler": "enabled"})
+	enabled := map[string]string{"mix-scheduler": "enabled"}
+
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		selector  labels.Selector
+		// namespaces of notControllerNamespace
+		denied     []string
+		controlled bool
+	}{
+		{
+			name:       "annotation over the selector",
+			namespace:  testNamespaceObject("team-a", nil, "true"),
+			selector:   selector,
+			controlled: true,
+		},
+		{
+			name:      "annotation opting out over the selector",
+			namespace: testNamespaceObject("team-a", enabled, "false"),
+			selector:  selector,
+		},
+		{
+			name:       "annotation over the env",
+			namespace:  testNamespaceObject("team-a", nil, "true"),
+			denied:     []string{"team-a"},
+			controlled: true,
+		},
+		{
+			name:       "selector over the env",
+			namespace:  testNamespaceObject("team-a", enabled, ""),
+			selector:   selector,
+			denied:     []string{"team-a"},
+			controlled: true,
+		},
+		{
+			name:      "selector not matching over the env",
+			namespace: testNamespaceObject("team-a", nil, ""),
+			selector:  selector,
+		},
+		{
+			name:      "env denylist",
+			namespace: testNamespaceObject("team-a", nil, ""),
+			denied:    []string{"team-a"},
+		},
+		{
+			name:       "env default",
+			namespace:  testNamespaceObject("team-a", nil, ""),
+			controlled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, tt.namespace)
+			app.envConfig.namespaceSelector = tt.selector
+			app.envConfig.notControllerNamespace = map[string]struct{}{}
+			for _, ns := range tt.denied {
+				app.envConfig.notControllerNamespace[ns] = struct{}{}
+			}
+			app.setReloadableConfig(app.envConfig)
+
+			if got := app.isControllerNamespace(tt.namespace.Name); got != tt.controlled {
+				t.Errorf("controlled %v, want %v", got, tt.controlled)
+			}
+		})
+	}
+}
+
+func TestControllerNamespaceMissing(t *testing.T) {
+	for _, controlled := range []bool{true, false} {
+		app := newTestApp(t)
+		app.envConfig.namespaceSelector = labels.SelectorFromSet(labels.Set{"mix-scheduler": "enabled"})
+		app.envConfig.namespaceSelectorDefault = controlled
+		app.setReloadableConfig(app.envConfig)
+
+		if got := app.isControllerNamespace("missing"); got != controlled {
+			t.Errorf("missing namespace controlled %v, want the selector default %v", got, controlled)
+		}
+	}
+}
+
+func TestNamespaceListsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		notControlled string
+		controlled    string
+		// the namespaces controlled and not among team-a, team-b and kube-system
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name: "default denylist",
+			want: map[string]bool{"team-a": true, "team-b": true, "kube-system": false},
+		},
+		{
+			name:          "denylist",
+			notControlled: "team-a",
+			want:          map[string]bool{"team-a": false, "team-b": true, "kube-system": true},
+		},
+		{
+			name:       "allowlist",
+			controlled: "team-a, team-b",
+			want:       map[string]bool{"team-a": true, "team-b": true, "kube-system": false},
+		},
+		{
+			name:          "both lists conflict",
+			notControlled: "team-a",
+			controlled:    "team-b",
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("notControllerNamespace", tt.notControlled)
+			t.Setenv("CONTROLLED_NAMESPACES", tt.controlled)
+
+			notControlled, controlled, err := namespaceListsFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("no error with both namespace lists")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("namespace lists: %v", err)
+			}
+
+			app := newTestApp(t)
+			app.envConfig.notControllerNamespace = notControlled
+			app.envConfig.controlledNamespaces = controlled
+			app.setReloadableConfig(app.envConfig)
+
+			for ns, want := range tt.want {
+				if got := app.isControllerNamespace(ns); got != want {
+					t.Errorf("namespace %s controlled %v, want %v", ns, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceListsConfigMapConflict(t *testing.T) {
+	env := reloadableConfig{notControllerNamespace: map[string]struct{}{"kube-system": {}}}
+
+	_, err := reloadableConfigFromConfigMap(env, map[string]string{"notControllerNamespace": "team-a", "CONTROLLED_NAMESPACES": "team-b"})
+	if err == nil {
+		t.Fatalf("ConfigMap with both namespace lists applied")
+	}
+
+	// either list replaces the other of the env
+	config, err := reloadableConfigFromConfigMap(env, map[string]string{"CONTROLLED_NAMESPACES": "team-b"})
+	if err != nil {
+		t.Fatalf("ConfigMap allowlist: %v", err)
+	}
+	if config.notControllerNamespace != nil || len(config.controlledNamespaces) != 1 {
+		t.Errorf("denylist %v allowlist %v, want only the allowlist", config.notControllerNamespace, config.controlledNamespaces)
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"fmt"
+)
+
+// nodeNamePolicy decides what happens to pods created with spec.nodeName set,
+// they bypass the scheduler so the placement can not be injected
+type nodeNamePolicy string
+
+const (
+	// leave the pod as it is
+	nodeNameSkip nodeNamePolicy = "skip"
+	// reject the pod when its node is not on-demand while on-demand is required
+	nodeNameReject nodeNamePolicy = "reject"
+)
+
+func parseNodeNamePolicy(val string) (nodeNamePolicy, error) {
+	switch policy := nodeNamePolicy(val); policy {
+	case nodeNameSkip, nodeNameReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid node name policy %q, must be one of %s|%s", val, nodeNameSkip, nodeNameReject)
+	}
+}
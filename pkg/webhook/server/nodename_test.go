@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestNodeNamePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  nodeNamePolicy
+		node    string
+		allowed bool
+	}{
+		{name: "spot node skipped", policy: nodeNameSkip, node: "spot-1", allowed: true},
+		{name: "spot node rejected", policy: nodeNameReject, node: "spot-1"},
+		{name: "on-demand node allowed", policy: nodeNameReject, node: "od-1", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, 1, 0)
+			app.nodeNamePolicy = tt.policy
+
+			// below the on-demand minimum, on-demand is required
+			pod := testCreatedPod("web")
+			pod.Spec.NodeName = tt.node
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if len(resp.Patch) != 0 {
+				t.Errorf("pod assigned to a node patched: %s", resp.Patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// nodeWeightKey the node label weighting the nodes of the capacity against each other
+func nodeWeightKey(capacity string) string {
+	if capacity == spotKey {
+		return spotWeithtKey
+	}
+	return ondemandWeithtKey
+}
+
+// nodeWeightTerms preferred node affinity terms toward the nodes of the capacity by their weight label,
+// one term per weight so the scheduler prefers the heavier node pools, weights are clamped to 1-100
+// and nodes without a valid weight get no preference
+func (app *App) nodeWeightTerms(capacity string) ([]corev1.PreferredSchedulingTerm, error) {
+	nodes, err := app.ListNode(app.capacitySelector(capacity))
+	if err != nil {
+		return nil, internalErrorf("get %s nodes: %v", capacity, err)
+	}
+
+	key := nodeWeightKey(capacity)
+	weights := make(map[string]int32)
+	for _, node := range nodes {
+		val, ok := node.Labels[key]
+		if !ok {
+			continue
+		}
+		if _, seen := weights[val]; seen {
+			continue
+		}
+
+		weight, err := strconv.Atoi(val)
+		if err != nil || weight < 1 {
+			klog.V(4).Infof("node %s invalid %s label %q, no preference", node.Name, key, val)
+			continue
+		}
+		if weight > 100 {
+			weight = 100
+		}
+		weights[val] = int32(weight)
+	}
+
+	values := make([]string, 0, len(weights))
+	for val := range weights {
+		values = append(values, val)
+	}
+	sort.Strings(values)
+
+	terms := make([]corev1.PreferredSchedulingTerm, 0, len(values))
+	for _, val := range values {
+		terms = append(terms, corev1.PreferredSchedulingTerm{
+			Weight: weights[val],
+			Preference: corev1.NodeSelectorTerm{
+				MatchExpressions: []corev1.NodeSelectorRequirement{
+					{
+						Key:      capacityKey,
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   app.capacityValues(capacity),
+					},
+					{
+						Key:      key,
+						Operator: corev1.NodeSelectorOpIn,
+						Values:   []string{val},
+					},
+				},
+			},
+		})
+	}
+
+	return terms, nil
+}
+
+// preferNodeWeights adds the node weight terms of the capacity to the affinity, reports whether any was added
+func (app *App) preferNodeWeights(affinity *corev1.Affinity, capacity string) (bool, error) {
+	terms, err := app.nodeWeightTerms(capacity)
+	if err != nil || len(terms) == 0 {
+		return false, err
+	}
+
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, terms...)
+
+	return true, nil
+}
+
+// nodeWeightPatch the patch preferring the heavier spot node pools for a pod left to the scheduler,
+// nil without node weights
+func (app *App) nodeWeightPatch(pod *corev1.Pod) ([]JSONPatchEntry, error) {
+	if !app.nodeWeightAffinity {
+		return nil, nil
+	}
+
+	affinity := FillAffinity(pod.Spec)
+	added, err := app.preferNodeWeights(affinity, spotKey)
+	if err != nil || !added {
+		return nil, err
+	}
+
+	affinityBytes, err := json.Marshal(affinity)
+	if err != nil {
+		return nil, internalErrorf("marshal affinity: %v", err)
+	}
+
+	return []JSONPatchEntry{
+		{
+			OP:    "add",
+			Path:  "/spec/affinity",
+			Value: affinityBytes,
+		},
+	}, nil
+}
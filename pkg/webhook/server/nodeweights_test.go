@@ -0,0 +1,85 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// weightedNode a node of the capacity with its weight label, without one for an empty weight
+func weightedNode(name, capacity, weight string) *corev1.Node {
+	node := testNode(name, capacity)
+	if weight != "" {
+		node.Labels[nodeWeightKey(capacity)] = weight
+	}
+	return node
+}
+
+func weightedNodes() []runtime.Object {
+	return []runtime.Object{
+		weightedNode("spot-1", spotKey, "70"),
+		weightedNode("spot-2", spotKey, "30"),
+		weightedNode("spot-3", spotKey, "30"),
+		weightedNode("spot-4", spotKey, "250"),
+		weightedNode("spot-5", spotKey, "heavy"),
+		weightedNode("spot-6", spotKey, ""),
+		weightedNode("od-1", ondemandKey, "90"),
+	}
+}
+
+// termWeights the weight of each term by the node weight label value it prefers
+func termWeights(terms []corev1.PreferredSchedulingTerm) map[string]int32 {
+	weights := make(map[string]int32)
+	for _, term := range terms {
+		for _, req := range term.Preference.MatchExpressions {
+			if req.Key == spotWeithtKey || req.Key == ondemandWeithtKey {
+				weights[req.Values[0]] = term.Weight
+			}
+		}
+	}
+	return weights
+}
+
+func TestNodeWeightTerms(t *testing.T) {
+	app := newTestApp(t, weightedNodes()...)
+
+	terms, err := app.nodeWeightTerms(spotKey)
+	if err != nil {
+		t.Fatalf("node weight terms: %v", err)
+	}
+
+	// one term per weight, clamped to 100, invalid and missing weights get none
+	want := map[string]int32{"250": 100, "30": 30, "70": 70}
+	got := termWeights(terms)
+	if len(terms) != len(want) {
+		t.Errorf("%d terms, want %d: %v", len(terms), len(want), got)
+	}
+	for val, weight := range want {
+		if got[val] != weight {
+			t.Errorf("weight of %s nodes %d, want %d", val, got[val], weight)
+		}
+	}
+
+	for _, term := range terms {
+		if req := term.Preference.MatchExpressions[0]; req.Key != capacityKey || !equalStrings(req.Values, app.spotValues) {
+			t.Errorf("term %v not limited to the spot nodes", term.Preference)
+		}
+	}
+}
+
+func TestNodeWeightAffinity(t *testing.T) {
+	app := newTestApp(t, append(weightedNodes(), testPod("web-1", "web", "od-1"))...)
+	app.nodeWeightAffinity = true
+	setMinimums(app, 1, 0)
+
+	// above the on-demand minimum the pod is left to the scheduler, preferring the heavier spot pools
+	patched := applyPatch(t, testCreatedPod("web"), mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web"))))
+	if patched.Spec.Affinity == nil || patched.Spec.Affinity.NodeAffinity == nil {
+		t.Fatalf("no node affinity for a pod left to the scheduler")
+	}
+	if got := termWeights(patched.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution); got["70"] != 70 || got["90"] != 0 {
+		t.Errorf("node weights %v, want the spot ones", got)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteOptions decodes the DeleteOptions sent with a DELETE request, nil when absent
+func deleteOptions(req *admissionv1.AdmissionRequest) (*metav1.DeleteOptions, error) {
+	if len(req.Options.Raw) == 0 {
+		return nil, nil
+	}
+
+	opts := &metav1.DeleteOptions{}
+	if err := json.Unmarshal(req.Options.Raw, opts); err != nil {
+		return nil, fmt.Errorf("unmarshal to delete options: %v", err)
+	}
+
+	return opts, nil
+}
+
+// deleteGuardSkipped reports whether the delete's propagation policy bypasses the scale down guard
+func (app *App) deleteGuardSkipped(opts *metav1.DeleteOptions) bool {
+	if opts == nil || opts.PropagationPolicy == nil {
+		return false
+	}
+
+	_, ok := app.deleteGuardSkipPropagationPolicies[*opts.PropagationPolicy]
+	return ok
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// statefulSetOrdinal the ordinal of a pod controlled by a StatefulSet, parsed from its name <statefulset>-<ordinal>,
+// reports false for other pods
+func statefulSetOrdinal(pod *corev1.Pod) (int, bool) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "StatefulSet" {
+		return 0, false
+	}
+
+	suffix, ok := strings.CutPrefix(pod.Name, owner.Name+"-")
+	if !ok {
+		return 0, false
+	}
+
+	ordinal, err := strconv.Atoi(suffix)
+	if err != nil || ordinal < 0 || strconv.Itoa(ordinal) != suffix {
+		return 0, false
+	}
+
+	return ordinal, true
+}
+
+// ordinalStrategy places the pods of a StatefulSet by their ordinal instead of counting the live pods,
+// the tiers take the lowest ordinals in order, e.g. ordinals 0 and 1 go to on-demand with OnDemandMinPodNum 2,
+// the higher ordinals go to spot, so a recreated pod lands on the capacity it had. Other pods are left to next
+type ordinalStrategy struct {
+	app  *App
+	next placementStrategy
+}
+
+func (s *ordinalStrategy) Decide(ctx context.Context, pod *corev1.Pod) (placementPlan, error) {
+	ordinal, ok := statefulSetOrdinal(pod)
+	if !ok {
+		return s.next.Decide(ctx, pod)
+	}
+
+	// the ordinals are stable, the live pods and ONDEMAND_MIN_PERCENT do not matter
+	upper := 0
+	for _, tier := range s.app.tiers {
+		min := tier.Min
+		if min == namespaceTierMin {
+			min, _ = s.app.minPodNums(pod.Namespace)
+		}
+
+		upper += min
+		if ordinal < upper {
+			return placementPlan{Capacity: tier.Capacity}, nil
+		}
+	}
+
+	return placementPlan{Capacity: spotKey}, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestStatefulSetOrdinal(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   string
+		ordinal int
+		ok      bool
+	}{
+		{name: "db-0", owner: "db", ordinal: 0, ok: true},
+		{name: "db-12", owner: "db", ordinal: 12, ok: true},
+		{name: "db-cache-3", owner: "db-cache", ordinal: 3, ok: true},
+		{name: "db-01", owner: "db"},
+		{name: "db-x", owner: "db"},
+		{name: "other-0", owner: "db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordinal, ok := statefulSetOrdinal(statefulSetPod(tt.name, tt.owner, ""))
+			if ok != tt.ok || ordinal != tt.ordinal {
+				t.Errorf("statefulSetOrdinal(%s of %s) = %d %v, want %d %v", tt.name, tt.owner, ordinal, ok, tt.ordinal, tt.ok)
+			}
+		})
+	}
+
+	if _, ok := statefulSetOrdinal(ownedBy(testPod("db-0", "db", ""), "ReplicaSet", "db")); ok {
+		t.Errorf("ordinal of a pod not controlled by a StatefulSet")
+	}
+}
+
+func TestOrdinalPlacement(t *testing.T) {
+	tests := []struct {
+		name  string
+		tiers string
+		// the capacity of the nodeSelector by ordinal
+		want []string
+	}{
+		{name: "on-demand", tiers: "on-demand", want: []string{ondemandKey, ondemandKey, spotKey, spotKey, spotKey}},
+		{name: "committed and on-demand", tiers: "committed:1,on-demand", want: []string{committedCapacity, ondemandKey, ondemandKey, spotKey, spotKey}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// more live on-demand pods than the minimum, the ordinals decide regardless
+			app := newTestApp(t, testNode("committed-1", committedCapacity), testNode("od-1", ondemandKey), testNode("spot-1", spotKey),
+				statefulSetPod("db-7", "db", "od-1"), statefulSetPod("db-8", "db", "od-1"), statefulSetPod("db-9", "db", "od-1"))
+			setMinimums(app, 2, 0)
+			tiers, err := parseTiers(tt.tiers, app.spotValues)
+			if err != nil {
+				t.Fatalf("parse tiers: %v", err)
+			}
+			app.tiers = tiers
+			app.statefulSetOrdinalPlacement = true
+			app.strategy = newPlacementStrategy(app, app.capacityMode)
+
+			for ordinal, want := range tt.want {
+				pod := statefulSetPod(fmt.Sprintf("db-%d", ordinal), "db", "")
+				pod.UID = ""
+				pod.Status = testCreatedPod("db").Status
+				patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+				if got := patched.Spec.NodeSelector[capacityKey]; got != want {
+					t.Errorf("ordinal %d: nodeSelector capacity %q, want %q", ordinal, got, want)
+				}
+			}
+		})
+	}
+}
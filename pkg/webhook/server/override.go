@@ -0,0 +1,26 @@
+package server
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// capacityLabel pins the pods of a workload to one capacity regardless of the minimums,
+// e.g. on-demand for databases and spot for batch
+const capacityLabel = "mix-scheduler/capacity"
+
+// mixedCapacity the capacityLabel value keeping the placement by the capacity mode
+const mixedCapacity = "mixed"
+
+// forcedCapacity the capacity the pod's capacityLabel pins it to, empty when the pod is placed by the capacity mode
+func forcedCapacity(podLabels map[string]string) string {
+	switch val := podLabels[capacityLabel]; val {
+	case ondemandKey, spotKey:
+		return val
+	case "", mixedCapacity:
+		return ""
+	default:
+		klog.Warningf("invalid %s label %q, must be one of %s|%s|%s, treated as %s", capacityLabel, val,
+			ondemandKey, spotKey, mixedCapacity, mixedCapacity)
+		return ""
+	}
+}
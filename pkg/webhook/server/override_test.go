@@ -0,0 +1,41 @@
+package server
+
+import "testing"
+
+func TestCapacityLabel(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		ondemandMin int
+		// the capacity of the nodeSelector, empty for none
+		want string
+	}{
+		{name: "on-demand above the minimum", value: ondemandKey, want: ondemandKey},
+		{name: "spot below the minimum", value: spotKey, ondemandMin: 5, want: spotKey},
+		{name: "mixed below the minimum", value: mixedCapacity, ondemandMin: 5, want: ondemandKey},
+		{name: "mixed above the minimum", value: mixedCapacity},
+		{name: "invalid value is mixed", value: "gpu"},
+		{name: "without the label", ondemandMin: 5, want: ondemandKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, tt.ondemandMin, 0)
+
+			pod := testCreatedPod("web")
+			if tt.value != "" {
+				pod.Labels[capacityLabel] = tt.value
+			}
+
+			// through /validate as well, forced to spot regardless of the on-demand minimum
+			patched, resp := admit(t, app, pod)
+			if got := patched.Spec.NodeSelector[capacityKey]; got != tt.want {
+				t.Errorf("nodeSelector capacity %q, want %q", got, tt.want)
+			}
+			if !resp.Allowed {
+				t.Errorf("denied by /validate: %v", resp.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// ownerResolutionFailurePolicy decides what owner-aware code does when the pod's owner
+// can not be resolved, e.g. a dangling owner reference or missing RBAC
+type ownerResolutionFailurePolicy string
+
+const (
+	// go on as if the pod had no owner, siblings are matched by labels
+	ownerResolutionFallBackToLabels ownerResolutionFailurePolicy = "fall-back-to-labels"
+	// leave the pod alone
+	ownerResolutionSkip ownerResolutionFailurePolicy = "skip"
+)
+
+func parseOwnerResolutionFailurePolicy(val string) (ownerResolutionFailurePolicy, error) {
+	switch policy := ownerResolutionFailurePolicy(val); policy {
+	case ownerResolutionFallBackToLabels, ownerResolutionSkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid owner resolution failure policy %q, must be one of %s|%s", val,
+			ownerResolutionFallBackToLabels, ownerResolutionSkip)
+	}
+}
+
+// ownerResolutionFailed count and log the failure, reports whether the pod is to be skipped per policy
+func (app *App) ownerResolutionFailed(pod *corev1.Pod, err error) bool {
+	ownerResolutionFailuresTotal.Inc()
+
+	if app.ownerResolutionFailurePolicy == ownerResolutionSkip {
+		klog.Errorf("resolve owner of pod %s/%s: %v, skip", pod.Namespace, pod.Name, err)
+		return true
+	}
+
+	klog.Errorf("resolve owner of pod %s/%s: %v, fall back to labels", pod.Namespace, pod.Name, err)
+	return false
+}
+
+// daemonSetPod reports whether the pod is controlled by a DaemonSet and skipped, the DaemonSet
+// controller binds its pods to their nodes so there is no capacity to choose
+func (app *App) daemonSetPod(pod *corev1.Pod) bool {
+	if !app.skipDaemonSetPods {
+		return false
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "DaemonSet" {
+		return false
+	}
+
+	klog.Infof("pod %s/%s controlled by daemonset %s, skip", pod.Namespace, pod.Name, owner.Name)
+	return true
+}
+
+// workloadOwner resolves the top-level controller of the pod, pods of a ReplicaSet
+// owned by a Deployment resolve to the Deployment, returns nil when the pod has no controller
+func (app *App) workloadOwner(pod *corev1.Pod) (*metav1.OwnerReference, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return owner, nil
+	}
+
+	rs, err := app.GetReplicaSet(pod.Namespace, owner.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get replicaset %s/%s: %v", pod.Namespace, owner.Name, err)
+	}
+
+	if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil {
+		return rsOwner, nil
+	}
+
+	return owner, nil
+}
+
+// ownerScaledToZero reports whether the pod's controller wants zero replicas, i.e. the
+// workload is scaled to zero and all its pods, on-demand ones included, are going away
+func (app *App) ownerScaledToZero(pod *corev1.Pod) (bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return false, nil
+	}
+
+	switch owner.Kind {
+	case "ReplicaSet":
+		rs, err := app.GetReplicaSet(pod.Namespace, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("get replicaset %s/%s: %v", pod.Namespace, owner.Name, err)
+		}
+		return rs.Spec.Replicas != nil && *rs.Spec.Replicas == 0, nil
+	case "StatefulSet":
+		sts, err := app.GetStatefulSet(pod.Namespace, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("get statefulset %s/%s: %v", pod.Namespace, owner.Name, err)
+		}
+		return sts.Spec.Replicas != nil && *sts.Spec.Replicas == 0, nil
+	default:
+		return false, nil
+	}
+}
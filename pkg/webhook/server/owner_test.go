@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// the pod's ReplicaSet is gone, the delete guard can not tell whether it was scaled to zero
+func TestDanglingOwnerReference(t *testing.T) {
+	tests := []struct {
+		policy  ownerResolutionFailurePolicy
+		allowed bool
+	}{
+		// fall back to the labels, the last on-demand pod is guarded
+		{policy: ownerResolutionFallBackToLabels},
+		{policy: ownerResolutionSkip, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			pod := ownedBy(testPod("web-1", "web", "od-1"), "ReplicaSet", "web-deleted")
+			app := newTestApp(t, testNode("od-1", ondemandKey), pod)
+			setMinimums(app, 1, 0)
+			app.ownerResolutionFailurePolicy = tt.policy
+
+			before := counterValue(t, ownerResolutionFailuresTotal)
+
+			resp := mutate(t, app, podReview(t, admissionv1.Delete, pod))
+			if resp.Allowed != tt.allowed {
+				t.Errorf("delete allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if got := counterValue(t, ownerResolutionFailuresTotal) - before; got != 1 {
+				t.Errorf("mix_scheduler_owner_resolution_failures_total increased by %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestDanglingOwnerWorkload(t *testing.T) {
+	app := newTestApp(t)
+
+	if _, err := app.workloadOwner(ownedBy(testCreatedPod("web"), "ReplicaSet", "web-deleted")); err == nil {
+		t.Errorf("owner of a missing ReplicaSet resolved")
+	}
+}
+
+func TestDaemonSetPodSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		skip bool
+		// the capacity of the nodeSelector, empty for an unmutated pod
+		want string
+	}{
+		{name: "skipped", skip: true},
+		{name: "mutated when not skipped", want: ondemandKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, 1, 0)
+			app.skipDaemonSetPods = tt.skip
+
+			pod := ownedBy(testCreatedPod("agent"), "DaemonSet", "agent")
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+			if !resp.Allowed {
+				t.Fatalf("daemonset pod denied: %v", resp.Result)
+			}
+			if tt.skip && resp.Patch != nil {
+				t.Errorf("daemonset pod patched %s, want it skipped", resp.Patch)
+			}
+			if got := applyPatch(t, pod, resp).Spec.NodeSelector[capacityKey]; got != tt.want {
+				t.Errorf("nodeSelector capacity %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// patchMode decides how the placement concerns are written to the admission response,
+// the admission API only accepts JSONPatch so merged composes them per field instead of a strategic merge
+type patchMode string
+
+const (
+	// one JSONPatch operation per concern
+	patchModeJSONPatch patchMode = "json-patch"
+	// the concerns are merged into the pod and written with one add per mutated field
+	patchModeMerged patchMode = "merged"
+)
+
+func parsePatchMode(val string) (patchMode, error) {
+	switch mode := patchMode(val); mode {
+	case patchModeJSONPatch, patchModeMerged:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid patch mode %q, must be one of %s|%s", val, patchModeJSONPatch, patchModeMerged)
+	}
+}
+
+// unescapeJSONPointer reverses escapeJSONPointer
+func unescapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+// mergePatch applies the add operations to the object and returns one add per mutated field,
+// a field is the first two tokens of the path such as /spec/affinity or /metadata/annotations
+func mergePatch(obj interface{}, patch []JSONPatchEntry) ([]JSONPatchEntry, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("marshal object: %v", err)
+	}
+
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal object: %v", err)
+	}
+
+	var fields []string
+	touched := make(map[string]struct{})
+	for _, entry := range patch {
+		if entry.OP != "add" {
+			return nil, fmt.Errorf("merge %s %s: only add operations can be merged", entry.OP, entry.Path)
+		}
+
+		tokens := strings.Split(strings.TrimPrefix(entry.Path, "/"), "/")
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("merge %s: path must address a field below the root", entry.Path)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(entry.Value, &value); err != nil {
+			return nil, fmt.Errorf("merge %s: %v", entry.Path, err)
+		}
+
+		parent := doc
+		for _, token := range tokens[:len(tokens)-1] {
+			token = unescapeJSONPointer(token)
+			child, ok := parent[token].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[token] = child
+			}
+			parent = child
+		}
+		parent[unescapeJSONPointer(tokens[len(tokens)-1])] = value
+
+		field := "/" + tokens[0] + "/" + tokens[1]
+		if _, ok := touched[field]; !ok {
+			touched[field] = struct{}{}
+			fields = append(fields, field)
+		}
+	}
+
+	merged := make([]JSONPatchEntry, 0, len(fields))
+	for _, field := range fields {
+		tokens := strings.Split(strings.TrimPrefix(field, "/"), "/")
+		value, err := json.Marshal(doc[unescapeJSONPointer(tokens[0])].(map[string]interface{})[unescapeJSONPointer(tokens[1])])
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s: %v", field, err)
+		}
+
+		merged = append(merged, JSONPatchEntry{
+			OP:    "add",
+			Path:  field,
+			Value: value,
+		})
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// the merged patch composes the concerns into one add per field, applied it gives the same pod as the JSONPatch
+func TestMergedPatchMatchesJSONPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  func() *corev1.Pod
+	}{
+		{
+			name: "on-demand pod with user nodeSelector and annotations",
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Spec.NodeSelector = map[string]string{"disktype": "ssd"}
+				pod.Annotations = map[string]string{"team": "web"}
+				return pod
+			},
+		},
+		{
+			name: "spot pod with tolerations and requests",
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("batch")
+				pod.Labels[capacityLabel] = spotKey
+				pod.Spec.Tolerations = []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}}
+				pod.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}
+				return pod
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched := make(map[patchMode]*corev1.Pod)
+			for _, mode := range []patchMode{patchModeJSONPatch, patchModeMerged} {
+				app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+				setMinimums(app, 1, 0)
+				app.patchMode = mode
+				app.annotationTemplate = map[string]string{"cost-center": "42"}
+				app.spotToleration = newSpotToleration("spot", "", corev1.TaintEffectNoSchedule)
+				app.spotRequestFactors = map[corev1.ResourceName]float64{corev1.ResourceCPU: 0.5}
+
+				pod := tt.pod()
+				resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+				if mode == patchModeMerged {
+					fields := make(map[string]struct{})
+					for _, entry := range patchOf(t, resp) {
+						if strings.Count(entry.Path, "/") != 2 {
+							t.Errorf("merged patch of %s, want one add per field", entry.Path)
+						}
+						if _, ok := fields[entry.Path]; ok {
+							t.Errorf("field %s patched twice", entry.Path)
+						}
+						fields[entry.Path] = struct{}{}
+					}
+				}
+				patched[mode] = applyPatch(t, pod, resp)
+			}
+
+			if !equality.Semantic.DeepEqual(patched[patchModeJSONPatch], patched[patchModeMerged]) {
+				t.Errorf("merged patch gives\n%s\nthe JSONPatch\n%s", mustJSON(t, patched[patchModeMerged]), mustJSON(t, patched[patchModeJSONPatch]))
+			}
+		})
+	}
+}
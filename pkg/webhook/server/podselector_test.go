@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestControlledPodSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		app      string
+		// the capacity of the nodeSelector, empty for a skipped pod
+		want string
+	}{
+		{name: "without a selector", app: "batch", want: ondemandKey},
+		{name: "matching", selector: "app in (web,api)", app: "api", want: ondemandKey},
+		{name: "not matching", selector: "app in (web,api)", app: "batch"},
+		{name: "missing the label", selector: "tier", app: "web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONTROLLED_POD_SELECTOR", tt.selector)
+			selector, err := controlledPodSelectorFromEnv()
+			if err != nil {
+				t.Fatalf("parse CONTROLLED_POD_SELECTOR %q: %v", tt.selector, err)
+			}
+
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, 1, 0)
+			app.controlledPodSelector = selector
+
+			pod := testCreatedPod(tt.app)
+			patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+			if got := patched.Spec.NodeSelector[capacityKey]; got != tt.want {
+				t.Errorf("nodeSelector capacity %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestControlledPodSelectorInvalid(t *testing.T) {
+	t.Setenv("CONTROLLED_POD_SELECTOR", "app in (web")
+
+	if _, err := controlledPodSelectorFromEnv(); err == nil {
+		t.Errorf("invalid CONTROLLED_POD_SELECTOR accepted")
+	}
+}
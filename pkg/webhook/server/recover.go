@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/middleware"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/klog/v2"
+)
+
+// recoverAdmission answers an admission request whose handler panicked with an AdmissionReview error response
+// through FAILURE_POLICY, instead of the broken connection the API server takes as a webhook failure.
+// The body is buffered so the review can be read again for the UID of the response
+func (app *App) recoverAdmission(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// one byte over the limit, so readJSON still rejects an oversized body
+		body, err := io.ReadAll(io.LimitReader(r.Body, app.maxRequestBytes+1))
+		if err != nil {
+			jsonError(w, fmt.Sprintf("read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			handlerPanicsTotal.WithLabelValues(r.URL.Path).Inc()
+			klog.Errorf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+
+			// the response went out before the panic, it can not be replaced
+			if ww.Status() != 0 {
+				return
+			}
+
+			admissionReview := &admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(body, admissionReview); err != nil || admissionReview.Request == nil {
+				jsonError(w, fmt.Sprintf("internal error: %v", rec), http.StatusInternalServerError)
+				return
+			}
+
+			app.HandleError(w, r, admissionReview, internalErrorf("internal error: %v", rec))
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
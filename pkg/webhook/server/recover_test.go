@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// panicking a handler panicking like a nil dereference would, after writing the status when wrote
+func panicking(wrote bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if wrote {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		var review *admissionv1.AdmissionReview
+		_ = review.Request.UID
+	}
+}
+
+func TestRecoverAdmissionFollowsFailurePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy  failurePolicy
+		allowed bool
+	}{
+		{policy: failurePolicyFail},
+		{policy: failurePolicyIgnore, allowed: true},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			app := newTestApp(t)
+			app.failurePolicy = tt.policy
+			before := counterValue(t, handlerPanicsTotal.WithLabelValues(defaultMutatePath))
+
+			review := podReview(t, admissionv1.Create, testCreatedPod("web"))
+			code, resp := postReview(t, app.recoverAdmission(panicking(false)).ServeHTTP, review)
+			if code != http.StatusOK || resp == nil {
+				t.Fatalf("panic answered %d without an AdmissionReview", code)
+			}
+			if resp.Response.UID != review.Request.UID {
+				t.Errorf("response UID %q, want the request's %q", resp.Response.UID, review.Request.UID)
+			}
+			if resp.Response.Allowed != tt.allowed || len(resp.Response.Patch) != 0 {
+				t.Errorf("allowed %v patch %s, want allowed %v unchanged", resp.Response.Allowed, resp.Response.Patch, tt.allowed)
+			}
+
+			if got := counterValue(t, handlerPanicsTotal.WithLabelValues(defaultMutatePath)) - before; got != 1 {
+				t.Errorf("mix_scheduler_handler_panics_total increased by %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestRecoverAdmissionWithoutReview(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := httptest.NewRecorder()
+	app.recoverAdmission(panicking(false)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, defaultMutatePath, strings.NewReader("not a review")))
+	if rec.Code != http.StatusInternalServerError || rec.Body.Len() == 0 {
+		t.Errorf("panic on a body without a review answered %d %q, want a 500 error", rec.Code, rec.Body)
+	}
+}
+
+func TestRecoverAdmissionAfterResponse(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := httptest.NewRecorder()
+	app.recoverAdmission(panicking(true)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, defaultMutatePath, strings.NewReader("{}")))
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("panic after the response answered %d %q, want the handler's 202 kept", rec.Code, rec.Body)
+	}
+}
+
+// the router wraps the admission handlers, a panic still gets an HTTP response
+func TestRouterRecoversAdmission(t *testing.T) {
+	app := newTestApp(t)
+	router := BuildRouter(app)
+	router.With(app.recoverAdmission).Post("/panic", panicking(false))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/panic", strings.NewReader("{}")))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("panicking handler answered %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const defaultReservationWindow = 5 * time.Second
+
+// placementReservations remembers the recent pins of each workload per capacity, the pinned pods
+// reach the informer cache only after their create completed, so a burst of creates racing
+// through the webhook would all see the same count and overshoot the minimum of the capacity
+type placementReservations struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	pins map[string][]time.Time
+}
+
+func newPlacementReservations(window time.Duration) *placementReservations {
+	return &placementReservations{
+		window: window,
+		pins:   make(map[string][]time.Time),
+	}
+}
+
+// reservationKey the workload of the pod and the capacity it is pinned to
+func reservationKey(pod *corev1.Pod, capacity string) string {
+	return burstKey(pod) + "@" + capacity
+}
+
+// reserve records a pin of the pod's workload to the capacity at now, nil safe
+func (r *placementReservations) reserve(pod *corev1.Pod, capacity string, now time.Time) {
+	if r == nil {
+		return
+	}
+
+	key := reservationKey(pod, capacity)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// forget the pins which left the window, also of other workloads so the map does not grow unbounded
+	for k, pins := range r.pins {
+		i := 0
+		for i < len(pins) && now.Sub(pins[i]) > r.window {
+			i++
+		}
+
+		if i == len(pins) {
+			delete(r.pins, k)
+		} else if i > 0 {
+			r.pins[k] = pins[i:]
+		}
+	}
+
+	r.pins[key] = append(r.pins[key], now)
+}
+
+// count the pins of the pod's workload to the capacity within the window before now
+func (r *placementReservations) count(pod *corev1.Pod, capacity string, now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, pin := range r.pins[reservationKey(pod, capacity)] {
+		if now.Sub(pin) <= r.window {
+			count++
+		}
+	}
+
+	return count
+}
+
+// capacityPodNum the pods of the pod's workload on the capacity, scheduled or pinned regardless of readiness,
+// plus the pods pinned within the reservation window not yet in the cache, the pods created within
+// the window are taken as the reserved ones already seen
+func (app *App) capacityPodNum(capacity string, pod *corev1.Pod) (int, error) {
+	if app.reservations == nil {
+		return app.podExistOnNodeCapacityNum(capacity, pod)
+	}
+
+	now := time.Now()
+	num, recent, err := app.podExistOnNodeCapacityNumSince(capacity, pod, now.Add(-app.reservations.window))
+	if err != nil {
+		return 0, err
+	}
+	if unseen := app.reservations.count(pod, capacity, now) - recent; unseen > 0 {
+		klog.V(4).Infof("pod %s/%s %d %s pins not yet in the cache", pod.Namespace, pod.GenerateName, unseen, capacity)
+		num += unseen
+	}
+
+	return num, nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// a burst of creates races through the webhook before any of its pods reaches the cache
+func TestColdStartBurst(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved bool
+		pinned   int
+	}{
+		{name: "reservations keep the minimum", reserved: true, pinned: 3},
+		{name: "without reservations every create sees none", pinned: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, 3, 0)
+			if !tt.reserved {
+				app.reservations = nil
+			}
+
+			pinned := 0
+			for i := 0; i < 10; i++ {
+				if resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web"))); len(resp.Patch) != 0 {
+					pinned++
+				}
+			}
+
+			if pinned != tt.pinned {
+				t.Errorf("%d of 10 creates pinned, want %d", pinned, tt.pinned)
+			}
+		})
+	}
+}
+
+// the pinned pods reaching the cache, scheduled but not ready yet, are not counted twice
+func TestColdStartPinsInCache(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	setMinimums(app, 3, 0)
+
+	for i := 0; i < 2; i++ {
+		if resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web"))); len(resp.Patch) == 0 {
+			t.Fatalf("create %d below the minimum not pinned", i)
+		}
+	}
+
+	// the two pins are scheduled and starting
+	for _, name := range []string{"web-1", "web-2"} {
+		pod := notReady(testPod(name, "web", "od-1"))
+		pod.CreationTimestamp = metav1.Now()
+		if _, err := app.Client.CoreV1().Pods(testNamespace).Create(app.Ctx, pod, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod: %v", err)
+		}
+	}
+
+	num, err := app.capacityPodNum(ondemandKey, testCreatedPod("web"))
+	if err != nil {
+		t.Fatalf("count on-demand pods: %v", err)
+	}
+	if num != 2 {
+		t.Errorf("%d on-demand pods counted, want the 2 pins once", num)
+	}
+
+	if resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web"))); len(resp.Patch) == 0 {
+		t.Errorf("third create below the minimum not pinned")
+	}
+	if resp := mutate(t, app, podReview(t, admissionv1.Create, testCreatedPod("web"))); len(resp.Patch) != 0 {
+		t.Errorf("fourth create pinned above the minimum: %s", resp.Patch)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+// podRequests the effective resource requests of the pod, as the scheduler computes them:
+// max(sum of containers, any init container) plus the pod overhead.
+//
+// spec.overhead is set by the RuntimeClass admission plugin, which runs before the mutating
+// webhooks, so it is normally present here. When another mutating webhook sets the runtimeClassName
+// after us the overhead is still absent, the requests are then computed without it.
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	reqs := corev1.ResourceList{}
+	for ci := range pod.Spec.Containers {
+		addResourceList(reqs, pod.Spec.Containers[ci].Resources.Requests)
+	}
+
+	for ci := range pod.Spec.InitContainers {
+		maxResourceList(reqs, pod.Spec.InitContainers[ci].Resources.Requests)
+	}
+
+	if pod.Spec.Overhead != nil {
+		addResourceList(reqs, pod.Spec.Overhead)
+	} else if pod.Spec.RuntimeClassName != nil {
+		klog.V(4).Infof("pod %s/%s runtime class %s without overhead, requests computed without it", pod.Namespace, pod.Name, *pod.Spec.RuntimeClassName)
+	}
+
+	return reqs
+}
+
+// addResourceList adds the resources in new to list
+func addResourceList(list, new corev1.ResourceList) {
+	for name, quantity := range new {
+		if value, ok := list[name]; !ok {
+			list[name] = quantity.DeepCopy()
+		} else {
+			value.Add(quantity)
+			list[name] = value
+		}
+	}
+}
+
+// maxResourceList sets list to the greater of list and new for every resource in new
+func maxResourceList(list, new corev1.ResourceList) {
+	for name, quantity := range new {
+		if value, ok := list[name]; !ok || quantity.Cmp(value) > 0 {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// nodeFitsRequests reports whether the node's allocatable can hold the requests at all,
+// pods already running on the node are not accounted
+func nodeFitsRequests(node *corev1.Node, reqs corev1.ResourceList) bool {
+	for name, quantity := range reqs {
+		allocatable, ok := node.Status.Allocatable[name]
+		if !ok {
+			// extended resources the node does not report can not be judged here
+			continue
+		}
+
+		if quantity.Cmp(allocatable) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseRequestFactor parses a factor the requests of spot pods are scaled by, in (0, 1]
+func parseRequestFactor(val string) (float64, error) {
+	factor, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if factor <= 0 || factor > 1 {
+		return 0, fmt.Errorf("factor must be in (0, 1], got %v", factor)
+	}
+
+	return factor, nil
+}
+
+// scaleQuantity the quantity scaled by the factor, rounded up to the milli unit for cpu and to the unit otherwise
+func scaleQuantity(name corev1.ResourceName, quantity resource.Quantity, factor float64) resource.Quantity {
+	if name == corev1.ResourceCPU {
+		return *resource.NewMilliQuantity(int64(math.Ceil(float64(quantity.MilliValue())*factor)), quantity.Format)
+	}
+	return *resource.NewQuantity(int64(math.Ceil(float64(quantity.Value())*factor)), quantity.Format)
+}
+
+// scaleContainerRequests scales the requests of the containers by the factors, reports whether any changed,
+// containers without a request of a resource are left without it
+func scaleContainerRequests(containers []corev1.Container, factors map[corev1.ResourceName]float64) bool {
+	changed := false
+	for ci := range containers {
+		for name, factor := range factors {
+			quantity, ok := containers[ci].Resources.Requests[name]
+			if !ok || factor == 1 {
+				continue
+			}
+
+			containers[ci].Resources.Requests[name] = scaleQuantity(name, quantity, factor)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// spotRequestsPatch the patch scaling down the requests of a pod bound to spot by the spot request factors,
+// the whole container lists are written so the merged patch mode can compose them
+func (app *App) spotRequestsPatch(pod *corev1.Pod) ([]JSONPatchEntry, error) {
+	if len(app.spotRequestFactors) == 0 {
+		return nil, nil
+	}
+
+	spec := pod.Spec.DeepCopy()
+
+	var patch []JSONPatchEntry
+	for _, list := range []struct {
+		path       string
+		containers []corev1.Container
+	}{
+		{path: "/spec/containers", containers: spec.Containers},
+		{path: "/spec/initContainers", containers: spec.InitContainers},
+	} {
+		if !scaleContainerRequests(list.containers, app.spotRequestFactors) {
+			continue
+		}
+
+		value, err := json.Marshal(list.containers)
+		if err != nil {
+			return nil, internalErrorf("marshal %s: %v", list.path, err)
+		}
+
+		patch = append(patch, JSONPatchEntry{
+			OP:    "add",
+			Path:  list.path,
+			Value: value,
+		})
+	}
+
+	if len(patch) > 0 {
+		klog.Infof("pod %s/%s bound to %s, requests scaled by %v", pod.Namespace, pod.Name, spotKey, app.spotRequestFactors)
+	}
+
+	return patch, nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// requestingPod the created pod of web requesting the cpu, with the cpu overhead unless it is empty
+func requestingPod(cpu, overhead string) *corev1.Pod {
+	pod := testCreatedPod("web")
+	pod.Spec.Containers[0].Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}
+
+	runtimeClass := "kata"
+	pod.Spec.RuntimeClassName = &runtimeClass
+	if overhead != "" {
+		pod.Spec.Overhead = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(overhead)}
+	}
+	return pod
+}
+
+func TestPodRequestsOverhead(t *testing.T) {
+	tests := []struct {
+		name     string
+		overhead string
+		want     string
+	}{
+		{name: "without overhead", want: "900m"},
+		{name: "with overhead", overhead: "200m", want: "1100m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu := podRequests(requestingPod("900m", tt.overhead))[corev1.ResourceCPU]
+			if want := resource.MustParse(tt.want); cpu.Cmp(want) != 0 {
+				t.Errorf("cpu requests %s, want %s", cpu.String(), tt.want)
+			}
+		})
+	}
+}
+
+// the overhead decides whether the on-demand node can hold the pod
+func TestPlacementSatisfiableOverhead(t *testing.T) {
+	tests := []struct {
+		name     string
+		overhead string
+		pinned   bool
+	}{
+		{name: "without overhead fits", pinned: true},
+		{name: "with overhead does not fit", overhead: "200m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := testNode("od-1", ondemandKey)
+			node.Status.Allocatable = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}
+
+			app := newTestApp(t, node)
+			setMinimums(app, 1, 0)
+			app.validateNodeAffinity = true
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, requestingPod("900m", tt.overhead)))
+			if _, ok := findPatch(patchOf(t, resp), "/spec/nodeSelector"); ok != tt.pinned {
+				t.Errorf("nodeSelector patched %v, want %v: %s", ok, tt.pinned, resp.Patch)
+			}
+		})
+	}
+}
+
+func TestSpotRequestFactors(t *testing.T) {
+	spotPod := func() *corev1.Pod {
+		pod := testCreatedPod("web")
+		pod.Labels[capacityLabel] = spotKey
+		pod.Spec.Containers[0].Resources.Requests = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "sidecar", Image: "envoy"})
+		pod.Spec.InitContainers = []corev1.Container{{
+			Name:      "init",
+			Image:     "busybox",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")}},
+		}}
+		return pod
+	}
+
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	app.spotRequestFactors = map[corev1.ResourceName]float64{corev1.ResourceCPU: 0.5, corev1.ResourceMemory: 0.75}
+
+	pod := spotPod()
+	patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+
+	requests := patched.Spec.Containers[0].Resources.Requests
+	if cpu := requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("500m")) != 0 {
+		t.Errorf("cpu request %s, want 500m", cpu.String())
+	}
+	if memory := requests[corev1.ResourceMemory]; memory.Cmp(resource.MustParse("768Mi")) != 0 {
+		t.Errorf("memory request %s, want 768Mi", memory.String())
+	}
+	if sidecar := patched.Spec.Containers[1].Resources.Requests; len(sidecar) != 0 {
+		t.Errorf("sidecar without requests got %v", sidecar)
+	}
+	if cpu := patched.Spec.InitContainers[0].Resources.Requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("125m")) != 0 {
+		t.Errorf("init container cpu request %s, want 125m", cpu.String())
+	}
+
+	// pods bound to on-demand and pods without requests are left as they are
+	onDemand := spotPod()
+	onDemand.Labels[capacityLabel] = ondemandKey
+	withoutRequests := testCreatedPod("web")
+	withoutRequests.Labels[capacityLabel] = spotKey
+	for name, pod := range map[string]*corev1.Pod{"on-demand": onDemand, "without requests": withoutRequests} {
+		patch := patchOf(t, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+		for _, path := range []string{"/spec/containers", "/spec/initContainers"} {
+			if _, ok := findPatch(patch, path); ok {
+				t.Errorf("%s pod: %s patched", name, path)
+			}
+		}
+	}
+}
+
+func TestParseRequestFactor(t *testing.T) {
+	for val, valid := range map[string]bool{"0.5": true, "1": true, "0": false, "1.5": false, "-0.5": false, "half": false} {
+		if _, err := parseRequestFactor(val); (err == nil) != valid {
+			t.Errorf("parse %q: error %v, want valid %v", val, err, valid)
+		}
+	}
+}
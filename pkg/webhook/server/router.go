@@ -1,10 +1,43 @@
 package server
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultMutatePath   = "/mutate"
+	defaultValidatePath = "/validate"
 )
 
+// fixedPaths the paths of the endpoints which are not configurable
+var fixedPaths = []string{"/metrics", "/healthz", "/readyz", "/version", "/config", "/debug/count"}
+
+// parseAdmissionPaths checks the mutate and validate paths are absolute and do not shadow another endpoint
+func parseAdmissionPaths(mutatePath, validatePath string) error {
+	for _, path := range []string{mutatePath, validatePath} {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid path %q, must start with /", path)
+		}
+
+		for _, fixed := range fixedPaths {
+			if path == fixed {
+				return fmt.Errorf("invalid path %q, it is served by another endpoint", path)
+			}
+		}
+	}
+
+	if mutatePath == validatePath {
+		return fmt.Errorf("MUTATE_PATH and VALIDATE_PATH must differ, both are %q", mutatePath)
+	}
+
+	return nil
+}
+
 // BuildRouter builds the router
 func BuildRouter(app *App) *chi.Mux {
 	r := chi.NewRouter()
@@ -14,7 +47,21 @@ func BuildRouter(app *App) *chi.Mux {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Post("/mutate", app.HandleMutate)
+	// a panic of an admission handler is answered with an AdmissionReview, the other endpoints are left to Recoverer,
+	// a follower of the leader election forwards the admission requests to the leader
+	admission := r.With(app.recoverAdmission, app.forwardToLeader)
+	admission.Post(app.mutatePath, app.HandleMutate)
+	admission.Post(app.validatePath, app.HandleValidate)
+	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/healthz", app.HandleHealthz)
+	r.Get("/readyz", app.HandleReadyz)
+	r.Get("/version", app.HandleVersion)
+	if app.configEndpoint {
+		r.Get("/config", app.HandleConfig)
+	}
+	if app.debugEndpoints {
+		r.Get("/debug/count", app.HandleDebugCount)
+	}
 
 	return r
 }
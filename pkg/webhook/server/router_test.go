@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestConfiguredAdmissionPaths(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey))
+	setMinimums(app, 1, 0)
+	app.mutatePath = "/mutate/pods"
+	app.validatePath = "/validate/pods"
+	router := BuildRouter(app)
+
+	review := podReview(t, admissionv1.Create, testCreatedPod("web"))
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("marshal review: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		review bool
+	}{
+		{path: "/mutate/pods", review: true},
+		{path: "/validate/pods", review: true},
+		{path: defaultMutatePath},
+		{path: defaultValidatePath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body)))
+
+			if !tt.review {
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("answered %d at an unconfigured path, want 404", rec.Code)
+				}
+				return
+			}
+
+			resp := &admissionv1.AdmissionReview{}
+			if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), resp) != nil || resp.Response == nil {
+				t.Fatalf("answered %d without an AdmissionReview: %s", rec.Code, rec.Body)
+			}
+			if resp.Response.UID != review.Request.UID {
+				t.Errorf("response UID %q, want the request's %q", resp.Response.UID, review.Request.UID)
+			}
+		})
+	}
+}
+
+func TestParseAdmissionPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		mutatePath   string
+		validatePath string
+		valid        bool
+	}{
+		{name: "defaults", mutatePath: defaultMutatePath, validatePath: defaultValidatePath, valid: true},
+		{name: "nested", mutatePath: "/mutate/pods", validatePath: "/validate/pods", valid: true},
+		{name: "relative", mutatePath: "mutate", validatePath: defaultValidatePath},
+		{name: "shadows metrics", mutatePath: "/metrics", validatePath: defaultValidatePath},
+		{name: "same path", mutatePath: "/pods", validatePath: "/pods"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := parseAdmissionPaths(tt.mutatePath, tt.validatePath); (err == nil) != tt.valid {
+				t.Errorf("parseAdmissionPaths(%q, %q) = %v, want valid %v", tt.mutatePath, tt.validatePath, err, tt.valid)
+			}
+		})
+	}
+}
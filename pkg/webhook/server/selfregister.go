@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// the MutatingWebhookConfiguration deploy.sh registers, self-registration takes it over
+	defaultWebhookConfigurationName = "demo-webhook"
+	defaultWebhookServiceName       = "webhook-server"
+	defaultWebhookServiceNamespace  = "mix-scheduler-system"
+	defaultWebhookCAFile            = "ca.crt"
+
+	// the namespace the webhook is never called for, its pods run the cluster
+	kubeSystemNamespace = "kube-system"
+)
+
+// webhookRegistration keeps the MutatingWebhookConfiguration of the webhook in sync with its CA bundle,
+// so a rotated certificate does not leave the API server with a stale one, a configuration deleted or
+// changed by someone else, e.g. a replica shutting down with SELF_REGISTER_CLEANUP, is restored as well
+type webhookRegistration struct {
+	client kubernetes.Interface
+
+	name             string
+	serviceName      string
+	serviceNamespace string
+	path             string
+	caPath           string
+	// namespaces the API server never sends, the notControllerNamespace of the env
+	excludedNamespaces []string
+	timeout            time.Duration
+	// whether the replica re-applies the configuration, nil for every replica
+	leading func() bool
+}
+
+// configuration the MutatingWebhookConfiguration with the CA bundle, as deployment.yaml.template registers it
+func (r *webhookRegistration) configuration(caBundle []byte) *admissionregistrationv1.MutatingWebhookConfiguration {
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	scope := admissionregistrationv1.NamespacedScope
+	path := r.path
+
+	webhook := admissionregistrationv1.MutatingWebhook{
+		Name:                    r.serviceName + "." + r.serviceNamespace + ".svc",
+		SideEffects:             &sideEffects,
+		AdmissionReviewVersions: []string{"v1", "v1beta1"},
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Name:      r.serviceName,
+				Namespace: r.serviceNamespace,
+				Path:      &path,
+			},
+			CABundle: caBundle,
+		},
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      "kubernetes.io/metadata.name",
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   r.namespacesExcluded(),
+				},
+			},
+		},
+		Rules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Delete},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"*"},
+					Resources:   []string{"pods"},
+					Scope:       &scope,
+				},
+			},
+			{
+				// the eviction guard, EVICTION_GUARD_POLICY ignore allows them all
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods/eviction"},
+					Scope:       &scope,
+				},
+			},
+			{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{"apps"},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"deployments", "statefulsets"},
+					Scope:       &scope,
+				},
+			},
+		},
+	}
+
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: r.name},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{webhook},
+	}
+}
+
+// namespacesExcluded the namespaces the API server never sends, kube-system and the webhook's own namespace
+// are always among them like in deployment.yaml.template, so the webhook never blocks its own pods
+func (r *webhookRegistration) namespacesExcluded() []string {
+	excluded := map[string]struct{}{
+		kubeSystemNamespace: {},
+		r.serviceNamespace:  {},
+	}
+	for _, ns := range r.excludedNamespaces {
+		excluded[ns] = struct{}{}
+	}
+
+	namespaces := make([]string, 0, len(excluded))
+	for ns := range excluded {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces
+}
+
+// webhookDrifted reports whether the existing configuration differs from the desired one in a field
+// the registration sets, the fields the API server defaults are not compared
+func webhookDrifted(existing, desired *admissionregistrationv1.MutatingWebhookConfiguration) bool {
+	if len(existing.Webhooks) != len(desired.Webhooks) {
+		return true
+	}
+
+	for i := range desired.Webhooks {
+		have, want := existing.Webhooks[i], desired.Webhooks[i]
+		if have.Name != want.Name ||
+			!equality.Semantic.DeepEqual(have.ClientConfig, want.ClientConfig) ||
+			!equality.Semantic.DeepEqual(have.Rules, want.Rules) ||
+			!equality.Semantic.DeepEqual(have.NamespaceSelector, want.NamespaceSelector) ||
+			!equality.Semantic.DeepEqual(have.AdmissionReviewVersions, want.AdmissionReviewVersions) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply creates the MutatingWebhookConfiguration when it is missing and updates it when it drifted,
+// e.g. the CA bundle was rotated or it was edited by hand
+func (r *webhookRegistration) apply(ctx context.Context) error {
+	caBundle, err := os.ReadFile(r.caPath)
+	if err != nil {
+		return fmt.Errorf("read ca bundle: %v", err)
+	}
+	if len(caBundle) == 0 {
+		return fmt.Errorf("ca bundle %s is empty", r.caPath)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	config := r.configuration(caBundle)
+	configurations := r.client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+
+	existing, err := configurations.Get(ctx, r.name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := configurations.Create(ctx, config, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("create mutatingwebhookconfiguration %s: %v", r.name, err)
+		}
+	case err != nil:
+		return fmt.Errorf("get mutatingwebhookconfiguration %s: %v", r.name, err)
+	case !webhookDrifted(existing, config):
+		return nil
+	default:
+		config.ResourceVersion = existing.ResourceVersion
+		if _, err := configurations.Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("update mutatingwebhookconfiguration %s: %v", r.name, err)
+		}
+	}
+
+	klog.Infof("registered mutatingwebhookconfiguration %s with ca bundle %s", r.name, r.caPath)
+	return nil
+}
+
+// Run re-applies the MutatingWebhookConfiguration every interval until stopCh is closed,
+// an update only happens when it is missing or drifted and only the leading replica makes it
+func (r *webhookRegistration) Run(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := r.reconcile(context.Background()); err != nil {
+				klog.Errorf("self register: %v", err)
+			}
+		}
+	}
+}
+
+// reconcile applies the configuration on the leading replica, the replicas would otherwise race on its updates
+func (r *webhookRegistration) reconcile(ctx context.Context) error {
+	if r.leading != nil && !r.leading() {
+		return nil
+	}
+
+	return r.apply(ctx)
+}
+
+// unregister deletes the MutatingWebhookConfiguration, so the API server stops calling the webhook,
+// the replicas still running restore it within their interval
+func (r *webhookRegistration) unregister(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := r.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Delete(ctx, r.name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete mutatingwebhookconfiguration %s: %v", r.name, err)
+	}
+
+	klog.Infof("unregistered mutatingwebhookconfiguration %s", r.name)
+	return nil
+}
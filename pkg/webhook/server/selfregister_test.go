@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestRegistration a webhookRegistration on a fake clientset with the CA bundle in a temporary file
+func newTestRegistration(t *testing.T, caBundle string) (*webhookRegistration, *fake.Clientset) {
+	t.Helper()
+
+	caPath := filepath.Join(t.TempDir(), defaultWebhookCAFile)
+	if err := os.WriteFile(caPath, []byte(caBundle), 0o600); err != nil {
+		t.Fatalf("write ca bundle: %v", err)
+	}
+
+	client := fake.NewSimpleClientset()
+	return &webhookRegistration{
+		client:             client,
+		name:               defaultWebhookConfigurationName,
+		serviceName:        defaultWebhookServiceName,
+		serviceNamespace:   defaultWebhookServiceNamespace,
+		path:               defaultMutatePath,
+		caPath:             caPath,
+		excludedNamespaces: []string{"monitoring"},
+		timeout:            time.Second,
+	}, client
+}
+
+func getConfiguration(t *testing.T, r *webhookRegistration) *admissionregistrationv1.MutatingWebhookConfiguration {
+	t.Helper()
+
+	config, err := r.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.Background(), r.name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get configuration: %v", err)
+	}
+	return config
+}
+
+// countActions the actions of the verb on mutatingwebhookconfigurations
+func countActions(client *fake.Clientset, verb string) int {
+	n := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == verb && action.GetResource().Resource == "mutatingwebhookconfigurations" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSelfRegisterApply(t *testing.T) {
+	r, client := newTestRegistration(t, "ca-1")
+
+	if err := r.apply(context.Background()); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	config := getConfiguration(t, r)
+	if len(config.Webhooks) != 1 {
+		t.Fatalf("%d webhooks, want 1", len(config.Webhooks))
+	}
+	webhook := config.Webhooks[0]
+	if string(webhook.ClientConfig.CABundle) != "ca-1" {
+		t.Errorf("ca bundle %q, want ca-1", webhook.ClientConfig.CABundle)
+	}
+
+	excluded := webhook.NamespaceSelector.MatchExpressions[0]
+	want := []string{"kube-system", "mix-scheduler-system", "monitoring"}
+	if excluded.Operator != metav1.LabelSelectorOpNotIn || !equalStrings(excluded.Values, want) {
+		t.Errorf("namespace selector %v %v, want NotIn %v", excluded.Operator, excluded.Values, want)
+	}
+
+	eviction := false
+	for _, rule := range webhook.Rules {
+		for _, resource := range rule.Resources {
+			if resource == "pods/eviction" {
+				eviction = len(rule.Operations) == 1 && rule.Operations[0] == admissionregistrationv1.Create
+			}
+		}
+	}
+	if !eviction {
+		t.Errorf("no pods/eviction CREATE rule in %v", webhook.Rules)
+	}
+
+	// unchanged, nothing is updated
+	if err := r.apply(context.Background()); err != nil {
+		t.Fatalf("apply unchanged: %v", err)
+	}
+	if n := countActions(client, "update"); n != 0 {
+		t.Errorf("%d updates of an unchanged configuration, want 0", n)
+	}
+}
+
+func TestSelfRegisterExcludesKubeSystemWithoutNamespaces(t *testing.T) {
+	r, _ := newTestRegistration(t, "ca-1")
+	r.excludedNamespaces = nil
+
+	want := []string{"kube-system", "mix-scheduler-system"}
+	if got := r.namespacesExcluded(); !equalStrings(got, want) {
+		t.Errorf("namespaces excluded %v, want %v", got, want)
+	}
+}
+
+func TestSelfRegisterRestoresDeleted(t *testing.T) {
+	r, client := newTestRegistration(t, "ca-1")
+	if err := r.apply(context.Background()); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	// another replica shutting down with SELF_REGISTER_CLEANUP
+	if err := r.unregister(context.Background()); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+
+	if err := r.apply(context.Background()); err != nil {
+		t.Fatalf("apply after delete: %v", err)
+	}
+	if n := countActions(client, "create"); n != 2 {
+		t.Errorf("%d creates, want the deleted configuration re-created", n)
+	}
+	getConfiguration(t, r)
+}
+
+func TestSelfRegisterUpdatesDrifted(t *testing.T) {
+	tests := []struct {
+		name  string
+		drift func(t *testing.T, r *webhookRegistration, config *admissionregistrationv1.MutatingWebhookConfiguration)
+	}{
+		{
+			name: "rotated ca bundle",
+			drift: func(t *testing.T, r *webhookRegistration, _ *admissionregistrationv1.MutatingWebhookConfiguration) {
+				if err := os.WriteFile(r.caPath, []byte("ca-2"), 0o600); err != nil {
+					t.Fatalf("rotate ca bundle: %v", err)
+				}
+			},
+		},
+		{
+			name: "rules edited by hand",
+			drift: func(_ *testing.T, _ *webhookRegistration, config *admissionregistrationv1.MutatingWebhookConfiguration) {
+				config.Webhooks[0].Rules = config.Webhooks[0].Rules[:1]
+			},
+		},
+		{
+			name: "namespace selector removed",
+			drift: func(_ *testing.T, _ *webhookRegistration, config *admissionregistrationv1.MutatingWebhookConfiguration) {
+				config.Webhooks[0].NamespaceSelector = nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, client := newTestRegistration(t, "ca-1")
+			if err := r.apply(context.Background()); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+
+			config := getConfiguration(t, r)
+			tt.drift(t, r, config)
+			if _, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(context.Background(), config, metav1.UpdateOptions{}); err != nil {
+				t.Fatalf("drift configuration: %v", err)
+			}
+			client.ClearActions()
+
+			if err := r.apply(context.Background()); err != nil {
+				t.Fatalf("apply drifted: %v", err)
+			}
+			if n := countActions(client, "update"); n != 1 {
+				t.Fatalf("%d updates, want 1", n)
+			}
+
+			caBundle, _ := os.ReadFile(r.caPath)
+			if webhookDrifted(getConfiguration(t, r), r.configuration(caBundle)) {
+				t.Errorf("configuration still drifted after apply")
+			}
+		})
+	}
+}
+
+func TestSelfRegisterGetError(t *testing.T) {
+	r, client := newTestRegistration(t, "ca-1")
+	client.PrependReactor("get", "mutatingwebhookconfigurations", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("apiserver unavailable")
+	})
+
+	if err := r.apply(context.Background()); err == nil {
+		t.Fatalf("apply succeeded on a failing get")
+	}
+	if n := countActions(client, "create"); n != 0 {
+		t.Errorf("%d creates after a failing get, want 0", n)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSelfRegisterReconcileOnlyLeading(t *testing.T) {
+	r, client := newTestRegistration(t, "ca-1")
+
+	leading := false
+	r.leading = func() bool { return leading }
+
+	if err := r.reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if n := countActions(client, "create"); n != 0 {
+		t.Fatalf("a follower created the configuration %d times", n)
+	}
+
+	leading = true
+	if err := r.reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	getConfiguration(t, r)
+}
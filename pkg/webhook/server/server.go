@@ -2,14 +2,28 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
+
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/informermanager"
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/version"
 )
 
 const (
@@ -19,15 +33,107 @@ const (
 )
 
 // env
+// BIND_ADDRESS (host to listen on, default all interfaces)
+// MUTATE_PATH (default /mutate), VALIDATE_PATH (default /validate)
 // PORT, mixSchedulerRequierd, notControllerNamespace, SPOT_NODE_WEIGHT, ONDEMAND_NODE_WEIGHT
+// ONDEMAND_MIN_PERCENT (0-100, percentage of a workload's pods created on on-demand, default 0)
+// TIERS (comma separated capacity:min filled in order, e.g. committed:2,on-demand, on-demand alone takes OnDemandMinPodNum, default on-demand)
+// MIN_REPLICAS_TO_ACT (workloads with fewer observed pods are left to the scheduler, default 0 acts on all)
+// CONTROLLED_NAMESPACES (comma separated allowlist, mutually exclusive with notControllerNamespace)
+// DRY_RUN
+// PATCH_MODE
+// PLACEMENT_MODE (nodeSelector|preferredAffinity|requiredAffinity)
+// NODE_WEIGHT_AFFINITY (prefer nodes by their spot/weight and on-demand/weight labels)
+// SPOT_CPU_REQUEST_FACTOR, SPOT_MEMORY_REQUEST_FACTOR (in (0, 1], requests of the pods pinned to spot are scaled by)
+// SPOT_TOLERATION_KEY, SPOT_TOLERATION_VALUE, SPOT_TOLERATION_EFFECT
+// FAILURE_POLICY (Ignore|Fail, default Fail, for internal errors)
+// SPOT_VALUES (comma separated capacity label values of the spot nodes, default spot)
+// UNLABELED_NODE_CAPACITY (on-demand|spot, capacity of the nodes without the capacity label, default none)
+// CACHE_SYNC_WAIT (how long a request waits for the informer cache, then it is allowed unchanged, default 0 lists live)
+// MAX_CONCURRENT_ADMISSIONS (admission requests processed at once, default 0 for no bound)
+// ADMISSION_QUEUE_WAIT (how long a request waits for a slot, default 1s, then it goes through FAILURE_POLICY)
+// CLIENT_TIMEOUT (deadline of each API server call, default 2s, a timeout goes through FAILURE_POLICY)
+// OVERFLOW_TO_SPOT (place the pods above the on-demand minimum on spot instead of leaving them to the scheduler)
+// STATEFULSET_ORDINAL_PLACEMENT (place StatefulSet pods by ordinal, those below the on-demand minimum on on-demand, the rest on spot)
+// CAPACITY_MODE (minimum|weighted, weighted reads the on-demand/weight and spot/weight pod labels)
+// EVICTION_GUARD_POLICY
+// CONTROLLED_NAMESPACE_SELECTOR (label selector, e.g. mix-scheduler=enabled)
+// CONTROLLED_NAMESPACE_DEFAULT (true|false, default false, for namespaces the selector can not be evaluated on)
+// CONTROLLED_POD_SELECTOR (label selector, e.g. tier in (web,api), pods not matching are not controlled)
+// NODE_AFFINITY_CONFLICT_POLICY (respect-affinity|override-with-selector|deny)
+// VALIDATE_NODE_AFFINITY, UNSATISFIABLE_AFFINITY_POLICY (fallback|deny)
+// VOLUME_NODE_AFFINITY_CHECK (default true)
+// TOPOLOGY_KEY (anti-affinity topology key, default kubernetes.io/hostname)
+// ANTI_AFFINITY_WEIGHT (1-100, default 100)
+// TOPOLOGY_SPREAD_POLICY (inject|skip-anti-affinity|reconcile)
+// EXCLUDE_CORDONED_FROM_FLOOR, COUNT_SIBLINGS_BY_OWNER
+// DRAIN_TAINT_KEYS (comma separated taint keys of draining nodes, default ToBeDeletedByClusterAutoscaler,karpenter.sh/disrupted)
+// NODE_NAME_POLICY (skip|reject)
+// EMPTY_CAPACITY_POLICY (prefer|skip|pin, default prefer, for pods whose capacity has no schedulable node)
+// ENFORCE_SCALE_DOWN_ORDER (default true, false allows every delete)
+// DELETE_GUARD_RESPECT_PDB (allow deletes the guard denies when the pod's PodDisruptionBudgets allow a disruption)
+// DELETE_GUARD_SKIP_PROPAGATION_POLICIES (comma separated Orphan,Background,Foreground)
+// ALLOW_SCALE_TO_ZERO_DELETE (default true)
+// SKIP_DAEMONSET_PODS (default true, false places and guards the pods of DaemonSets like any other)
+// READINESS_CONTAINERS (comma separated container names judging pod readiness)
+// PLACEMENT_RESERVATION_WINDOW (on-demand pins counted until their pods are cached, default 5s, 0 disables)
+// BURST_CREATE_THRESHOLD (creates of a workload within BURST_WINDOW relaxing the placement, 0 disables), BURST_WINDOW (default 10s)
+// ANNOTATION_TEMPLATE (comma separated key=value, ${ENV} is expanded)
+// OWNER_RESOLUTION_FAILURE (fall-back-to-labels|skip)
+// METRICS_WORKLOAD_ALLOWLIST (comma separated kind/name, e.g. Deployment/nginx)
+// METRICS_WORKLOAD_LIMIT (workloads labeled on the metrics without an allowlist, default 100, the others are "other")
+// OTEL_EXPORTER_OTLP_ENDPOINT (OTLP/HTTP collector the request traces are exported to, default none disables tracing)
+// CLOUDEVENTS_SINK (url), CLOUDEVENTS_MODE (binary|structured), CLOUDEVENTS_SOURCE
+// MAX_REQUEST_BYTES (default 3MB)
+// SLOW_REQUEST_THRESHOLD (requests taking longer are logged with their slowest phase, default 0 disables)
+// LATENCY_BUDGET (the webhook timeoutSeconds, default 10s), LATENCY_BUDGET_WARN_PERCENT (default 80)
+// SHUTDOWN_TIMEOUT (default 10s)
+// READYZ_CHECK_CERT, READYZ_CERT_EXPIRY_WINDOW (duration, not ready when the loaded serving cert expires within it)
+// ENABLE_CONFIG_ENDPOINT (serve the effective config on /config)
+// ENABLE_DEBUG_ENDPOINTS (serve the counts of a workload on /debug/count)
+// CONFIG_CONFIGMAP (name of a ConfigMap overriding OnDemandMinPodNum, SpotMinPodNum, notControllerNamespace,
+// CONTROLLED_NAMESPACES, CONTROLLED_NAMESPACE_SELECTOR and CONTROLLED_NAMESPACE_DEFAULT, reloaded on change), CONFIG_CONFIGMAP_NAMESPACE (default mix-scheduler-system)
+// ENABLE_LEADER_ELECTION (requires POD_IP), LEADER_ELECTION_LEASE_NAME, LEADER_ELECTION_NAMESPACE
+// INFORMER_RESYNC (duration, default 0 for no periodic resync)
+// INCREMENTAL_POD_COUNT (count the ready pods from the informer events)
+// INFORMER_SCOPE_PODS (do not cache the pods of notControllerNamespace, not with CONTROLLED_NAMESPACE_SELECTOR), INFORMER_POD_LABEL_SELECTOR
+// HTTP_READ_HEADER_TIMEOUT (default 5s), HTTP_READ_TIMEOUT (default 10s), HTTP_WRITE_TIMEOUT (default 9s), HTTP_IDLE_TIMEOUT (default 2m)
+// TLS_ENABLED (default true, false serves plain HTTP)
+// TLS_DIR, TLS_CERT_FILE, TLS_KEY_FILE, TLS_RELOAD_INTERVAL (default 1m)
+// SELF_REGISTER (create or update the MutatingWebhookConfiguration with the CA bundle TLS_DIR/TLS_CA_FILE, default ca.crt),
+// SELF_REGISTER_NAME (default demo-webhook), SELF_REGISTER_SERVICE (default webhook-server),
+// SELF_REGISTER_NAMESPACE (default mix-scheduler-system), SELF_REGISTER_CLEANUP (delete it on shutdown, default false)
 
 // StartServer starts the server
 func StartServer() error {
+	klog.Infof("mix-scheduler-admission-webhook %s", version.Get())
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8443"
 	}
 
+	// host to listen on, all interfaces when empty
+	bindAddress := os.Getenv("BIND_ADDRESS")
+	if bindAddress != "" && net.ParseIP(bindAddress) == nil {
+		if _, err := net.LookupHost(bindAddress); err != nil {
+			return fmt.Errorf("invalid BIND_ADDRESS %q: %v", bindAddress, err)
+		}
+	}
+
+	// e.g. /mutate/pods when webhooks share an ingress host
+	mutatePath := defaultMutatePath
+	if val := os.Getenv("MUTATE_PATH"); val != "" {
+		mutatePath = val
+	}
+	validatePath := defaultValidatePath
+	if val := os.Getenv("VALIDATE_PATH"); val != "" {
+		validatePath = val
+	}
+	if err := parseAdmissionPaths(mutatePath, validatePath); err != nil {
+		return err
+	}
+
 	// Enabled mix-scheduler
 	var mixSchedulerRequierd = true
 
@@ -35,22 +141,33 @@ func StartServer() error {
 		mixSchedulerRequierd = val == "true"
 	}
 
-	// notControllerNamespace
-	var notControllerNamespace map[string]struct{}
-	if val := os.Getenv("notControllerNamespace"); val != "" {
+	// log the patches without applying them
+	dryRun := os.Getenv("DRY_RUN") == "true"
 
-		notControllerNamespace = make(map[string]struct{})
-		for _, ns := range strings.Split(strings.TrimSpace(val), ",") {
-			notControllerNamespace[ns] = struct{}{}
-		}
-	} else {
-		// default notControllerNamespace
-		notControllerNamespace = map[string]struct{}{
-			"kube-system":          {},
-			"mix-scheduler-system": {},
+	// notControllerNamespace denylist or CONTROLLED_NAMESPACES allowlist
+	notControllerNamespace, controlledNamespaces, err := namespaceListsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// namespace label selector, the namespace annotation mix-scheduler-admission-webhook takes precedence
+	var namespaceSelector labels.Selector
+	if val := os.Getenv("CONTROLLED_NAMESPACE_SELECTOR"); val != "" {
+		selector, err := labels.Parse(val)
+		if err != nil {
+			return fmt.Errorf("parse CONTROLLED_NAMESPACE_SELECTOR: %v", err)
 		}
+		namespaceSelector = selector
 	}
 
+	controlledPodSelector, err := controlledPodSelectorFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// the namespace can not be read, e.g. created after the cache synced and not yet seen
+	namespaceSelectorDefault := os.Getenv("CONTROLLED_NAMESPACE_DEFAULT") == "true"
+
 	onDemandMinPodNum := 1
 
 	if val := os.Getenv("OnDemandMinPodNum"); val != "" {
@@ -61,6 +178,32 @@ func StartServer() error {
 		onDemandMinPodNum = num
 	}
 
+	// percentage of a workload's pods kept on on-demand, on top of the absolute minimum
+	ondemandMinPercent := 0
+	if val := os.Getenv("ONDEMAND_MIN_PERCENT"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("parse ONDEMAND_MIN_PERCENT: %v", err)
+		}
+		if num < 0 || num > 100 {
+			return fmt.Errorf("ONDEMAND_MIN_PERCENT must be between 0 and 100, got %d", num)
+		}
+		ondemandMinPercent = num
+	}
+
+	// the replicas are counted from the observed siblings, the intended replicas are unknown at create time
+	minReplicasToAct := 0
+	if val := os.Getenv("MIN_REPLICAS_TO_ACT"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("parse MIN_REPLICAS_TO_ACT: %v", err)
+		}
+		if num < 0 {
+			return fmt.Errorf("MIN_REPLICAS_TO_ACT must not be negative, got %d", num)
+		}
+		minReplicasToAct = num
+	}
+
 	spotMinPodNum := 1
 
 	if val := os.Getenv("SpotMinPodNum"); val != "" {
@@ -71,34 +214,975 @@ func StartServer() error {
 		spotMinPodNum = num
 	}
 
-	app, err := NewDefaultApp(context.Background())
+	nodeAffinityConflictPolicy := nodeAffinityConflictRespectAffinity
+
+	if val := os.Getenv("NODE_AFFINITY_CONFLICT_POLICY"); val != "" {
+		policy, err := parseNodeAffinityConflictPolicy(val)
+		if err != nil {
+			return err
+		}
+		nodeAffinityConflictPolicy = policy
+	}
+
+	validateNodeAffinity := os.Getenv("VALIDATE_NODE_AFFINITY") == "true"
+
+	unsatisfiableAffinityPolicy := unsatisfiableAffinityFallback
+
+	if val := os.Getenv("UNSATISFIABLE_AFFINITY_POLICY"); val != "" {
+		policy, err := parseUnsatisfiableAffinityPolicy(val)
+		if err != nil {
+			return err
+		}
+		unsatisfiableAffinityPolicy = policy
+	}
+
+	checkVolumeNodeAffinity := true
+
+	if val := os.Getenv("VOLUME_NODE_AFFINITY_CHECK"); val != "" {
+		checkVolumeNodeAffinity = val == "true"
+	}
+
+	antiAffinityTopologyKey := hostnameTopologyKey
+
+	if val := os.Getenv("TOPOLOGY_KEY"); val != "" {
+		antiAffinityTopologyKey = val
+	}
+
+	var antiAffinityWeight int32 = 100
+
+	if val := os.Getenv("ANTI_AFFINITY_WEIGHT"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		if num < 1 || num > 100 {
+			return fmt.Errorf("ANTI_AFFINITY_WEIGHT must be in the range 1-100, got %d", num)
+		}
+		antiAffinityWeight = int32(num)
+	}
+
+	topologySpreadPolicy := topologySpreadInject
+
+	if val := os.Getenv("TOPOLOGY_SPREAD_POLICY"); val != "" {
+		policy, err := parseTopologySpreadPolicy(val)
+		if err != nil {
+			return err
+		}
+		topologySpreadPolicy = policy
+	}
+
+	nodeNamePolicy := nodeNameSkip
+
+	if val := os.Getenv("NODE_NAME_POLICY"); val != "" {
+		policy, err := parseNodeNamePolicy(val)
+		if err != nil {
+			return err
+		}
+		nodeNamePolicy = policy
+	}
+
+	emptyCapacityPolicy := emptyCapacityPrefer
+
+	if val := os.Getenv("EMPTY_CAPACITY_POLICY"); val != "" {
+		policy, err := parseEmptyCapacityPolicy(val)
+		if err != nil {
+			return err
+		}
+		emptyCapacityPolicy = policy
+	}
+
+	patchMode := patchModeJSONPatch
+
+	if val := os.Getenv("PATCH_MODE"); val != "" {
+		mode, err := parsePatchMode(val)
+		if err != nil {
+			return err
+		}
+		patchMode = mode
+	}
+
+	placementMode := placementNodeSelector
+
+	if val := os.Getenv("PLACEMENT_MODE"); val != "" {
+		mode, err := parsePlacementMode(val)
+		if err != nil {
+			return err
+		}
+		placementMode = mode
+	}
+
+	// toleration of the spot taint
+	var spotToleration *corev1.Toleration
+	if key := os.Getenv("SPOT_TOLERATION_KEY"); key != "" {
+		effect, err := parseTaintEffect(os.Getenv("SPOT_TOLERATION_EFFECT"))
+		if err != nil {
+			return err
+		}
+		spotToleration = newSpotToleration(key, os.Getenv("SPOT_TOLERATION_VALUE"), effect)
+	}
+
+	failurePolicy := failurePolicyFail
+
+	if val := os.Getenv("FAILURE_POLICY"); val != "" {
+		policy, err := parseFailurePolicy(val)
+		if err != nil {
+			return err
+		}
+		failurePolicy = policy
+	}
+
+	capacityMode := capacityMinimum
+
+	if val := os.Getenv("CAPACITY_MODE"); val != "" {
+		mode, err := parseCapacityMode(val)
+		if err != nil {
+			return err
+		}
+		capacityMode = mode
+	}
+
+	evictionGuardPolicy := evictionGuardIgnore
+
+	if val := os.Getenv("EVICTION_GUARD_POLICY"); val != "" {
+		policy, err := parseEvictionGuardPolicy(val)
+		if err != nil {
+			return err
+		}
+		evictionGuardPolicy = policy
+	}
+
+	excludeCordonedFromFloor := os.Getenv("EXCLUDE_CORDONED_FROM_FLOOR") == "true"
+
+	// nodes tainted by a scale down are drained like cordoned ones
+	drainTaintKeys := parseDrainTaintKeys(defaultDrainTaintKeys)
+	if val, ok := os.LookupEnv("DRAIN_TAINT_KEYS"); ok {
+		drainTaintKeys = parseDrainTaintKeys(val)
+	}
+
+	// siblings are the pods of the same controller, pods without one fall back to their labels
+	countSiblingsByOwner := os.Getenv("COUNT_SIBLINGS_BY_OWNER") == "true"
+
+	// delete propagation policies the scale down guard does not apply to
+	deleteGuardSkipPropagationPolicies := make(map[metav1.DeletionPropagation]struct{})
+	if val := os.Getenv("DELETE_GUARD_SKIP_PROPAGATION_POLICIES"); val != "" {
+		for _, policy := range strings.Split(strings.TrimSpace(val), ",") {
+			switch p := metav1.DeletionPropagation(policy); p {
+			case metav1.DeletePropagationOrphan, metav1.DeletePropagationBackground, metav1.DeletePropagationForeground:
+				deleteGuardSkipPropagationPolicies[p] = struct{}{}
+			default:
+				return fmt.Errorf("invalid propagation policy %q in DELETE_GUARD_SKIP_PROPAGATION_POLICIES", policy)
+			}
+		}
+	}
+
+	// the DaemonSet controller binds its pods to their nodes, a capacity pin could only make them unschedulable
+	skipDaemonSetPods := true
+
+	if val := os.Getenv("SKIP_DAEMONSET_PODS"); val != "" {
+		skipDaemonSetPods = val == "true"
+	}
+
+	allowScaleToZeroDelete := true
+
+	if val := os.Getenv("ALLOW_SCALE_TO_ZERO_DELETE"); val != "" {
+		allowScaleToZeroDelete = val == "true"
+	}
+
+	// containers judging pod readiness, empty for the pod Ready condition
+	readinessContainers := make(map[string]struct{})
+	if val := os.Getenv("READINESS_CONTAINERS"); val != "" {
+		for _, name := range strings.Split(strings.TrimSpace(val), ",") {
+			readinessContainers[name] = struct{}{}
+		}
+	}
+
+	// relax the placement during create bursts
+	burstCreateThreshold := 0
+
+	if val := os.Getenv("BURST_CREATE_THRESHOLD"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("parse BURST_CREATE_THRESHOLD: %v", err)
+		}
+		burstCreateThreshold = num
+	}
+
+	// wait for the informer cache instead of listing from the API server during startup
+	var cacheSyncWait time.Duration
+	if val := os.Getenv("CACHE_SYNC_WAIT"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse CACHE_SYNC_WAIT: %v", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("CACHE_SYNC_WAIT must not be negative, got %v", d)
+		}
+		cacheSyncWait = d
+	}
+
+	// the scale down guard on deletes, false only mutates creates
+	enforceScaleDownOrder := true
+	if val := os.Getenv("ENFORCE_SCALE_DOWN_ORDER"); val != "" {
+		enforce, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("parse ENFORCE_SCALE_DOWN_ORDER: %v", err)
+		}
+		enforceScaleDownOrder = enforce
+	}
+
+	// admission requests processed at once, 0 for no bound
+	maxConcurrentAdmissions := 0
+	if val := os.Getenv("MAX_CONCURRENT_ADMISSIONS"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("parse MAX_CONCURRENT_ADMISSIONS: %v", err)
+		}
+		if num < 0 {
+			return fmt.Errorf("MAX_CONCURRENT_ADMISSIONS must not be negative, got %d", num)
+		}
+		maxConcurrentAdmissions = num
+	}
+
+	admissionQueueWait := time.Second
+	if val := os.Getenv("ADMISSION_QUEUE_WAIT"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse ADMISSION_QUEUE_WAIT: %v", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("ADMISSION_QUEUE_WAIT must not be negative, got %v", d)
+		}
+		admissionQueueWait = d
+	}
+
+	// prefer the heavier node pools by the spot/weight and on-demand/weight node labels
+	nodeWeightAffinity := os.Getenv("NODE_WEIGHT_AFFINITY") == "true"
+
+	// over-subscribe spot, the requests of the pods pinned to spot are scaled down
+	var spotRequestFactors map[corev1.ResourceName]float64
+	for env, name := range map[string]corev1.ResourceName{
+		"SPOT_CPU_REQUEST_FACTOR":    corev1.ResourceCPU,
+		"SPOT_MEMORY_REQUEST_FACTOR": corev1.ResourceMemory,
+	} {
+		if val := os.Getenv(env); val != "" {
+			factor, err := parseRequestFactor(val)
+			if err != nil {
+				return fmt.Errorf("parse %s: %v", env, err)
+			}
+			if spotRequestFactors == nil {
+				spotRequestFactors = make(map[corev1.ResourceName]float64)
+			}
+			spotRequestFactors[name] = factor
+		}
+	}
+
+	// the scale down guard gives way to the PodDisruptionBudgets of the pod
+	deleteGuardRespectPDB := os.Getenv("DELETE_GUARD_RESPECT_PDB") == "true"
+
+	// the pods above the on-demand minimum are pinned to spot
+	overflowToSpot := os.Getenv("OVERFLOW_TO_SPOT") == "true"
+
+	// the pods of a StatefulSet are placed by their ordinal instead of the live counts
+	statefulSetOrdinalPlacement := os.Getenv("STATEFULSET_ORDINAL_PLACEMENT") == "true"
+
+	// capacity label values of the spot nodes
+	spotValues := []string{spotKey}
+	if val := os.Getenv("SPOT_VALUES"); val != "" {
+		values, err := parseSpotValues(val)
+		if err != nil {
+			return fmt.Errorf("parse SPOT_VALUES: %v", err)
+		}
+		spotValues = values
+	}
+
+	// the capacities filled by minimum in order, spot is what is left
+	tiers := defaultTiers()
+	if val := os.Getenv("TIERS"); val != "" {
+		parsed, err := parseTiers(val, spotValues)
+		if err != nil {
+			return fmt.Errorf("parse TIERS: %v", err)
+		}
+		tiers = parsed
+	}
+
+	// capacity the nodes without the capacity label count for
+	unlabeledNodeCapacity := os.Getenv("UNLABELED_NODE_CAPACITY")
+	switch unlabeledNodeCapacity {
+	case "", ondemandKey, spotKey:
+	default:
+		return fmt.Errorf("invalid UNLABELED_NODE_CAPACITY %q, must be one of %s|%s", unlabeledNodeCapacity, ondemandKey, spotKey)
+	}
+
+	// deadline of each call to the API server
+	clientTimeout := 2 * time.Second
+	if val := os.Getenv("CLIENT_TIMEOUT"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse CLIENT_TIMEOUT: %v", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("CLIENT_TIMEOUT must be positive, got %v", d)
+		}
+		clientTimeout = d
+	}
+
+	// on-demand pins counted until their pods reach the cache, 0 disables
+	reservationWindow := defaultReservationWindow
+	if val := os.Getenv("PLACEMENT_RESERVATION_WINDOW"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse PLACEMENT_RESERVATION_WINDOW: %v", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("PLACEMENT_RESERVATION_WINDOW must not be negative, got %v", d)
+		}
+		reservationWindow = d
+	}
+
+	burstWindow, err := positiveDurationFromEnv("BURST_WINDOW", 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	// annotations added to every controlled pod
+	var annotationTemplate, annotationTemplateRaw map[string]string
+	if val := os.Getenv("ANNOTATION_TEMPLATE"); val != "" {
+		annotations, err := parseAnnotationTemplate(val)
+		if err != nil {
+			return fmt.Errorf("parse ANNOTATION_TEMPLATE: %v", err)
+		}
+		annotationTemplateRaw = annotations
+		annotationTemplate = expandAnnotationTemplate(annotations)
+	}
+
+	ownerResolutionFailurePolicy := ownerResolutionFallBackToLabels
+
+	if val := os.Getenv("OWNER_RESOLUTION_FAILURE"); val != "" {
+		policy, err := parseOwnerResolutionFailurePolicy(val)
+		if err != nil {
+			return err
+		}
+		ownerResolutionFailurePolicy = policy
+	}
+
+	// workloads labeled on the metrics, empty for all
+	metricsWorkloadAllowlist := make(map[string]struct{})
+	if val := os.Getenv("METRICS_WORKLOAD_ALLOWLIST"); val != "" {
+		for _, workload := range strings.Split(strings.TrimSpace(val), ",") {
+			metricsWorkloadAllowlist[workload] = struct{}{}
+		}
+	}
+
+	metricsWorkloadLimit := defaultMetricsWorkloadLimit
+	if val := os.Getenv("METRICS_WORKLOAD_LIMIT"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("parse METRICS_WORKLOAD_LIMIT: %v", err)
+		}
+		if num < 0 {
+			return fmt.Errorf("METRICS_WORKLOAD_LIMIT must not be negative, got %d", num)
+		}
+		metricsWorkloadLimit = num
+	}
+
+	// emit placement decisions as CloudEvents
+	cloudEventsSink := os.Getenv("CLOUDEVENTS_SINK")
+
+	cloudEventsMode := cloudEventBinary
+
+	if val := os.Getenv("CLOUDEVENTS_MODE"); val != "" {
+		mode, err := parseCloudEventMode(val)
+		if err != nil {
+			return err
+		}
+		cloudEventsMode = mode
+	}
+
+	cloudEventsSource := cloudEventDefaultSource
+
+	if val := os.Getenv("CLOUDEVENTS_SOURCE"); val != "" {
+		cloudEventsSource = val
+	}
+
+	var maxRequestBytes int64 = defaultMaxRequestBytes
+
+	if val := os.Getenv("MAX_REQUEST_BYTES"); val != "" {
+		num, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		if num <= 0 {
+			return fmt.Errorf("MAX_REQUEST_BYTES must be positive, got %d", num)
+		}
+		maxRequestBytes = num
+	}
+
+	var slowRequestThreshold time.Duration
+	if val := os.Getenv("SLOW_REQUEST_THRESHOLD"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse SLOW_REQUEST_THRESHOLD: %v", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("SLOW_REQUEST_THRESHOLD must not be negative, got %v", d)
+		}
+		slowRequestThreshold = d
+	}
+
+	// latency budget, the webhook timeoutSeconds
+	latencyBudget, latencyBudgetWarnPercent, err := latencyBudgetFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// drain timeout on SIGTERM/SIGINT
+	shutdownTimeout, err := positiveDurationFromEnv("SHUTDOWN_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	// readiness fails on an expired serving certificate
+	readyzCheckCert := os.Getenv("READYZ_CHECK_CERT") == "true"
+
+	// unset only fails on an expired certificate
+	readyzCertExpiryWindow, err := positiveDurationFromEnv("READYZ_CERT_EXPIRY_WINDOW", 0)
+	if err != nil {
+		return err
+	}
+
+	// bound slow clients, the API server gives up on the webhook after its timeoutSeconds (default 10s),
+	// so a response written later is lost anyway
+	httpTimeouts := map[string]time.Duration{
+		"HTTP_READ_HEADER_TIMEOUT": 5 * time.Second,
+		"HTTP_READ_TIMEOUT":        10 * time.Second,
+		"HTTP_WRITE_TIMEOUT":       9 * time.Second,
+		"HTTP_IDLE_TIMEOUT":        2 * time.Minute,
+	}
+	for env := range httpTimeouts {
+		if val := os.Getenv(env); val != "" {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("parse %s: %v", env, err)
+			}
+			if d < 0 {
+				return fmt.Errorf("%s must not be negative, got %v", env, d)
+			}
+			httpTimeouts[env] = d
+		}
+	}
+
+	// serve plain HTTP, e.g. behind a TLS terminating proxy
+	tlsEnabled := true
+	if val := os.Getenv("TLS_ENABLED"); val != "" {
+		enabled, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("parse TLS_ENABLED: %v", err)
+		}
+		tlsEnabled = enabled
+	}
+
+	// serving keypair, reloaded when the secret is rotated
+	certDir, certFile, keyFile := tlsDir, tlsCertFile, tlsKeyFile
+	if val := os.Getenv("TLS_DIR"); val != "" {
+		certDir = val
+	}
+	if val := os.Getenv("TLS_CERT_FILE"); val != "" {
+		certFile = val
+	}
+	if val := os.Getenv("TLS_KEY_FILE"); val != "" {
+		keyFile = val
+	}
+
+	caFile := defaultWebhookCAFile
+	if val := os.Getenv("TLS_CA_FILE"); val != "" {
+		caFile = val
+	}
+
+	// the webhook keeps its own MutatingWebhookConfiguration, the CA bundle follows the rotated secret
+	selfRegister := os.Getenv("SELF_REGISTER") == "true"
+	selfRegisterCleanup := os.Getenv("SELF_REGISTER_CLEANUP") == "true"
+	registration := &webhookRegistration{
+		name:             defaultWebhookConfigurationName,
+		serviceName:      defaultWebhookServiceName,
+		serviceNamespace: defaultWebhookServiceNamespace,
+		path:             mutatePath,
+		caPath:           filepath.Join(certDir, caFile),
+		timeout:          clientTimeout,
+	}
+	if val := os.Getenv("SELF_REGISTER_NAME"); val != "" {
+		registration.name = val
+	}
+	if val := os.Getenv("SELF_REGISTER_SERVICE"); val != "" {
+		registration.serviceName = val
+	}
+	if val := os.Getenv("SELF_REGISTER_NAMESPACE"); val != "" {
+		registration.serviceNamespace = val
+	}
+
+	tlsReloadInterval := time.Minute
+
+	if val := os.Getenv("TLS_RELOAD_INTERVAL"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse TLS_RELOAD_INTERVAL: %v", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("TLS_RELOAD_INTERVAL must be positive, got %v", d)
+		}
+		tlsReloadInterval = d
+	}
+
+	// only the leader mutates, followers forward the admission requests to it on the POD_IP it serves on
+	leaderElection := os.Getenv("ENABLE_LEADER_ELECTION") == "true"
+	podIP := os.Getenv("POD_IP")
+	if leaderElection && net.ParseIP(podIP) == nil {
+		return fmt.Errorf("ENABLE_LEADER_ELECTION requires POD_IP, the address the followers forward to, got %q", podIP)
+	}
+	configEndpoint := os.Getenv("ENABLE_CONFIG_ENDPOINT") == "true"
+	debugEndpoints := os.Getenv("ENABLE_DEBUG_ENDPOINTS") == "true"
+	leaseName := defaultLeaseName
+	if val := os.Getenv("LEADER_ELECTION_LEASE_NAME"); val != "" {
+		leaseName = val
+	}
+	leaseNamespace := defaultLeaseNamespace
+	if val := os.Getenv("LEADER_ELECTION_NAMESPACE"); val != "" {
+		leaseNamespace = val
+	}
+
+	var informerResync time.Duration
+
+	if val := os.Getenv("INFORMER_RESYNC"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("parse INFORMER_RESYNC: %v", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("INFORMER_RESYNC must not be negative, got %v", d)
+		}
+		informerResync = d
+	}
+
+	informerOpts := []informermanager.Option{informermanager.WithResync(informerResync)}
+
+	// the pod informer caches the whole cluster unless scoped
+	podFieldSelector, err := podFieldSelectorFromEnv(notControllerNamespace, namespaceSelector, os.Getenv("CONFIG_CONFIGMAP"))
+	if err != nil {
+		return err
+	}
+
+	var podLabelSelector labels.Selector
+	if val := os.Getenv("INFORMER_POD_LABEL_SELECTOR"); val != "" {
+		selector, err := labels.Parse(val)
+		if err != nil {
+			return fmt.Errorf("parse INFORMER_POD_LABEL_SELECTOR: %v", err)
+		}
+		podLabelSelector = selector
+	}
+
+	// count the ready pods from the informer events instead of listing them on every request,
+	// the counter counts by label value so unlabeled nodes count for the first value of their capacity
+	if os.Getenv("INCREMENTAL_POD_COUNT") == "true" {
+		unlabeledNodeValue := unlabeledNodeCapacity
+		if unlabeledNodeCapacity == spotKey {
+			unlabeledNodeValue = spotValues[0]
+		}
+		informerOpts = append(informerOpts, informermanager.WithPodCounter(capacityKey, unlabeledNodeValue, func(pod *corev1.Pod) bool {
+			return podReadyWith(readinessContainers, pod)
+		}))
+	}
+
+	if podFieldSelector != nil || podLabelSelector != nil {
+		informerOpts = append(informerOpts, informermanager.WithPodListOptions(func(opts *metav1.ListOptions) {
+			if podFieldSelector != nil {
+				opts.FieldSelector = podFieldSelector.String()
+			}
+			if podLabelSelector != nil {
+				opts.LabelSelector = podLabelSelector.String()
+			}
+		}))
+		klog.Infof("pod informer scoped, field selector %q label selector %q", podFieldSelector, podLabelSelector)
+	}
+
+	// live config, the ConfigMap is only delivered once the informers start after the app is set
+	var app *App
+	configMapName := os.Getenv("CONFIG_CONFIGMAP")
+	configMapNamespace := defaultConfigMapNamespace
+	if val := os.Getenv("CONFIG_CONFIGMAP_NAMESPACE"); val != "" {
+		configMapNamespace = val
+	}
+	if configMapName != "" {
+		informerOpts = append(informerOpts, informermanager.WithConfigMap(configMapNamespace, configMapName, func(cm *corev1.ConfigMap) {
+			app.applyConfigMap(cm)
+		}, func() {
+			app.revertConfigMap(configMapNamespace, configMapName)
+		}))
+	}
+
+	app, err = NewDefaultApp(context.Background(), informerOpts...)
 	if err != nil {
 		return err
 	}
 
 	app.mixSchedulerRequierd = mixSchedulerRequierd
-	app.notControllerNamespace = notControllerNamespace
-	app.OnDemandMinPodNum = onDemandMinPodNum
-	app.SpotMinPodNum = spotMinPodNum
+	app.controlledPodSelector = controlledPodSelector
+	app.dryRun = dryRun
+	app.clientTimeout = clientTimeout
+	app.cacheSyncWait = cacheSyncWait
+	if maxConcurrentAdmissions > 0 {
+		app.admissionLimiter = newAdmissionLimiter(maxConcurrentAdmissions, admissionQueueWait)
+	}
+	app.spotValues = spotValues
+	app.spotNodeSelector = map[string]string{capacityKey: spotValues[0]}
+	app.unlabeledNodeCapacity = unlabeledNodeCapacity
+	app.leaderElection = leaderElection
+	app.mutatePath = mutatePath
+	app.validatePath = validatePath
+	app.configEndpoint = configEndpoint
+	app.debugEndpoints = debugEndpoints
+	if reservationWindow > 0 {
+		app.reservations = newPlacementReservations(reservationWindow)
+	} else {
+		app.reservations = nil
+	}
+	app.ondemandMinPercent = ondemandMinPercent
+	app.minReplicasToAct = minReplicasToAct
+	app.tiers = tiers
+	app.envConfig = reloadableConfig{
+		OnDemandMinPodNum:        onDemandMinPodNum,
+		SpotMinPodNum:            spotMinPodNum,
+		notControllerNamespace:   notControllerNamespace,
+		controlledNamespaces:     controlledNamespaces,
+		namespaceSelector:        namespaceSelector,
+		namespaceSelectorDefault: namespaceSelectorDefault,
+	}
+	app.setReloadableConfig(app.envConfig)
+	if configMapName != "" {
+		app.configMap = configMapNamespace + "/" + configMapName
+	}
+	app.nodeAffinityConflictPolicy = nodeAffinityConflictPolicy
+	app.validateNodeAffinity = validateNodeAffinity
+	app.unsatisfiableAffinityPolicy = unsatisfiableAffinityPolicy
+	app.checkVolumeNodeAffinity = checkVolumeNodeAffinity
+	app.AntiAffinityTopologyKey = antiAffinityTopologyKey
+	app.AntiAffinityWeight = antiAffinityWeight
+	app.topologySpreadPolicy = topologySpreadPolicy
+	app.nodeNamePolicy = nodeNamePolicy
+	app.emptyCapacityPolicy = emptyCapacityPolicy
+	app.patchMode = patchMode
+	app.capacityMode = capacityMode
+	app.overflowToSpot = overflowToSpot
+	app.statefulSetOrdinalPlacement = statefulSetOrdinalPlacement
+	app.strategy = newPlacementStrategy(app, capacityMode)
+	app.failurePolicy = failurePolicy
+	app.placementMode = placementMode
+	app.nodeWeightAffinity = nodeWeightAffinity
+	app.spotRequestFactors = spotRequestFactors
+	app.spotToleration = spotToleration
+	app.evictionGuardPolicy = evictionGuardPolicy
+	app.excludeCordonedFromFloor = excludeCordonedFromFloor
+	app.drainTaintKeys = drainTaintKeys
+	app.countSiblingsByOwner = countSiblingsByOwner
+	app.deleteGuardSkipPropagationPolicies = deleteGuardSkipPropagationPolicies
+	app.allowScaleToZeroDelete = allowScaleToZeroDelete
+	app.skipDaemonSetPods = skipDaemonSetPods
+	app.enforceScaleDownOrder = enforceScaleDownOrder
+	app.deleteGuardRespectPDB = deleteGuardRespectPDB
+	app.readinessContainers = readinessContainers
+	app.annotationTemplate = annotationTemplate
+	app.annotationTemplateRaw = annotationTemplateRaw
+	app.ownerResolutionFailurePolicy = ownerResolutionFailurePolicy
+	app.metricsWorkloadAllowlist = metricsWorkloadAllowlist
+	app.metricsWorkloads = newWorkloadLabelSet(metricsWorkloadLimit)
+	app.maxRequestBytes = maxRequestBytes
+	app.latencyBudget = latencyBudget
+	app.slowRequestThreshold = slowRequestThreshold
+	app.latencyBudgetWarnPercent = latencyBudgetWarnPercent
+	maxRequestBytesGauge.Set(float64(maxRequestBytes))
 
-	klog.Infof("OnDemandMinPodNum %v", app.OnDemandMinPodNum)
-	klog.Infof("SpotMinPodNum %v", app.SpotMinPodNum)
+	var tlsConfig *tls.Config
+	if tlsEnabled {
+		certPath := filepath.Join(certDir, certFile)
+		keyPath := filepath.Join(certDir, keyFile)
+		certReloader, err := newCertReloader(certPath, keyPath)
+		if err != nil {
+			return err
+		}
+		app.certReloader = certReloader
+		go certReloader.Run(app.stopCh, tlsReloadInterval)
+
+		tlsConfig = &tls.Config{
+			GetCertificate: certReloader.GetCertificate,
+		}
+	}
+	if leaderElection {
+		// the followers dial the leader's pod IP, its certificate is issued for the service like for the API server
+		app.leaderScheme = "http"
+		app.leaderClient = &http.Client{Timeout: latencyBudget}
+		if tlsEnabled {
+			app.leaderScheme = "https"
+			app.leaderClient = newLeaderClient(registration.caPath, registration.serviceName+"."+registration.serviceNamespace+".svc", latencyBudget)
+		}
+	}
+	// without TLS there is no serving certificate to check
+	app.readyzCheckCert = readyzCheckCert && tlsEnabled
+	app.readyzCertExpiryWindow = readyzCertExpiryWindow
+
+	if burstCreateThreshold > 0 {
+		app.burstDetector = newBurstDetector(burstCreateThreshold, burstWindow)
+	}
+
+	klog.Infof("DryRun %v", app.dryRun)
+	klog.Infof("CapacityMode %v", app.capacityMode)
+	klog.Infof("PlacementMode %v", app.placementMode)
+	klog.Infof("OnDemandMinPodNum %v", app.envConfig.OnDemandMinPodNum)
+	klog.Infof("SpotMinPodNum %v", app.envConfig.SpotMinPodNum)
+	klog.Infof("Tiers %v", app.tiers)
+	klog.Infof("NodeAffinityConflictPolicy %v", app.nodeAffinityConflictPolicy)
+	klog.Infof("AntiAffinityTopologyKey %v", app.AntiAffinityTopologyKey)
+	klog.Infof("AntiAffinityWeight %v", app.AntiAffinityWeight)
+	klog.Infof("InformerResync %v", informerResync)
+	if app.configMap != "" {
+		klog.Infof("ConfigMap %v", app.configMap)
+	}
+	klog.Infof("TLSEnabled %v", tlsEnabled)
+
+	if cloudEventsSink != "" {
+		app.cloudEventSink = newCloudEventSink(cloudEventsSink, cloudEventsSource, cloudEventsMode)
+		go app.cloudEventSink.Run(app.stopCh)
+		klog.Infof("CloudEventsSink %v mode %v", cloudEventsSink, cloudEventsMode)
+	}
+
+	// the exporter reads the standard OTEL_ env itself, e.g. OTEL_EXPORTER_OTLP_HEADERS and OTEL_TRACES_SAMPLER
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		shutdownTracing, err := startTracing(context.Background())
+		if err != nil {
+			return err
+		}
+		// deferred before the server drains, so the spans of the drained requests are flushed
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				klog.Errorf("shutdown tracing: %v", err)
+			}
+		}()
+		klog.Infof("Tracing %v", endpoint)
+	}
+
+	if selfRegister {
+		registration.client = app.Client
+		registration.excludedNamespaces = sortedKeys(notControllerNamespace)
+		registration.leading = app.leading
+		if err := registration.apply(context.Background()); err != nil {
+			return fmt.Errorf("self register: %v", err)
+		}
+		go registration.Run(app.stopCh, tlsReloadInterval)
+
+		// off by default, a replica shutting down in a rollout would unregister the others until they re-apply
+		if selfRegisterCleanup {
+			defer func() {
+				if err := registration.unregister(context.Background()); err != nil {
+					klog.Errorf("self unregister: %v", err)
+				}
+			}()
+		}
+	}
 
 	app.StartInformer()
+	// deferred before the server drains, so it runs once the server is drained
 	defer app.StopInformer()
 
 	mux := BuildRouter(app)
 
-	fmt.Printf("Listening on port %s\n", port)
+	fmt.Printf("Listening on %s\n", net.JoinHostPort(bindAddress, port))
 
-	certPath := filepath.Join(tlsDir, tlsCertFile)
-	keyPath := filepath.Join(tlsDir, tlsKeyFile)
 	server := &http.Server{
 		// We listen on port 8443 such that we do not need root privileges or extra capabilities for this server.
 		// The Service object will take care of mapping this port to the HTTPS port 443.
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              net.JoinHostPort(bindAddress, port),
+		Handler:           mux,
+		ReadHeaderTimeout: httpTimeouts["HTTP_READ_HEADER_TIMEOUT"],
+		ReadTimeout:       httpTimeouts["HTTP_READ_TIMEOUT"],
+		WriteTimeout:      httpTimeouts["HTTP_WRITE_TIMEOUT"],
+		IdleTimeout:       httpTimeouts["HTTP_IDLE_TIMEOUT"],
+		TLSConfig:         tlsConfig,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if leaderElection {
+		klog.Infof("LeaderElection lease %s/%s", leaseNamespace, leaseName)
+		go func() {
+			if err := app.runLeaderElection(ctx, leaseName, leaseNamespace, net.JoinHostPort(podIP, port)); err != nil {
+				klog.Errorf("leader election: %v", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsEnabled {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	// drain the in-flight AdmissionReviews before the informer goes away
+	klog.Infof("shutting down, draining for up to %v", shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown server: %v", err)
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// positiveDurationFromEnv the positive duration of the env key, def when unset
+func positiveDurationFromEnv(key string, def time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %v", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %v", key, d)
+	}
+	return d, nil
+}
+
+// latencyBudgetFromEnv the LATENCY_BUDGET and LATENCY_BUDGET_WARN_PERCENT, 10s and 80 when unset
+func latencyBudgetFromEnv() (time.Duration, int, error) {
+	latencyBudget := 10 * time.Second
+	if val := os.Getenv("LATENCY_BUDGET"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse LATENCY_BUDGET: %v", err)
+		}
+		if d <= 0 {
+			return 0, 0, fmt.Errorf("LATENCY_BUDGET must be positive, got %v", d)
+		}
+		latencyBudget = d
+	}
+
+	latencyBudgetWarnPercent := 80
+	if val := os.Getenv("LATENCY_BUDGET_WARN_PERCENT"); val != "" {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse LATENCY_BUDGET_WARN_PERCENT: %v", err)
+		}
+		if num < 0 || num > 100 {
+			return 0, 0, fmt.Errorf("LATENCY_BUDGET_WARN_PERCENT must be between 0 and 100, got %d", num)
+		}
+		latencyBudgetWarnPercent = num
+	}
+
+	return latencyBudget, latencyBudgetWarnPercent, nil
+}
+
+// controlledPodSelectorFromEnv the CONTROLLED_POD_SELECTOR pod label selector, evaluated on top of the namespace
+// and the mix-scheduler label, nil when unset
+func controlledPodSelectorFromEnv() (labels.Selector, error) {
+	val := os.Getenv("CONTROLLED_POD_SELECTOR")
+	if val == "" {
+		return nil, nil
+	}
+
+	selector, err := labels.Parse(val)
+	if err != nil {
+		return nil, fmt.Errorf("parse CONTROLLED_POD_SELECTOR: %v", err)
+	}
+	return selector, nil
+}
+
+// namespaceListsFromEnv the notControllerNamespace denylist, kube-system and mix-scheduler-system when unset,
+// or the CONTROLLED_NAMESPACES allowlist, the denylist is nil with an allowlist
+func namespaceListsFromEnv() (map[string]struct{}, map[string]struct{}, error) {
+	var notControllerNamespace map[string]struct{}
+	if val := os.Getenv("notControllerNamespace"); val != "" {
+
+		notControllerNamespace = make(map[string]struct{})
+		for _, ns := range strings.Split(strings.TrimSpace(val), ",") {
+			notControllerNamespace[ns] = struct{}{}
+		}
+	} else {
+		// default notControllerNamespace
+		notControllerNamespace = map[string]struct{}{
+			"kube-system":          {},
+			"mix-scheduler-system": {},
+		}
+	}
+
+	// allowlist, only the listed namespaces are controlled
+	var controlledNamespaces map[string]struct{}
+	if val := os.Getenv("CONTROLLED_NAMESPACES"); val != "" {
+		if os.Getenv("notControllerNamespace") != "" {
+			return nil, nil, fmt.Errorf("CONTROLLED_NAMESPACES and notControllerNamespace are mutually exclusive")
+		}
+
+		controlledNamespaces = make(map[string]struct{})
+		for _, ns := range strings.Split(strings.TrimSpace(val), ",") {
+			controlledNamespaces[strings.TrimSpace(ns)] = struct{}{}
+		}
+		notControllerNamespace = nil
+	}
+
+	return notControllerNamespace, controlledNamespaces, nil
+}
+
+// podFieldSelectorFromEnv the pod informer field selector of INFORMER_SCOPE_PODS, nil when unset. The selector is
+// fixed at startup from the env notControllerNamespace, a namespace of it enabled later has no cached pods,
+// its pods count as none and are pinned to on-demand
+func podFieldSelectorFromEnv(notControllerNamespace map[string]struct{}, namespaceSelector labels.Selector, configMapName string) (fields.Selector, error) {
+	if os.Getenv("INFORMER_SCOPE_PODS") != "true" {
+		return nil, nil
+	}
+
+	// the selector decides for every namespace it can read, notControllerNamespace included
+	if namespaceSelector != nil {
+		return nil, fmt.Errorf("INFORMER_SCOPE_PODS and CONTROLLED_NAMESPACE_SELECTOR are mutually exclusive, the selector may enable namespaces whose pods are not cached")
+	}
+
+	selector := notControllerNamespaceFieldSelector(notControllerNamespace)
+	if configMapName != "" {
+		klog.Warningf("INFORMER_SCOPE_PODS caches no pods of %v, the namespaces lists and CONTROLLED_NAMESPACE_SELECTOR of CONFIG_CONFIGMAP %s must not enable them",
+			sortedKeys(notControllerNamespace), configMapName)
+	}
+	klog.Warningf("INFORMER_SCOPE_PODS caches no pods of %v, the %s namespace annotation must not enable them", sortedKeys(notControllerNamespace), mixSchedulerKey)
+
+	return selector, nil
+}
+
+// notControllerNamespaceFieldSelector selects the pods outside of the namespaces never controlled
+func notControllerNamespaceFieldSelector(notControllerNamespace map[string]struct{}) fields.Selector {
+	namespaces := make([]string, 0, len(notControllerNamespace))
+	for ns := range notControllerNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	selectors := make([]fields.Selector, 0, len(namespaces))
+	for _, ns := range namespaces {
+		selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", ns))
 	}
 
-	return server.ListenAndServeTLS(certPath, keyPath)
+	return fields.AndSelectors(selectors...)
 }
@@ -0,0 +1,398 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+const testNamespace = "default"
+
+// newTestApp an App with the defaults on a fake clientset seeded with the objects, the informers are not
+// started so every lookup goes to the fake clientset, events go to a FakeRecorder
+func newTestApp(t *testing.T, objects ...runtime.Object) *App {
+	t.Helper()
+
+	return newTestAppWithClient(t, fake.NewSimpleClientset(objects...))
+}
+
+// newTestAppWithClient newTestApp on the clientset, e.g. one with reactors injecting failures
+func newTestAppWithClient(t *testing.T, client *fake.Clientset) *App {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	app := NewApp(ctx, client)
+	app.eventRecorder = record.NewFakeRecorder(100)
+
+	return app
+}
+
+// newSyncedApp newTestApp with the informers started and synced, the lookups go to the informer caches
+func newSyncedApp(t *testing.T, objects ...runtime.Object) *App {
+	t.Helper()
+
+	app := newTestApp(t, objects...)
+	app.StartInformer()
+	t.Cleanup(app.StopInformer)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !app.informermanager.IsSynced() {
+		if time.Now().After(deadline) {
+			t.Fatal("informers not synced within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return app
+}
+
+// recordedEvents drains the events recorded by the FakeRecorder of the App
+func recordedEvents(app *App) []string {
+	recorder := app.eventRecorder.(*record.FakeRecorder)
+
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// setMinimums sets the on-demand and spot minimums of the env config
+func setMinimums(app *App, ondemandMin, spotMin int) {
+	app.envConfig.OnDemandMinPodNum = ondemandMin
+	app.envConfig.SpotMinPodNum = spotMin
+	app.setReloadableConfig(app.envConfig)
+}
+
+// testNode a node labeled with the capacity, unlabeled for an empty capacity
+func testNode(name, capacity string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+	if capacity != "" {
+		node.Labels[capacityKey] = capacity
+	}
+	return node
+}
+
+// testPod a ready pod of the app label on the node, not scheduled for an empty node name
+func testPod(name, app, nodeName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			UID:       types.UID(name),
+			Labels:    map[string]string{"app": app},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   nodeName,
+			Containers: []corev1.Container{{Name: "main", Image: "nginx"}},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+// testCreatedPod the pod of a create, without a name, node and status like the pods of a ReplicaSet
+func testCreatedPod(app string) *corev1.Pod {
+	pod := testPod("", app, "")
+	pod.GenerateName = app + "-"
+	pod.UID = ""
+	pod.Status = corev1.PodStatus{}
+	return pod
+}
+
+// podReview an AdmissionReview of the operation on the pod, the pod is the old object of a delete
+func podReview(t *testing.T, operation admissionv1.Operation, pod *corev1.Pod) *admissionv1.AdmissionReview {
+	t.Helper()
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("marshal pod: %v", err)
+	}
+
+	request := &admissionv1.AdmissionRequest{
+		UID:       types.UID("uid-" + string(operation)),
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Operation: operation,
+	}
+	if operation == admissionv1.Delete {
+		request.OldObject = runtime.RawExtension{Raw: raw}
+	} else {
+		request.Object = runtime.RawExtension{Raw: raw}
+	}
+
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request:  request,
+	}
+}
+
+// evictionReview an AdmissionReview of the eviction of the pod, the request carries the Eviction, not the pod
+func evictionReview(t *testing.T, pod *corev1.Pod) *admissionv1.AdmissionReview {
+	t.Helper()
+
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+	raw, err := json.Marshal(eviction)
+	if err != nil {
+		t.Fatalf("marshal eviction: %v", err)
+	}
+
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:         types.UID("uid-eviction"),
+			Kind:        metav1.GroupVersionKind{Group: "policy", Version: "v1", Kind: "Eviction"},
+			Resource:    metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			SubResource: evictionSubResource,
+			Namespace:   pod.Namespace,
+			Name:        pod.Name,
+			Operation:   admissionv1.Create,
+			Object:      runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+// postReview posts the AdmissionReview to the handler, returns the HTTP status and the AdmissionReview answered
+func postReview(t *testing.T, handler http.HandlerFunc, review *admissionv1.AdmissionReview) (int, *admissionv1.AdmissionReview) {
+	t.Helper()
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("marshal review: %v", err)
+	}
+
+	return postBody(t, handler, body)
+}
+
+// postBody posts the raw body to the handler, the answer is nil when it is not an AdmissionReview
+func postBody(t *testing.T, handler http.HandlerFunc, body []byte) (int, *admissionv1.AdmissionReview) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, defaultMutatePath, bytes.NewReader(body)))
+
+	resp := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil || resp.Response == nil {
+		return rec.Code, nil
+	}
+
+	return rec.Code, resp
+}
+
+// mutate posts the AdmissionReview to HandleMutate, fails the test unless it is answered with status 200
+func mutate(t *testing.T, app *App, review *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	code, resp := postReview(t, app.HandleMutate, review)
+	if code != http.StatusOK || resp == nil {
+		t.Fatalf("HandleMutate answered %d without an AdmissionReview", code)
+	}
+	if resp.Response.UID != review.Request.UID {
+		t.Errorf("response UID %q, want the request's %q", resp.Response.UID, review.Request.UID)
+	}
+
+	return resp.Response
+}
+
+// patchOf the JSONPatch entries of the response, nil when there is no patch
+func patchOf(t *testing.T, resp *admissionv1.AdmissionResponse) []JSONPatchEntry {
+	t.Helper()
+
+	if len(resp.Patch) == 0 {
+		return nil
+	}
+
+	var patch []JSONPatchEntry
+	if err := json.Unmarshal(resp.Patch, &patch); err != nil {
+		t.Fatalf("unmarshal patch %s: %v", resp.Patch, err)
+	}
+
+	return patch
+}
+
+// findPatch the patch entry of the path, ok is false when there is none
+func findPatch(patch []JSONPatchEntry, path string) (JSONPatchEntry, bool) {
+	for _, entry := range patch {
+		if entry.Path == path {
+			return entry, true
+		}
+	}
+	return JSONPatchEntry{}, false
+}
+
+// decodePatchValue unmarshals the value of the patch entry of the path, fails the test when there is none
+func decodePatchValue(t *testing.T, patch []JSONPatchEntry, path string, v interface{}) {
+	t.Helper()
+
+	entry, ok := findPatch(patch, path)
+	if !ok {
+		t.Fatalf("no patch of %s in %s", path, mustJSON(t, patch))
+	}
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		t.Fatalf("unmarshal %s patch: %v", path, err)
+	}
+}
+
+// applyPatch the pod with the JSONPatch of the response applied, as the API server applies it
+func applyPatch(t *testing.T, pod *corev1.Pod, resp *admissionv1.AdmissionResponse) *corev1.Pod {
+	t.Helper()
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("marshal pod: %v", err)
+	}
+	if len(resp.Patch) == 0 {
+		return pod.DeepCopy()
+	}
+
+	patch, err := jsonpatch.DecodePatch(resp.Patch)
+	if err != nil {
+		t.Fatalf("decode patch %s: %v", resp.Patch, err)
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatalf("apply patch %s: %v", resp.Patch, err)
+	}
+
+	out := &corev1.Pod{}
+	if err := json.Unmarshal(patched, out); err != nil {
+		t.Fatalf("unmarshal patched pod: %v", err)
+	}
+	return out
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(b)
+}
+
+func TestPodCreateOperation(t *testing.T) {
+	const antiAffinity = `{"podAntiAffinity":{"preferredDuringSchedulingIgnoredDuringExecution":[{"weight":100,` +
+		`"podAffinityTerm":{"labelSelector":{"matchLabels":{"app":"web"}},"topologyKey":"kubernetes.io/hostname"}}]}}`
+
+	nodes := []runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+
+	tests := []struct {
+		name        string
+		ondemandMin int
+		existing    []runtime.Object
+		pod         func() *corev1.Pod
+		// the exact JSONPatch, empty for the pod allowed unchanged
+		patch string
+	}{
+		{
+			name:        "below the minimum pins to on-demand",
+			ondemandMin: 1,
+			pod:         func() *corev1.Pod { return testCreatedPod("web") },
+			patch: `[{"op":"add","path":"/spec/nodeSelector","value":{"node.kubernetes.io/capacity":"on-demand"}},` +
+				`{"op":"add","path":"/spec/affinity","value":` + antiAffinity + `}]`,
+		},
+		{
+			name:        "at the minimum is left to the scheduler",
+			ondemandMin: 1,
+			existing:    []runtime.Object{testPod("web-1", "web", "od-1")},
+			pod:         func() *corev1.Pod { return testCreatedPod("web") },
+		},
+		{
+			name:        "spot pods do not count toward the on-demand minimum",
+			ondemandMin: 2,
+			existing:    []runtime.Object{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "spot-1"), testPod("web-3", "web", "spot-1")},
+			pod:         func() *corev1.Pod { return testCreatedPod("web") },
+			patch: `[{"op":"add","path":"/spec/nodeSelector","value":{"node.kubernetes.io/capacity":"on-demand"}},` +
+				`{"op":"add","path":"/spec/affinity","value":` + antiAffinity + `}]`,
+		},
+		{
+			name:        "mixed with the user's nodeSelector keeps its keys",
+			ondemandMin: 1,
+			existing:    []runtime.Object{testPod("web-1", "web", "spot-1")},
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Spec.NodeSelector = map[string]string{"disktype": "ssd"}
+				return pod
+			},
+			patch: `[{"op":"add","path":"/spec/nodeSelector/node.kubernetes.io~1capacity","value":"on-demand"},` +
+				`{"op":"add","path":"/spec/affinity","value":` + antiAffinity + `}]`,
+		},
+		{
+			name:        "other workloads do not count",
+			ondemandMin: 1,
+			existing:    []runtime.Object{testPod("api-1", "api", "od-1")},
+			pod:         func() *corev1.Pod { return testCreatedPod("web") },
+			patch: `[{"op":"add","path":"/spec/nodeSelector","value":{"node.kubernetes.io/capacity":"on-demand"}},` +
+				`{"op":"add","path":"/spec/affinity","value":` + antiAffinity + `}]`,
+		},
+		{
+			name:        "no minimum leaves every pod to the scheduler",
+			ondemandMin: 0,
+			pod:         func() *corev1.Pod { return testCreatedPod("web") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append(append([]runtime.Object{}, nodes...), tt.existing...)...)
+			app.envConfig.OnDemandMinPodNum = tt.ondemandMin
+			app.envConfig.SpotMinPodNum = 0
+			app.setReloadableConfig(app.envConfig)
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, tt.pod()))
+			if !resp.Allowed {
+				t.Fatalf("pod denied: %v", resp.Result)
+			}
+
+			if tt.patch == "" {
+				if len(resp.Patch) != 0 {
+					t.Fatalf("patch %s, want none", resp.Patch)
+				}
+				return
+			}
+
+			if string(resp.Patch) != tt.patch {
+				t.Errorf("patch\n%s\nwant\n%s", resp.Patch, tt.patch)
+			}
+			if resp.PatchType == nil || *resp.PatchType != admissionv1.PatchTypeJSONPatch {
+				t.Errorf("patch type %v, want %s", resp.PatchType, admissionv1.PatchTypeJSONPatch)
+			}
+		})
+	}
+}
+
+// a zero drain timeout would cut the in-flight admission requests off on every shutdown
+func TestShutdownTimeoutFromEnv(t *testing.T) {
+	for val, wantErr := range map[string]bool{"": false, "30s": false, "0s": true, "-1s": true, "later": true} {
+		t.Setenv("SHUTDOWN_TIMEOUT", val)
+
+		if _, err := positiveDurationFromEnv("SHUTDOWN_TIMEOUT", 10*time.Second); (err != nil) != wantErr {
+			t.Errorf("SHUTDOWN_TIMEOUT %q error %v, want error %v", val, err, wantErr)
+		}
+	}
+}
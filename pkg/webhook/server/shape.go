@@ -0,0 +1,30 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// patchableShape checks the created pod has the fields the patches add below, an add to
+// /spec/affinity fails on the API server when /spec is missing, with an error not naming the webhook
+func patchableShape(raw []byte, pod *corev1.Pod) error {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("pod is not a JSON object: %v", err)
+	}
+
+	for _, field := range []string{"metadata", "spec"} {
+		if value, ok := fields[field]; !ok || !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			return fmt.Errorf("pod without %s object", field)
+		}
+	}
+
+	if len(pod.Spec.Containers) == 0 {
+		return fmt.Errorf("pod without containers")
+	}
+
+	return nil
+}
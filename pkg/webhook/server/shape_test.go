@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDegeneratePodSkipped(t *testing.T) {
+	const labels = `"metadata":{"namespace":"default","generateName":"web-","labels":{"app":"web"}}`
+
+	tests := []struct {
+		name      string
+		raw       string
+		patchable bool
+	}{
+		{name: "without spec", raw: `{` + labels + `}`},
+		{name: "null spec", raw: `{` + labels + `,"spec":null}`},
+		{name: "without containers", raw: `{` + labels + `,"spec":{}}`},
+		{name: "null metadata", raw: `{"metadata":null,"spec":{"containers":[{"name":"main","image":"nginx"}]}}`},
+		{name: "complete pod", raw: `{` + labels + `,"spec":{"containers":[{"name":"main","image":"nginx"}]}}`, patchable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+
+			review := podReview(t, admissionv1.Create, testCreatedPod("web"))
+			review.Request.Object = runtime.RawExtension{Raw: []byte(tt.raw)}
+
+			resp := mutate(t, app, review)
+			if !resp.Allowed {
+				t.Fatalf("degenerate pod denied: %v", resp.Result)
+			}
+			if patched := len(resp.Patch) != 0; patched != tt.patchable {
+				t.Errorf("patched %v, want %v: %s", patched, tt.patchable, resp.Patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ownedBy sets the controller of the pod
+func ownedBy(pod *corev1.Pod, kind, name string) *corev1.Pod {
+	controller := true
+	pod.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "apps/v1",
+		Kind:       kind,
+		Name:       name,
+		UID:        types.UID(name),
+		Controller: &controller,
+	}}
+	return pod
+}
+
+// testReplicaSet a ReplicaSet of the replicas, controlled by the Deployment unless it is empty
+func testReplicaSet(name, deployment string, replicas int32) *appsv1.ReplicaSet {
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, UID: types.UID(name)},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	if deployment != "" {
+		controller := true
+		rs.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: deployment, UID: types.UID(deployment), Controller: &controller}}
+	}
+	return rs
+}
+
+// statefulSetPod a pod of the StatefulSet with its unique pod-name label
+func statefulSetPod(name, statefulSet, nodeName string) *corev1.Pod {
+	pod := ownedBy(testPod(name, statefulSet, nodeName), "StatefulSet", statefulSet)
+	pod.Labels["statefulset.kubernetes.io/pod-name"] = name
+	return pod
+}
+
+func TestSiblingPodsByOwner(t *testing.T) {
+	app := newTestApp(t,
+		statefulSetPod("db-0", "db", "od-1"),
+		statefulSetPod("db-1", "db", "od-1"),
+		ownedBy(testPod("web-old", "web", "od-1"), "ReplicaSet", "web-1"),
+		ownedBy(testPod("web-new", "web", "od-1"), "ReplicaSet", "web-2"),
+	)
+	app.countSiblingsByOwner = true
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want int
+	}{
+		{name: "statefulset pods differ by their pod-name label", pod: statefulSetPod("db-2", "db", ""), want: 2},
+		{name: "replicasets sharing labels are counted apart", pod: ownedBy(testCreatedPod("web"), "ReplicaSet", "web-2"), want: 1},
+		{name: "a pod without controller is matched by its labels", pod: testCreatedPod("web"), want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			siblings, err := app.siblingPods(tt.pod)
+			if err != nil {
+				t.Fatalf("siblingPods: %v", err)
+			}
+			if len(siblings) != tt.want {
+				t.Errorf("%d siblings, want %d", len(siblings), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// topologySpreadPolicy decides how the injected pod anti-affinity coexists with
+// topologySpreadConstraints the pod already declares
+type topologySpreadPolicy string
+
+const (
+	// inject the anti-affinity regardless of the spread constraints
+	topologySpreadInject topologySpreadPolicy = "inject"
+	// do not inject the anti-affinity when the pod has any spread constraint
+	topologySpreadSkipAntiAffinity topologySpreadPolicy = "skip-anti-affinity"
+	// do not inject the anti-affinity when a spread constraint already spreads over the same topology key
+	topologySpreadReconcile topologySpreadPolicy = "reconcile"
+)
+
+func parseTopologySpreadPolicy(val string) (topologySpreadPolicy, error) {
+	switch policy := topologySpreadPolicy(val); policy {
+	case topologySpreadInject, topologySpreadSkipAntiAffinity, topologySpreadReconcile:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid topology spread policy %q, must be one of %s|%s|%s", val,
+			topologySpreadInject, topologySpreadSkipAntiAffinity, topologySpreadReconcile)
+	}
+}
+
+// skipAntiAffinity reports whether the pod's spread constraints already cover the anti-affinity over topologyKey
+func (app *App) skipAntiAffinity(podSpec corev1.PodSpec, topologyKey string) bool {
+	if len(podSpec.TopologySpreadConstraints) == 0 {
+		return false
+	}
+
+	switch app.topologySpreadPolicy {
+	case topologySpreadSkipAntiAffinity:
+		return true
+	case topologySpreadReconcile:
+		for _, constraint := range podSpec.TopologySpreadConstraints {
+			if constraint.TopologyKey == topologyKey {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
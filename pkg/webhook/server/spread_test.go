@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTopologySpreadPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      topologySpreadPolicy
+		topologyKey string
+		// whether the pod anti-affinity is injected
+		antiAffinity bool
+	}{
+		{name: "inject", policy: topologySpreadInject, topologyKey: hostnameTopologyKey, antiAffinity: true},
+		{name: "skip anti-affinity", policy: topologySpreadSkipAntiAffinity, topologyKey: corev1.LabelTopologyZone},
+		{name: "reconcile same key", policy: topologySpreadReconcile, topologyKey: hostnameTopologyKey},
+		{name: "reconcile other key", policy: topologySpreadReconcile, topologyKey: corev1.LabelTopologyZone, antiAffinity: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+			app.topologySpreadPolicy = tt.policy
+
+			pod := testCreatedPod("web")
+			pod.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+				MaxSkew:           1,
+				TopologyKey:       tt.topologyKey,
+				WhenUnsatisfiable: corev1.ScheduleAnyway,
+			}}
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+			patch := patchOf(t, resp)
+			if _, ok := findPatch(patch, "/spec/nodeSelector"); !ok {
+				t.Fatalf("pod below the minimum not pinned: %s", resp.Patch)
+			}
+
+			var affinity corev1.Affinity
+			decodePatchValue(t, patch, "/spec/affinity", &affinity)
+			injected := len(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution) > 0
+			if injected != tt.antiAffinity {
+				t.Errorf("anti-affinity injected %v, want %v", injected, tt.antiAffinity)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// placementPlan the placement decided for a created pod
+type placementPlan struct {
+	// the capacity the pod is pinned to, unpinnedCapacity when it is left to the scheduler
+	Capacity string
+	// pinned by the workload itself, the placement must not be relaxed
+	Forced bool
+}
+
+// placementStrategy decides the placement of a created pod, the patch is built from the plan
+type placementStrategy interface {
+	Decide(ctx context.Context, pod *corev1.Pod) (placementPlan, error)
+}
+
+// newPlacementStrategy the strategy of the capacity mode, the pod's capacityLabel takes precedence over all of them
+func newPlacementStrategy(app *App, mode capacityMode) placementStrategy {
+	var strategy placementStrategy = &minPodStrategy{app: app}
+	if mode == capacityWeighted {
+		strategy = &weightedStrategy{app: app, fallback: strategy}
+	}
+	if app.overflowToSpot {
+		strategy = &overflowStrategy{next: strategy}
+	}
+	if app.statefulSetOrdinalPlacement {
+		strategy = &ordinalStrategy{app: app, next: strategy}
+	}
+
+	return &capacityLabelStrategy{next: strategy}
+}
+
+// minPodStrategy fills the tiers in order, pins pods to the first tier below its minimum, by default
+// to on-demand until OnDemandMinPodNum of them, or ondemandMinPercent of the workload, exist.
+// A minimum is the number of pods to reach: a create is pinned while fewer exist, so with a minimum
+// of 2 the first and second creates are pinned, the third is not, and 0 never pins
+type minPodStrategy struct {
+	app *App
+}
+
+func (s *minPodStrategy) Decide(ctx context.Context, pod *corev1.Pod) (placementPlan, error) {
+	for _, tier := range s.app.tiers {
+		min := tier.Min
+		if min == namespaceTierMin {
+			ondemandMin, _ := s.app.minPodNums(pod.Namespace)
+			min = s.app.effectiveOnDemandMin(pod, ondemandMin)
+		}
+
+		// count the pods still starting as well, otherwise every create before the first
+		// pod is ready would be pinned to the tier, and the pins not yet in the cache
+		num, err := s.app.capacityPodNum(tier.Capacity, pod)
+		if err != nil {
+			return placementPlan{}, err
+		}
+		if num < min {
+			return placementPlan{Capacity: tier.Capacity}, nil
+		}
+	}
+
+	return placementPlan{Capacity: unpinnedCapacity}, nil
+}
+
+// weightedStrategy splits pods by the ratio of their weight labels, pods without them are left to the fallback
+type weightedStrategy struct {
+	app      *App
+	fallback placementStrategy
+}
+
+func (s *weightedStrategy) Decide(ctx context.Context, pod *corev1.Pod) (placementPlan, error) {
+	ondemandWeight, spotWeight, ok := podWeights(pod.Labels)
+	if !ok {
+		return s.fallback.Decide(ctx, pod)
+	}
+
+	ondemandNum, err := s.app.podExistOnNodeCapacityNum(ondemandKey, pod)
+	if err != nil {
+		return placementPlan{}, err
+	}
+	spotNum, err := s.app.podExistOnNodeCapacityNum(spotKey, pod)
+	if err != nil {
+		return placementPlan{}, err
+	}
+	return placementPlan{Capacity: weightedCapacity(ondemandNum, spotNum, ondemandWeight, spotWeight)}, nil
+}
+
+// overflowStrategy steers the pods next leaves to the scheduler to spot, so the pods above
+// the on-demand minimum do not land on on-demand nodes by chance
+type overflowStrategy struct {
+	next placementStrategy
+}
+
+func (s *overflowStrategy) Decide(ctx context.Context, pod *corev1.Pod) (placementPlan, error) {
+	plan, err := s.next.Decide(ctx, pod)
+	if err != nil || plan.Capacity != unpinnedCapacity {
+		return plan, err
+	}
+
+	return placementPlan{Capacity: spotKey}, nil
+}
+
+// capacityLabelStrategy pins pods to the capacity of their capacityLabel, other pods are left to next
+type capacityLabelStrategy struct {
+	next placementStrategy
+}
+
+func (s *capacityLabelStrategy) Decide(ctx context.Context, pod *corev1.Pod) (placementPlan, error) {
+	if capacity := forcedCapacity(pod.Labels); capacity != "" {
+		return placementPlan{Capacity: capacity, Forced: true}, nil
+	}
+
+	return s.next.Decide(ctx, pod)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestOverflowToSpot(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow bool
+		existing []runtime.Object
+		// the capacity of the nodeSelector, empty for none
+		want string
+	}{
+		{name: "below the minimum", overflow: true, want: ondemandKey},
+		{name: "above the minimum", overflow: true, existing: []runtime.Object{testPod("web-1", "web", "od-1")}, want: spotKey},
+		{name: "above the minimum without overflow", existing: []runtime.Object{testPod("web-1", "web", "od-1")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append([]runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}, tt.existing...)...)
+			setMinimums(app, 1, 0)
+			app.overflowToSpot = tt.overflow
+			app.strategy = newPlacementStrategy(app, app.capacityMode)
+
+			pod := testCreatedPod("web")
+			patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+			if got := patched.Spec.NodeSelector[capacityKey]; got != tt.want {
+				t.Errorf("nodeSelector capacity %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// the workload's first on-demand pod is still starting, the second create overflows to spot and /validate allows it
+func TestOverflowToSpotValidated(t *testing.T) {
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), notReady(testPod("web-1", "web", "od-1")))
+	setMinimums(app, 1, 0)
+	app.overflowToSpot = true
+	app.strategy = newPlacementStrategy(app, app.capacityMode)
+
+	patched, resp := admit(t, app, testCreatedPod("web"))
+	if got := patched.Spec.NodeSelector[capacityKey]; got != spotKey {
+		t.Fatalf("nodeSelector capacity %q, want %q", got, spotKey)
+	}
+	if !resp.Allowed {
+		t.Errorf("overflow to spot denied by /validate: %v", resp.Result)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// capacityTier a capacity the pods of a workload are pinned to until its minimum of them exist
+type capacityTier struct {
+	// capacity label value of the tier's nodes, e.g. committed
+	Capacity string
+	// pods of a workload kept on the tier, the Min-th create is the last one pinned to it,
+	// namespaceTierMin for the on-demand minimum of the namespace
+	Min int
+}
+
+// namespaceTierMin the minimum of a tier without one, OnDemandMinPodNum with the namespace annotation
+// and ONDEMAND_MIN_PERCENT applied
+const namespaceTierMin = -1
+
+// defaultTiers the on-demand tier alone, pods are pinned to on-demand until its minimum exist
+func defaultTiers() []capacityTier {
+	return []capacityTier{{Capacity: ondemandKey, Min: namespaceTierMin}}
+}
+
+// parseTiers parses the comma separated tiers in the order they are filled, each capacity:min,
+// e.g. committed:2,on-demand, only on-demand may leave out its minimum, spot is never a tier
+func parseTiers(val string, spotValues []string) ([]capacityTier, error) {
+	var tiers []capacityTier
+	seen := make(map[string]struct{})
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		capacity, minVal, hasMin := strings.Cut(entry, ":")
+		capacity = strings.TrimSpace(capacity)
+		if errs := validation.IsValidLabelValue(capacity); capacity == "" || len(errs) > 0 {
+			return nil, fmt.Errorf("invalid tier %q: %s", entry, strings.Join(errs, ", "))
+		}
+		for _, spotValue := range spotValues {
+			if capacity == spotValue {
+				return nil, fmt.Errorf("invalid tier %q, spot pods are never pinned by minimum", entry)
+			}
+		}
+		if _, ok := seen[capacity]; ok {
+			return nil, fmt.Errorf("duplicate tier %s", capacity)
+		}
+		seen[capacity] = struct{}{}
+
+		tier := capacityTier{Capacity: capacity, Min: namespaceTierMin}
+		if hasMin {
+			num, err := strconv.Atoi(strings.TrimSpace(minVal))
+			if err != nil || num < 0 {
+				return nil, fmt.Errorf("invalid tier %q, the minimum must be a non-negative integer", entry)
+			}
+			tier.Min = num
+		} else if capacity != ondemandKey {
+			return nil, fmt.Errorf("invalid tier %q, only %s may leave out its minimum", entry, ondemandKey)
+		}
+
+		tiers = append(tiers, tier)
+	}
+
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("no tier in %q", val)
+	}
+
+	return tiers, nil
+}
+
+func (t capacityTier) String() string {
+	if t.Min == namespaceTierMin {
+		return t.Capacity
+	}
+	return fmt.Sprintf("%s:%d", t.Capacity, t.Min)
+}
+
+// fixedTierMinimum reports whether a tier keeps pods by a minimum of its own, besides the on-demand minimum
+func (app *App) fixedTierMinimum() bool {
+	for _, tier := range app.tiers {
+		if tier.Min > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const committedCapacity = "committed"
+
+func TestThreeTiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		overflow bool
+		// the capacity of the nodeSelector, empty for none
+		want string
+	}{
+		{name: "committed filled first", want: committedCapacity},
+		{name: "committed below its minimum", existing: []runtime.Object{testPod("web-1", "web", "committed-1")}, want: committedCapacity},
+		{
+			name:     "on-demand once committed is full",
+			existing: []runtime.Object{testPod("web-1", "web", "committed-1"), testPod("web-2", "web", "committed-1")},
+			want:     ondemandKey,
+		},
+		{
+			name:     "pods on spot do not fill a tier",
+			existing: []runtime.Object{testPod("web-1", "web", "committed-1"), testPod("web-2", "web", "spot-1"), testPod("web-3", "web", "spot-1")},
+			want:     committedCapacity,
+		},
+		{
+			name:     "all tiers full",
+			existing: []runtime.Object{testPod("web-1", "web", "committed-1"), testPod("web-2", "web", "committed-1"), testPod("web-3", "web", "od-1")},
+		},
+		{
+			name:     "all tiers full overflow to spot",
+			existing: []runtime.Object{testPod("web-1", "web", "committed-1"), testPod("web-2", "web", "committed-1"), testPod("web-3", "web", "od-1")},
+			overflow: true,
+			want:     spotKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []runtime.Object{testNode("committed-1", committedCapacity), testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+			app := newTestApp(t, append(nodes, tt.existing...)...)
+			setMinimums(app, 1, 0)
+			tiers, err := parseTiers("committed:2,on-demand", app.spotValues)
+			if err != nil {
+				t.Fatalf("parse tiers: %v", err)
+			}
+			app.tiers = tiers
+			app.overflowToSpot = tt.overflow
+			app.strategy = newPlacementStrategy(app, app.capacityMode)
+
+			pod := testCreatedPod("web")
+			patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+			if got := patched.Spec.NodeSelector[capacityKey]; got != tt.want {
+				t.Errorf("nodeSelector capacity %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tests := []struct {
+		val   string
+		want  string
+		valid bool
+	}{
+		{val: "on-demand", want: "[on-demand]", valid: true},
+		{val: "committed:2, on-demand", want: "[committed:2 on-demand]", valid: true},
+		{val: "committed:2,on-demand:3", want: "[committed:2 on-demand:3]", valid: true},
+		{val: "committed", valid: false},
+		{val: "committed:-1,on-demand", valid: false},
+		{val: "committed:2,committed:1", valid: false},
+		{val: "spot:1", valid: false},
+		{val: " , ", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			tiers, err := parseTiers(tt.val, []string{spotKey})
+			if (err == nil) != tt.valid {
+				t.Fatalf("parseTiers(%q) = %v, want valid %v", tt.val, err, tt.valid)
+			}
+			if got := fmt.Sprint(tiers); tt.valid && got != tt.want {
+				t.Errorf("parseTiers(%q) = %s, want %s", tt.val, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// requestPhase the time spent in one phase of handling an admission request
+type requestPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// requestTimer splits the handling of an admission request into phases, each mark ends the
+// phase running since the previous mark, not safe for concurrent use
+type requestTimer struct {
+	start  time.Time
+	last   time.Time
+	phases []requestPhase
+}
+
+func newRequestTimer() *requestTimer {
+	now := time.Now()
+	return &requestTimer{start: now, last: now}
+}
+
+// mark ends the phase running since the previous mark
+func (t *requestTimer) mark(name string) {
+	now := time.Now()
+	t.phases = append(t.phases, requestPhase{name: name, duration: now.Sub(t.last)})
+	t.last = now
+}
+
+// finish ends the last phase as respond and returns the total duration
+func (t *requestTimer) finish() time.Duration {
+	t.mark("respond")
+	return t.last.Sub(t.start)
+}
+
+// slowest the phase which took the longest
+func (t *requestTimer) slowest() requestPhase {
+	var slowest requestPhase
+	for _, phase := range t.phases {
+		if phase.duration > slowest.duration {
+			slowest = phase
+		}
+	}
+	return slowest
+}
+
+func (t *requestTimer) String() string {
+	phases := make([]string, 0, len(t.phases))
+	for _, phase := range t.phases {
+		phases = append(phases, fmt.Sprintf("%s=%v", phase.name, phase.duration))
+	}
+	return strings.Join(phases, " ")
+}
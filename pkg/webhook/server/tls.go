@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// certReloader serves the keypair from disk and reloads it when the files change,
+// so a rotated secret is picked up without restarting the webhook
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	reloader := &certReloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// latestModTime the latest modification time of the cert and key, the secret volume swaps both at once
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certPath, c.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// reload loads the keypair when the files changed since the last load, reports whether it was reloaded
+func (c *certReloader) reload() (bool, error) {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return false, fmt.Errorf("stat keypair: %v", err)
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && modTime.Equal(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return false, fmt.Errorf("load keypair: %v", err)
+	}
+
+	// the leaf is what the readiness checks, it is only parsed by LoadX509KeyPair since go 1.23
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("parse certificate: %v", err)
+	}
+	cert.Leaf = leaf
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.mu.Unlock()
+
+	return true, nil
+}
+
+// Run reloads the keypair every interval until stopCh is closed, a failed reload keeps serving the previous keypair
+func (c *certReloader) Run(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				klog.Errorf("reload tls keypair: %v", err)
+				continue
+			}
+
+			if reloaded {
+				klog.Infof("reloaded tls keypair %s", c.certPath)
+			}
+		}
+	}
+}
+
+// GetCertificate the tls.Config hook serving the current keypair
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Leaf the certificate of the keypair being served, which may differ from the files on disk
+// until the next reload, or after a failed one
+func (c *certReloader) Leaf() *x509.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert.Leaf
+}
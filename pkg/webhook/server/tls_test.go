@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// servedCommonName the common name of the certificate the server presents for the server name,
+// a hello without one is answered with the httptest certificate instead of GetCertificate
+func servedCommonName(t *testing.T, addr, serverName string) string {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// touch sets the modification time of the files, so a rewrite within the filesystem's resolution is seen
+func touch(t *testing.T, modTime time.Time, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("touch %s: %v", path, err)
+		}
+	}
+}
+
+func TestCertReloaderServesRotatedCert(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certPath, keyPath := writeTestKeyPair(t, dir, "webhook-old", now.Add(-time.Hour), now.Add(time.Hour))
+
+	reloader, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("new cert reloader: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{GetCertificate: reloader.GetCertificate}
+	server.StartTLS()
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	if cn := servedCommonName(t, addr, "webhook-server.mix-scheduler-system.svc"); cn != "webhook-old" {
+		t.Fatalf("served %s, want webhook-old", cn)
+	}
+
+	// unchanged files are not reloaded
+	if reloaded, err := reloader.reload(); err != nil || reloaded {
+		t.Errorf("reload of unchanged files: reloaded %v, err %v", reloaded, err)
+	}
+
+	writeTestKeyPair(t, dir, "webhook-new", now.Add(-time.Hour), now.Add(time.Hour))
+	touch(t, now.Add(time.Minute), certPath, keyPath)
+
+	if reloaded, err := reloader.reload(); err != nil || !reloaded {
+		t.Fatalf("reload of rotated files: reloaded %v, err %v", reloaded, err)
+	}
+	if cn := servedCommonName(t, addr, "webhook-server.mix-scheduler-system.svc"); cn != "webhook-new" {
+		t.Errorf("served %s after rotation, want webhook-new", cn)
+	}
+}
+
+func TestCertReloaderKeepsCertOnBrokenRotation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certPath, keyPath := writeTestKeyPair(t, dir, "webhook-old", now.Add(-time.Hour), now.Add(time.Hour))
+
+	reloader, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("new cert reloader: %v", err)
+	}
+
+	// the secret volume is half written, the key does not match yet
+	if err := os.WriteFile(keyPath, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	touch(t, now.Add(time.Minute), keyPath)
+
+	if _, err := reloader.reload(); err == nil {
+		t.Fatalf("reload of a broken keypair succeeded")
+	}
+
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("get certificate after a broken rotation: %v, %v", cert, err)
+	}
+	if cert.Leaf != nil && cert.Leaf.Subject.CommonName != "webhook-old" {
+		t.Errorf("serving %s, want the previous webhook-old", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(dir+"/tls.crt", dir+"/tls.key"); err == nil {
+		t.Errorf("new cert reloader of missing files succeeded")
+	}
+}
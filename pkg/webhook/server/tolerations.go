@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// parseTaintEffect parses the effect of the spot toleration, empty tolerates all effects
+func parseTaintEffect(val string) (corev1.TaintEffect, error) {
+	switch effect := corev1.TaintEffect(val); effect {
+	case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		return effect, nil
+	default:
+		return "", fmt.Errorf("invalid taint effect %q, must be one of %s|%s|%s", val,
+			corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+	}
+}
+
+// newSpotToleration the toleration of the spot taint, Equal with a value and Exists without
+func newSpotToleration(key, value string, effect corev1.TaintEffect) *corev1.Toleration {
+	operator := corev1.TolerationOpExists
+	if value != "" {
+		operator = corev1.TolerationOpEqual
+	}
+
+	return &corev1.Toleration{
+		Key:      key,
+		Operator: operator,
+		Value:    value,
+		Effect:   effect,
+	}
+}
+
+// tolerationPatch the patch adding the spot toleration to the pod's tolerations, nil without one or
+// when the pod already has it, the whole list is written so the merged patch mode can compose it
+func (app *App) tolerationPatch(pod *corev1.Pod) []JSONPatchEntry {
+	if app.spotToleration == nil {
+		return nil
+	}
+
+	for _, toleration := range pod.Spec.Tolerations {
+		if toleration.MatchToleration(app.spotToleration) {
+			return nil
+		}
+	}
+
+	tolerations := append(append([]corev1.Toleration{}, pod.Spec.Tolerations...), *app.spotToleration)
+	value, err := json.Marshal(tolerations)
+	if err != nil {
+		klog.Errorf("marshal tolerations: %v", err)
+		return nil
+	}
+
+	return []JSONPatchEntry{
+		{
+			OP:    "add",
+			Path:  "/spec/tolerations",
+			Value: value,
+		},
+	}
+}
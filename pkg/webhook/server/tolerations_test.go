@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestSpotToleration(t *testing.T) {
+	spot := *newSpotToleration("spot", "true", corev1.TaintEffectNoSchedule)
+	gpu := corev1.Toleration{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+
+	tests := []struct {
+		name        string
+		capacity    string
+		tolerations []corev1.Toleration
+		want        []corev1.Toleration
+	}{
+		{name: "empty tolerations", capacity: spotKey, want: []corev1.Toleration{spot}},
+		{name: "pre-populated tolerations are kept", capacity: spotKey, tolerations: []corev1.Toleration{gpu}, want: []corev1.Toleration{gpu, spot}},
+		{name: "already tolerated", capacity: spotKey, tolerations: []corev1.Toleration{gpu, spot}, want: []corev1.Toleration{gpu, spot}},
+		{name: "on-demand pods are not tolerated", capacity: ondemandKey, tolerations: []corev1.Toleration{gpu}, want: []corev1.Toleration{gpu}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			app.spotToleration = newSpotToleration("spot", "true", corev1.TaintEffectNoSchedule)
+
+			pod := testCreatedPod("web")
+			pod.Labels[capacityLabel] = tt.capacity
+			pod.Spec.Tolerations = tt.tolerations
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+			if _, ok := findPatch(patchOf(t, resp), "/spec/tolerations"); ok != (len(tt.want) != len(tt.tolerations)) {
+				t.Errorf("tolerations patched %v, want a patch only when the toleration is added", ok)
+			}
+
+			patched := applyPatch(t, pod, resp)
+			if !equality.Semantic.DeepEqual(patched.Spec.Tolerations, tt.want) {
+				t.Errorf("tolerations %v, want %v", patched.Spec.Tolerations, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpotTolerationUnset(t *testing.T) {
+	app := newTestApp(t, testNode("spot-1", spotKey))
+
+	pod := testCreatedPod("web")
+	pod.Labels[capacityLabel] = spotKey
+
+	if _, ok := findPatch(patchOf(t, mutate(t, app, podReview(t, admissionv1.Create, pod))), "/spec/tolerations"); ok {
+		t.Errorf("tolerations patched without a configured spot toleration")
+	}
+}
+
+func TestNewSpotToleration(t *testing.T) {
+	if op := newSpotToleration("spot", "", "").Operator; op != corev1.TolerationOpExists {
+		t.Errorf("toleration without value operator %s, want Exists", op)
+	}
+	if op := newSpotToleration("spot", "true", "").Operator; op != corev1.TolerationOpEqual {
+		t.Errorf("toleration with value operator %s, want Equal", op)
+	}
+
+	if _, err := parseTaintEffect("NoSchedul"); err == nil {
+		t.Errorf("parse of an invalid taint effect succeeded")
+	}
+}
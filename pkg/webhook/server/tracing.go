@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/version"
+)
+
+const (
+	tracerName  = "github.com/helen-frank/mix-scheduler-admission-webhook/pkg/webhook/server"
+	serviceName = "mix-scheduler-admission-webhook"
+)
+
+// tracer of the admission requests, a no-op until startTracing installs an exporting provider
+var tracer = otel.Tracer(tracerName)
+
+// startTracing exports the spans over OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT, the exporter and the sampler
+// read the other standard OTEL_ env, returns the func flushing and stopping the export
+func startTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// startRequestSpan the root span of an admission request, a child of the trace context of the request headers
+func startRequestSpan(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// endRequestSpan records the phases of the finished timer as child spans and ends the root span with it,
+// the phases are only known once they ended so their spans are back dated
+func endRequestSpan(ctx context.Context, span trace.Span, timer *requestTimer, admissionReview *admissionv1.AdmissionReview) {
+	if !span.IsRecording() {
+		span.End()
+		return
+	}
+
+	start := timer.start
+	for _, phase := range timer.phases {
+		_, phaseSpan := tracer.Start(ctx, phase.name, trace.WithTimestamp(start))
+		start = start.Add(phase.duration)
+		phaseSpan.End(trace.WithTimestamp(start))
+	}
+
+	if req := admissionReview.Request; req != nil {
+		span.SetAttributes(
+			attribute.String("admission.uid", string(req.UID)),
+			attribute.String("admission.kind", req.Kind.Kind),
+			attribute.String("admission.operation", string(req.Operation)),
+			attribute.String("admission.namespace", req.Namespace),
+			attribute.String("admission.name", req.Name),
+		)
+	}
+
+	span.End(trace.WithTimestamp(timer.last))
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// spanRecorder an in-memory exporter of the ended spans
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *spanRecorder) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *spanRecorder) Shutdown(context.Context) error { return nil }
+
+func (r *spanRecorder) ended() []sdktrace.ReadOnlySpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sdktrace.ReadOnlySpan(nil), r.spans...)
+}
+
+// recordSpans exports the spans of the tracer to a recorder for the test, as startTracing would to OTLP
+func recordSpans(t *testing.T) *spanRecorder {
+	t.Helper()
+
+	recorder := &spanRecorder{}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(recorder))
+
+	previousTracer, previousPropagator := tracer, otel.GetTextMapPropagator()
+	tracer = provider.Tracer(tracerName)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		tracer = previousTracer
+		otel.SetTextMapPropagator(previousPropagator)
+		_ = provider.Shutdown(context.Background())
+	})
+
+	return recorder
+}
+
+func TestMutateSpanTree(t *testing.T) {
+	recorder := recordSpans(t)
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+	setMinimums(app, 1, 0)
+
+	body, err := json.Marshal(podReview(t, admissionv1.Create, testCreatedPod("web")))
+	if err != nil {
+		t.Fatalf("marshal review: %v", err)
+	}
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, defaultMutatePath, bytes.NewReader(body))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rec := httptest.NewRecorder()
+	app.HandleMutate(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HandleMutate answered %d", rec.Code)
+	}
+
+	var root sdktrace.ReadOnlySpan
+	children := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.ended() {
+		if span.Name() == "HandleMutate" {
+			root = span
+		} else {
+			children[span.Name()] = span
+		}
+	}
+	if root == nil {
+		t.Fatalf("no HandleMutate span in %d spans", len(recorder.ended()))
+	}
+
+	if got := root.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace id %s, want the incoming %s", got, traceID)
+	}
+	if got := root.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("root parent %s, want the incoming span", got)
+	}
+	if root.SpanKind() != trace.SpanKindServer {
+		t.Errorf("root span kind %v, want server", root.SpanKind())
+	}
+
+	for _, phase := range []string{"decode", "placement", "respond"} {
+		span, ok := children[phase]
+		if !ok {
+			t.Errorf("no %s span", phase)
+			continue
+		}
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s span is not a child of HandleMutate", phase)
+		}
+		if span.StartTime().Before(root.StartTime()) || span.EndTime().After(root.EndTime()) {
+			t.Errorf("%s span %v-%v outside of HandleMutate %v-%v", phase, span.StartTime(), span.EndTime(), root.StartTime(), root.EndTime())
+		}
+	}
+}
+
+func TestSpansNoopUnconfigured(t *testing.T) {
+	ctx, span := startRequestSpan(httptest.NewRequest(http.MethodPost, defaultMutatePath, nil), "HandleMutate")
+	defer span.End()
+
+	if span.IsRecording() || trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		t.Errorf("span recorded without an exporter configured")
+	}
+}
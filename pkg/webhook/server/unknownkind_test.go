@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestUnknownKindAllowed(t *testing.T) {
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: testNamespace}}
+	raw, err := json.Marshal(cm)
+	if err != nil {
+		t.Fatalf("marshal configmap: %v", err)
+	}
+
+	for _, operation := range []admissionv1.Operation{admissionv1.Create, admissionv1.Delete} {
+		t.Run(string(operation), func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			setMinimums(app, 1, 0)
+
+			request := &admissionv1.AdmissionRequest{
+				UID:       "uid-configmap",
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+				Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+				Namespace: cm.Namespace,
+				Name:      cm.Name,
+				Operation: operation,
+			}
+			if operation == admissionv1.Delete {
+				request.OldObject = runtime.RawExtension{Raw: raw}
+			} else {
+				request.Object = runtime.RawExtension{Raw: raw}
+			}
+			review := &admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+				Request:  request,
+			}
+
+			unknown := unknownKindsTotal.WithLabelValues("", "ConfigMap")
+			before := counterValue(t, unknown)
+
+			resp := mutate(t, app, review)
+			if !resp.Allowed || resp.Patch != nil {
+				t.Errorf("configmap allowed %v with patch %s, want it allowed unchanged", resp.Allowed, resp.Patch)
+			}
+			if got := counterValue(t, unknown) - before; got != 1 {
+				t.Errorf("mix_scheduler_unknown_kinds_total increased by %v, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// HandleValidate rejects pod creates pinning themselves to spot nodes while the workload
+// has no on-demand pod ready, which would break the on-demand minimum. A spot pin the placement
+// of /mutate decides for the pod is its own and allowed, the strategies decide the same on the same counts
+func (app *App) HandleValidate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startRequestSpan(r, "HandleValidate")
+	timer := newRequestTimer()
+	admissionReview := &admissionv1.AdmissionReview{}
+	defer func() {
+		app.observeLatency(timer, admissionReview)
+		endRequestSpan(ctx, span, timer, admissionReview)
+	}()
+
+	release, ok := app.startAdmission(w, r, admissionReview)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if admissionReview.Request.Kind.Kind != "Pod" || admissionReview.Request.Operation != admissionv1.Create {
+		recordAdmission(admissionReview, decisionAllowed)
+		writeNil(w, admissionReview)
+		return
+	}
+
+	pod, ok := app.admissionPod(w, r, admissionReview, timer)
+	if !ok {
+		return
+	}
+
+	ondemandMin, _ := app.minPodNums(pod.Namespace)
+	if ondemandMin > 0 && app.podPinnedToCapacity(pod.Spec, spotKey) {
+		// /mutate ran first, its own spot pins are not the user's, e.g. of the capacity label or OVERFLOW_TO_SPOT
+		plan, err := app.strategy.Decide(app.Ctx, pod)
+		if err != nil {
+			recordAdmission(admissionReview, decisionDenied)
+			app.HandleError(w, r, admissionReview, err)
+			return
+		}
+		if plan.Capacity == spotKey {
+			recordAdmission(admissionReview, decisionAllowed)
+			writeNil(w, admissionReview)
+			return
+		}
+
+		ready, err := app.podExistAndReadyOnNodeCapacityNum(ondemandKey, pod)
+		timer.mark("count")
+		if err != nil {
+			recordAdmission(admissionReview, decisionDenied)
+			app.HandleError(w, r, admissionReview, err)
+			return
+		}
+		if ready == 0 {
+			recordAdmission(admissionReview, decisionDenied)
+			app.HandleError(w, r, admissionReview, fmt.Errorf("pod pins itself to %s nodes but the workload has no ready %s pod, at least %d required",
+				spotKey, ondemandKey, ondemandMin))
+			return
+		}
+	}
+
+	recordAdmission(admissionReview, decisionAllowed)
+	writeNil(w, admissionReview)
+}
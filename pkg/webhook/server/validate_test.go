@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// validate posts the AdmissionReview to HandleValidate, fails the test unless it is answered with status 200
+func validate(t *testing.T, app *App, review *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	code, resp := postReview(t, app.HandleValidate, review)
+	if code != http.StatusOK || resp == nil {
+		t.Fatalf("HandleValidate answered %d without an AdmissionReview", code)
+	}
+
+	return resp.Response
+}
+
+// spotPinnedPod a created pod pinning itself to spot by its nodeSelector
+func spotPinnedPod() *corev1.Pod {
+	pod := testCreatedPod("web")
+	pod.Spec.NodeSelector = map[string]string{capacityKey: spotKey}
+	return pod
+}
+
+func TestHandleValidate(t *testing.T) {
+	nodes := []runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+
+	bypassed := spotPinnedPod()
+	bypassed.Annotations = map[string]string{bypassAnnotation: "true"}
+
+	daemonSetPod := ownedBy(spotPinnedPod(), "DaemonSet", "agent")
+
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		pod      *corev1.Pod
+		allowed  bool
+	}{
+		{name: "spot pin without a ready on-demand pod is denied", pod: spotPinnedPod()},
+		{name: "spot pin with a ready on-demand pod is allowed", existing: []runtime.Object{testPod("web-1", "web", "od-1")}, pod: spotPinnedPod(), allowed: true},
+		{name: "unpinned pod is allowed", pod: testCreatedPod("web"), allowed: true},
+		{name: "bypassed pod is allowed", pod: bypassed, allowed: true},
+		{name: "daemonset pod is allowed", pod: daemonSetPod, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append(append([]runtime.Object{}, nodes...), tt.existing...)...)
+			app.envConfig.OnDemandMinPodNum = 1
+			app.setReloadableConfig(app.envConfig)
+
+			resp := validate(t, app, podReview(t, admissionv1.Create, tt.pod))
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("allowed %v, want %v: %v", resp.Allowed, tt.allowed, resp.Result)
+			}
+			if !resp.Allowed && resp.Result.Code != http.StatusBadRequest {
+				t.Errorf("denied with code %d, want %d like the mutating denials", resp.Result.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestHandleValidateCountErrorFollowsFailurePolicy(t *testing.T) {
+	for policy, allowed := range map[failurePolicy]bool{failurePolicyFail: false, failurePolicyIgnore: true} {
+		t.Run(string(policy), func(t *testing.T) {
+			app := newTestAppWithClient(t, failingNodeList())
+			app.failurePolicy = policy
+			app.envConfig.OnDemandMinPodNum = 1
+			app.setReloadableConfig(app.envConfig)
+
+			if resp := validate(t, app, podReview(t, admissionv1.Create, spotPinnedPod())); resp.Allowed != allowed {
+				t.Errorf("allowed %v, want %v: %v", resp.Allowed, allowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestHandleValidateUnsynced(t *testing.T) {
+	app := newUnsyncedApp(t, testNode("od-1", ondemandKey))
+	app.cacheSyncWait = 100 * time.Millisecond
+	app.envConfig.OnDemandMinPodNum = 1
+	app.setReloadableConfig(app.envConfig)
+
+	if resp := validate(t, app, podReview(t, admissionv1.Create, spotPinnedPod())); !resp.Allowed {
+		t.Errorf("pod denied before the cache synced: %v", resp.Result)
+	}
+}
+
+// admit the pod through /mutate and then /validate like the API server, returns the patched pod
+// and the response of /validate
+func admit(t *testing.T, app *App, pod *corev1.Pod) (*corev1.Pod, *admissionv1.AdmissionResponse) {
+	t.Helper()
+
+	patched := applyPatch(t, pod, mutate(t, app, podReview(t, admissionv1.Create, pod)))
+	return patched, validate(t, app, podReview(t, admissionv1.Create, patched))
+}
+
+// the spot pins of the placement are allowed while the first on-demand pod is still starting
+func TestHandleValidateAllowsPlacedSpotPins(t *testing.T) {
+	weights := map[string]string{ondemandWeithtKey: "50", spotWeithtKey: "50"}
+
+	tests := []struct {
+		name  string
+		setup func(app *App)
+		pod   func() *corev1.Pod
+		// the first on-demand pod of the workload, not ready yet
+		starting *corev1.Pod
+	}{
+		{
+			name:  "weighted",
+			setup: func(app *App) { app.capacityMode = capacityWeighted },
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				for key, val := range weights {
+					pod.Labels[key] = val
+				}
+				return pod
+			},
+			starting: func() *corev1.Pod {
+				pod := notReady(testPod("web-1", "web", "od-1"))
+				for key, val := range weights {
+					pod.Labels[key] = val
+				}
+				return pod
+			}(),
+		},
+		{
+			name:  "statefulset ordinal",
+			setup: func(app *App) { app.statefulSetOrdinalPlacement = true },
+			pod: func() *corev1.Pod {
+				pod := statefulSetPod("db-1", "db", "")
+				pod.UID = ""
+				pod.Status = corev1.PodStatus{}
+				return pod
+			},
+			starting: notReady(statefulSetPod("db-0", "db", "od-1")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), tt.starting)
+			setMinimums(app, 1, 0)
+			tt.setup(app)
+			app.strategy = newPlacementStrategy(app, app.capacityMode)
+
+			patched, resp := admit(t, app, tt.pod())
+			if got := patched.Spec.NodeSelector[capacityKey]; got != spotKey {
+				t.Fatalf("nodeSelector capacity %q, want %q", got, spotKey)
+			}
+			if !resp.Allowed {
+				t.Errorf("spot pin of the placement denied: %v", resp.Result)
+			}
+		})
+	}
+
+	// the same pin written by the user is still denied
+	app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey), notReady(testPod("web-1", "web", "od-1")))
+	setMinimums(app, 1, 0)
+	if resp := validate(t, app, podReview(t, admissionv1.Create, spotPinnedPod())); resp.Allowed {
+		t.Errorf("spot pin of the user allowed without a ready on-demand pod")
+	}
+}
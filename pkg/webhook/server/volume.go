@@ -0,0 +1,75 @@
+package server
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// volumeNodeSelectors the required node affinity of the persistent volumes bound to the pod's claims,
+// claims not bound yet (e.g. WaitForFirstConsumer) or not created yet do not restrict the nodes
+func (app *App) volumeNodeSelectors(pod *corev1.Pod) ([]*corev1.NodeSelector, error) {
+	var selectors []*corev1.NodeSelector
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		pvc, err := app.GetPersistentVolumeClaim(pod.Namespace, volume.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// the pod waits for the claim like for an unbound one
+			continue
+		}
+		if err != nil {
+			return nil, internalErrorf("get persistentvolumeclaim %s/%s: %v", pod.Namespace, volume.PersistentVolumeClaim.ClaimName, err)
+		}
+
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+
+		pv, err := app.GetPersistentVolume(pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, internalErrorf("get persistentvolume %s: %v", pvc.Spec.VolumeName, err)
+		}
+
+		if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+			selectors = append(selectors, pv.Spec.NodeAffinity.Required)
+		}
+	}
+
+	return selectors, nil
+}
+
+// volumesAllowCapacity reports whether any node of the capacity satisfies the node affinity of all the pod's volumes
+func (app *App) volumesAllowCapacity(pod *corev1.Pod, capacity string) (bool, error) {
+	selectors, err := app.volumeNodeSelectors(pod)
+	if err != nil {
+		return false, err
+	}
+
+	if len(selectors) == 0 {
+		return true, nil
+	}
+
+	nodes, err := app.ListNode(app.capacitySelector(capacity))
+	if err != nil {
+		return false, internalErrorf("get %s nodes: %v", capacity, err)
+	}
+
+	for _, node := range nodes {
+		matched := true
+		for _, selector := range selectors {
+			if !nodeMatchesNodeSelector(node, selector) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testClaimPod(claimName string) *corev1.Pod {
+	pod := testCreatedPod("db")
+	pod.Spec.Volumes = []corev1.Volume{{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+		},
+	}}
+	return pod
+}
+
+// testZonedVolume a volume bound to the claim, only usable on the nodes labeled with the zone
+func testZonedVolume(claimName, zone string) (*corev1.PersistentVolumeClaim, *corev1.PersistentVolume) {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: claimName, Namespace: testNamespace},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-" + claimName},
+	}
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-" + claimName},
+		Spec: corev1.PersistentVolumeSpec{
+			NodeAffinity: &corev1.VolumeNodeAffinity{Required: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{{
+					Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{zone},
+				}}}},
+			}},
+		},
+	}
+	return pvc, pv
+}
+
+func TestVolumeNodeAffinity(t *testing.T) {
+	node := testNode("od-1", ondemandKey)
+	node.Labels["topology.kubernetes.io/zone"] = "a"
+
+	otherZoneClaim, otherZoneVolume := testZonedVolume("data-b", "b")
+	sameZoneClaim, sameZoneVolume := testZonedVolume("data-a", "a")
+
+	tests := []struct {
+		name    string
+		claim   string
+		objects []runtime.Object
+		pinned  bool
+	}{
+		{name: "claim not created yet", claim: "missing", pinned: true},
+		{name: "unbound claim", claim: "unbound", objects: []runtime.Object{
+			&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "unbound", Namespace: testNamespace}},
+		}, pinned: true},
+		{name: "volume in the capacity's zone", claim: "data-a", objects: []runtime.Object{sameZoneClaim, sameZoneVolume}, pinned: true},
+		{name: "volume outside the capacity's zone", claim: "data-b", objects: []runtime.Object{otherZoneClaim, otherZoneVolume}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, append([]runtime.Object{node}, tt.objects...)...)
+			app.checkVolumeNodeAffinity = true
+			app.envConfig.OnDemandMinPodNum = 1
+			app.setReloadableConfig(app.envConfig)
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, testClaimPod(tt.claim)))
+			if !resp.Allowed {
+				t.Fatalf("pod denied: %v", resp.Result)
+			}
+
+			_, pinned := findPatch(patchOf(t, resp), "/spec/nodeSelector")
+			if pinned != tt.pinned {
+				t.Errorf("pinned %v, want %v: %s", pinned, tt.pinned, resp.Patch)
+			}
+		})
+	}
+}
+
+func TestVolumeClaimErrorIsInternal(t *testing.T) {
+	client := fake.NewSimpleClientset(testNode("od-1", ondemandKey))
+	client.PrependReactor("get", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("persistentvolumeclaims unavailable")
+	})
+	app := newTestAppWithClient(t, client)
+
+	if _, err := app.volumeNodeSelectors(testClaimPod("data")); !isInternalError(err) {
+		t.Errorf("claim error %v, want an internal error", err)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// labelWarnings warns about a mix-scheduler label value which silently opts the pod out,
+// only "true" controls the pod and "false" is the intended way to opt out
+func labelWarnings(podLabels map[string]string) []string {
+	val, ok := podLabels[mixSchedulerKey]
+	if !ok || val == "" || val == "true" || val == "false" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("label %s=%q is neither \"true\" nor \"false\", the pod is not placed by the mix scheduler", mixSchedulerKey, val)}
+}
+
+// capacityOverrideWarnings warns when the patch overrides the capacity the pod's own nodeSelector asks for
+func capacityOverrideWarnings(pod *corev1.Pod, patch []JSONPatchEntry) []string {
+	requested, ok := pod.Spec.NodeSelector[capacityKey]
+	if !ok {
+		return nil
+	}
+
+	for _, entry := range patch {
+		if entry.OP != "add" || entry.Path != "/spec/nodeSelector/"+escapeJSONPointer(capacityKey) {
+			continue
+		}
+
+		var capacity string
+		if err := json.Unmarshal(entry.Value, &capacity); err != nil || capacity == requested {
+			continue
+		}
+
+		return []string{fmt.Sprintf("nodeSelector %s=%s is overridden with %s by the mix scheduler", capacityKey, requested, capacity)}
+	}
+
+	return nil
+}
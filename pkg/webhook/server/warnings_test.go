@@ -0,0 +1,70 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAdmissionWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      func() *corev1.Pod
+		contains string
+	}{
+		{
+			name: "label value opting out by accident",
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Labels[mixSchedulerKey] = "yes"
+				return pod
+			},
+			contains: mixSchedulerKey + `="yes"`,
+		},
+		{
+			name: "nodeSelector capacity overridden",
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Spec.NodeSelector = map[string]string{capacityKey: spotKey}
+				return pod
+			},
+			contains: "nodeSelector " + capacityKey + "=" + spotKey + " is overridden with " + ondemandKey,
+		},
+		{
+			name: "label opting out on purpose",
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Labels[mixSchedulerKey] = "false"
+				return pod
+			},
+		},
+		{
+			name: "nodeSelector capacity kept",
+			pod: func() *corev1.Pod {
+				pod := testCreatedPod("web")
+				pod.Spec.NodeSelector = map[string]string{capacityKey: ondemandKey}
+				return pod
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey), testNode("spot-1", spotKey))
+			setMinimums(app, 1, 0)
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, tt.pod()))
+			if tt.contains == "" {
+				if len(resp.Warnings) != 0 {
+					t.Errorf("warnings %q, want none", resp.Warnings)
+				}
+				return
+			}
+			if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], tt.contains) {
+				t.Errorf("warnings %q, want one containing %q", resp.Warnings, tt.contains)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// capacityMode decides how the target capacity of a created pod is chosen
+type capacityMode string
+
+const (
+	// pin pods to on-demand until OnDemandMinPodNum of them exist
+	capacityMinimum capacityMode = "minimum"
+	// pin pods to the capacity which keeps the workload closest to the ratio of its
+	// on-demand/weight and spot/weight labels, pods without them fall back to minimum
+	capacityWeighted capacityMode = "weighted"
+)
+
+func parseCapacityMode(val string) (capacityMode, error) {
+	switch mode := capacityMode(val); mode {
+	case capacityMinimum, capacityWeighted:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid capacity mode %q, must be one of %s|%s", val, capacityMinimum, capacityWeighted)
+	}
+}
+
+// podWeights the on-demand and spot weights from the pod's labels, ok is false unless both are
+// non-negative integers and one of them is positive
+func podWeights(podLabels map[string]string) (ondemandWeight, spotWeight int, ok bool) {
+	ondemandVal, ondemandOk := podLabels[ondemandWeithtKey]
+	spotVal, spotOk := podLabels[spotWeithtKey]
+	if !ondemandOk || !spotOk {
+		return 0, 0, false
+	}
+
+	ondemandWeight, err := strconv.Atoi(ondemandVal)
+	if err != nil || ondemandWeight < 0 {
+		return 0, 0, false
+	}
+
+	spotWeight, err = strconv.Atoi(spotVal)
+	if err != nil || spotWeight < 0 {
+		return 0, 0, false
+	}
+
+	if ondemandWeight+spotWeight == 0 {
+		return 0, 0, false
+	}
+
+	return ondemandWeight, spotWeight, true
+}
+
+// weightedCapacity the capacity of the next pod so the on-demand share converges to
+// ondemandWeight / (ondemandWeight + spotWeight), on-demand wins while it is below its share
+func weightedCapacity(ondemandNum, spotNum, ondemandWeight, spotWeight int) string {
+	// ondemand / (total + 1) < ondemandWeight / (ondemandWeight + spotWeight), without the division
+	if ondemandNum*(ondemandWeight+spotWeight) < ondemandWeight*(ondemandNum+spotNum+1) {
+		return ondemandKey
+	}
+
+	return spotKey
+}
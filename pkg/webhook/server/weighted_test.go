@@ -0,0 +1,129 @@
+package server
+
+import (
+	"math"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestWeightedCapacityConverges(t *testing.T) {
+	tests := []struct {
+		name                       string
+		ondemandWeight, spotWeight int
+		replicas                   int
+		ondemand                   int
+	}{
+		{name: "30/70 of 10", ondemandWeight: 30, spotWeight: 70, replicas: 10, ondemand: 3},
+		{name: "1/1 of 4", ondemandWeight: 1, spotWeight: 1, replicas: 4, ondemand: 2},
+		{name: "1/3 of 8", ondemandWeight: 1, spotWeight: 3, replicas: 8, ondemand: 2},
+		{name: "2/1 of 9", ondemandWeight: 2, spotWeight: 1, replicas: 9, ondemand: 6},
+		{name: "all on-demand", ondemandWeight: 1, spotWeight: 0, replicas: 5, ondemand: 5},
+		{name: "all spot", ondemandWeight: 0, spotWeight: 1, replicas: 5, ondemand: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share := float64(tt.ondemandWeight) / float64(tt.ondemandWeight+tt.spotWeight)
+
+			ondemand, spot := 0, 0
+			for i := 1; i <= tt.replicas; i++ {
+				if weightedCapacity(ondemand, spot, tt.ondemandWeight, tt.spotWeight) == ondemandKey {
+					ondemand++
+				} else {
+					spot++
+				}
+
+				// every scale up stays within a pod of the ratio
+				if diff := math.Abs(float64(ondemand) - share*float64(i)); diff >= 1 {
+					t.Fatalf("%d on-demand of %d pods, %v off the ratio", ondemand, i, diff)
+				}
+			}
+
+			if ondemand != tt.ondemand {
+				t.Errorf("%d on-demand of %d pods, want %d", ondemand, tt.replicas, tt.ondemand)
+			}
+		})
+	}
+}
+
+func TestPodWeights(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		ok     bool
+	}{
+		{name: "both weights", labels: map[string]string{ondemandWeithtKey: "30", spotWeithtKey: "70"}, ok: true},
+		{name: "one weight zero", labels: map[string]string{ondemandWeithtKey: "0", spotWeithtKey: "1"}, ok: true},
+		{name: "a weight missing", labels: map[string]string{ondemandWeithtKey: "30"}},
+		{name: "both weights zero", labels: map[string]string{ondemandWeithtKey: "0", spotWeithtKey: "0"}},
+		{name: "a negative weight", labels: map[string]string{ondemandWeithtKey: "-1", spotWeithtKey: "2"}},
+		{name: "not a number", labels: map[string]string{ondemandWeithtKey: "half", spotWeithtKey: "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := podWeights(tt.labels); ok != tt.ok {
+				t.Errorf("ok %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWeightedPlacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []*corev1.Pod
+		weights  map[string]string
+		want     string
+	}{
+		{
+			name:     "on-demand below its share",
+			existing: []*corev1.Pod{testPod("web-1", "web", "spot-1"), testPod("web-2", "web", "spot-1")},
+			weights:  map[string]string{ondemandWeithtKey: "50", spotWeithtKey: "50"},
+			want:     ondemandKey,
+		},
+		{
+			name:     "on-demand at its share",
+			existing: []*corev1.Pod{testPod("web-1", "web", "od-1"), testPod("web-2", "web", "spot-1")},
+			weights:  map[string]string{ondemandWeithtKey: "30", spotWeithtKey: "70"},
+			want:     spotKey,
+		},
+		{
+			name:     "without weights the minimum applies",
+			existing: []*corev1.Pod{testPod("web-1", "web", "spot-1"), testPod("web-2", "web", "spot-1")},
+			want:     ondemandKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the pods of the workload carry the same weight labels, they select its pods
+			objects := []runtime.Object{testNode("od-1", ondemandKey), testNode("spot-1", spotKey)}
+			for _, pod := range tt.existing {
+				for key, val := range tt.weights {
+					pod.Labels[key] = val
+				}
+				objects = append(objects, pod)
+			}
+
+			app := newTestApp(t, objects...)
+			setMinimums(app, 1, 0)
+			app.capacityMode = capacityWeighted
+			app.strategy = newPlacementStrategy(app, app.capacityMode)
+
+			pod := testCreatedPod("web")
+			for key, val := range tt.weights {
+				pod.Labels[key] = val
+			}
+
+			var selector map[string]string
+			decodePatchValue(t, patchOf(t, mutate(t, app, podReview(t, admissionv1.Create, pod))), "/spec/nodeSelector", &selector)
+			if selector[capacityKey] != tt.want {
+				t.Errorf("pinned to %q, want %q", selector[capacityKey], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// workloadTemplate unmarshal the Deployment or StatefulSet of the request, returns its namespace and pod template
+func workloadTemplate(req *admissionv1.AdmissionRequest) (string, *corev1.PodTemplateSpec, error) {
+	var meta metav1.ObjectMeta
+	var template *corev1.PodTemplateSpec
+
+	switch req.Kind.Kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := json.Unmarshal(req.Object.Raw, deployment); err != nil {
+			return "", nil, fmt.Errorf("unmarshal to deployment: %v", err)
+		}
+		meta, template = deployment.ObjectMeta, &deployment.Spec.Template
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := json.Unmarshal(req.Object.Raw, statefulSet); err != nil {
+			return "", nil, fmt.Errorf("unmarshal to statefulset: %v", err)
+		}
+		meta, template = statefulSet.ObjectMeta, &statefulSet.Spec.Template
+	default:
+		return "", nil, fmt.Errorf("unsupported workload kind %s", req.Kind.Kind)
+	}
+
+	namespace := meta.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+
+	return namespace, template, nil
+}
+
+// workloadCreateOperation places the pod template of a Deployment or StatefulSet, what holds for every replica:
+// the pod anti-affinity, the spot toleration unless the workload is pinned to on-demand, and the nodeSelector
+// of a workload pinned by its capacity label. The capacity of a mixed workload is still pinned per pod,
+// a template nodeSelector would put every replica on the same capacity
+func workloadCreateOperation(app *App, admissionReview *admissionv1.AdmissionReview) (*admissionv1.AdmissionReview, error) {
+	namespace, template, err := workloadTemplate(admissionReview.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.instanceIsSkip(namespace, template.Labels) {
+		klog.Info("instance is skip")
+		return nil, nil
+	}
+
+	kind, name := admissionReview.Request.Kind.Kind, admissionReview.Request.Name
+	// the pods of the template, the pod patches are moved below /spec/template
+	pod := &corev1.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}
+
+	var patch []JSONPatchEntry
+	capacity := forcedCapacity(template.Labels)
+	if capacity != "" {
+		if app.nodeAffinityAllowsCapacity(template.Spec, capacity) {
+			nodeSelectorPatch, err := nodeSelectorPatch(pod, app.capacityValues(capacity)[0])
+			if err != nil {
+				return nil, err
+			}
+			patch = append(patch, nodeSelectorPatch)
+		} else {
+			klog.Infof("%s %s/%s node affinity conflicts with %s placement, left to its pods", kind, namespace, name, capacity)
+		}
+	}
+
+	if app.skipAntiAffinity(template.Spec, app.AntiAffinityTopologyKey) {
+		klog.Infof("%s %s/%s topology spread constraints cover %s, skip anti-affinity", kind, namespace, name, app.AntiAffinityTopologyKey)
+	} else {
+		affinity := FillAffinity(template.Spec)
+		appendPodAntiAffinityTerm(affinity, corev1.WeightedPodAffinityTerm{
+			Weight: app.AntiAffinityWeight,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				TopologyKey:   app.AntiAffinityTopologyKey,
+				LabelSelector: antiAffinitySelector(template.Labels),
+			},
+		})
+
+		affinityBytes, err := json.Marshal(affinity)
+		if err != nil {
+			return nil, internalErrorf("marshal affinity: %v", err)
+		}
+
+		patch = append(patch, JSONPatchEntry{
+			OP:    "add",
+			Path:  "/spec/affinity",
+			Value: affinityBytes,
+		})
+	}
+
+	// the replicas above the on-demand minimum may run on spot
+	if capacity != ondemandKey {
+		patch = append(patch, app.tolerationPatch(pod)...)
+	}
+
+	if len(patch) == 0 {
+		return nil, nil
+	}
+
+	for i := range patch {
+		patch[i].Path = templatePath(patch[i].Path)
+	}
+
+	if app.dryRun {
+		patchBytes, err := json.Marshal(&patch)
+		if err != nil {
+			return nil, internalErrorf("marshal patch: %v", err)
+		}
+
+		klog.Infof("dry run, %s %s/%s patch: %s", kind, namespace, name, patchBytes)
+		return nil, nil
+	}
+
+	return patchAdmissionReview(admissionReview, patch)
+}
+
+// templatePath the path of a pod patch within the pod template of a workload
+func templatePath(podPath string) string {
+	return "/spec/template" + podPath
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// workloadReview an AdmissionReview of the create of a Deployment or StatefulSet with the pod labels
+func workloadReview(t *testing.T, kind string, podLabels map[string]string) *admissionv1.AdmissionReview {
+	t.Helper()
+
+	meta := metav1.ObjectMeta{Name: "web", Namespace: testNamespace}
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "nginx"}}},
+	}
+
+	var object interface{}
+	switch kind {
+	case "Deployment":
+		object = &appsv1.Deployment{ObjectMeta: meta, Spec: appsv1.DeploymentSpec{Template: template}}
+	case "StatefulSet":
+		object = &appsv1.StatefulSet{ObjectMeta: meta, Spec: appsv1.StatefulSetSpec{Template: template}}
+	}
+
+	raw, err := json.Marshal(object)
+	if err != nil {
+		t.Fatalf("marshal %s: %v", kind, err)
+	}
+
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("uid-" + kind),
+			Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind},
+			Resource:  metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: strings.ToLower(kind) + "s"},
+			Namespace: testNamespace,
+			Name:      "web",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
+
+// templateAntiAffinity the patch of the template's anti-affinity selecting the pods by the labels
+func templateAntiAffinity(matchLabels string) string {
+	return `{"op":"add","path":"/spec/template/spec/affinity","value":{"podAntiAffinity":{"preferredDuringSchedulingIgnoredDuringExecution":` +
+		`[{"weight":100,"podAffinityTerm":{"labelSelector":{"matchLabels":` + matchLabels + `},"topologyKey":"kubernetes.io/hostname"}}]}}}`
+}
+
+func TestWorkloadCreateOperation(t *testing.T) {
+	const toleration = `{"op":"add","path":"/spec/template/spec/tolerations","value":[{"key":"spot","operator":"Exists"}]}`
+
+	tests := []struct {
+		name     string
+		capacity string
+		patch    string
+	}{
+		{
+			name:  "mixed gets the anti-affinity and the spot toleration",
+			patch: `[` + templateAntiAffinity(`{"app":"web"}`) + `,` + toleration + `]`,
+		},
+		{
+			name:     "on-demand gets the nodeSelector and no toleration",
+			capacity: ondemandKey,
+			patch: `[{"op":"add","path":"/spec/template/spec/nodeSelector","value":{"node.kubernetes.io/capacity":"on-demand"}},` +
+				templateAntiAffinity(`{"app":"web","mix-scheduler/capacity":"on-demand"}`) + `]`,
+		},
+		{
+			name:     "spot gets the nodeSelector and the toleration",
+			capacity: spotKey,
+			patch: `[{"op":"add","path":"/spec/template/spec/nodeSelector","value":{"node.kubernetes.io/capacity":"spot"}},` +
+				templateAntiAffinity(`{"app":"web","mix-scheduler/capacity":"spot"}`) + `,` + toleration + `]`,
+		},
+	}
+
+	for _, kind := range []string{"Deployment", "StatefulSet"} {
+		for _, tt := range tests {
+			t.Run(kind+"/"+tt.name, func(t *testing.T) {
+				app := newTestApp(t)
+				app.spotToleration = newSpotToleration("spot", "", "")
+
+				podLabels := map[string]string{"app": "web"}
+				if tt.capacity != "" {
+					podLabels[capacityLabel] = tt.capacity
+				}
+
+				resp := mutate(t, app, workloadReview(t, kind, podLabels))
+				if !resp.Allowed {
+					t.Fatalf("%s denied: %v", kind, resp.Result)
+				}
+				if string(resp.Patch) != tt.patch {
+					t.Errorf("patch\n%s\nwant\n%s", resp.Patch, tt.patch)
+				}
+			})
+		}
+	}
+}
+
+// a replica created from a placed template does not get a second anti-affinity term for its controller labels
+func TestPodAntiAffinityDedupedWithTemplate(t *testing.T) {
+	tests := []struct {
+		name            string
+		controllerLabel map[string]string
+	}{
+		{name: "deployment pod", controllerLabel: map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5d4f8c"}},
+		{name: "statefulset pod", controllerLabel: map[string]string{
+			appsv1.ControllerRevisionHashLabelKey: "web-7b9d",
+			appsv1.StatefulSetPodNameLabel:        "web-0",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, testNode("od-1", ondemandKey))
+			app.envConfig.OnDemandMinPodNum = 1
+			app.setReloadableConfig(app.envConfig)
+
+			pod := testCreatedPod("web")
+			for key, value := range tt.controllerLabel {
+				pod.Labels[key] = value
+			}
+			pod.Spec.Affinity = FillAffinity(pod.Spec)
+			appendPodAntiAffinityTerm(pod.Spec.Affinity, corev1.WeightedPodAffinityTerm{
+				Weight: app.AntiAffinityWeight,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					TopologyKey:   app.AntiAffinityTopologyKey,
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				},
+			})
+
+			resp := mutate(t, app, podReview(t, admissionv1.Create, pod))
+
+			var affinity corev1.Affinity
+			decodePatchValue(t, patchOf(t, resp), "/spec/affinity", &affinity)
+			if terms := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution; len(terms) != 1 {
+				t.Errorf("%d anti-affinity terms, want the template's alone: %s", len(terms), mustJSON(t, terms))
+			}
+		})
+	}
+}
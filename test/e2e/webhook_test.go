@@ -0,0 +1,194 @@
+//go:build integration
+
+// Package e2e runs the webhook against a real API server started by envtest, run it with
+//
+//	KUBEBUILDER_ASSETS=$(setup-envtest use -p path 1.30.x) go test -tags integration ./test/e2e/
+package e2e
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/helen-frank/mix-scheduler-admission-webhook/pkg/webhook/server"
+)
+
+const (
+	capacityKey = "node.kubernetes.io/capacity"
+	namespace   = "default"
+)
+
+// startEnv starts the API server with the MutatingWebhookConfiguration of deploy.sh registered
+// and the webhook serving it in process, returns the client of the API server
+func startEnv(t *testing.T) kubernetes.Interface {
+	t.Helper()
+
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS not set, see setup-envtest")
+	}
+
+	// envtest points the service at the in-process server, the path is appended after a slash
+	path := "mutate"
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	env := &envtest.Environment{
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			MutatingWebhooks: []*admissionregistrationv1.MutatingWebhookConfiguration{{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo-webhook"},
+				Webhooks: []admissionregistrationv1.MutatingWebhook{{
+					Name:                    "webhook-server.mix-scheduler-system.svc",
+					AdmissionReviewVersions: []string{"v1"},
+					SideEffects:             &sideEffects,
+					FailurePolicy:           &failurePolicy,
+					ClientConfig: admissionregistrationv1.WebhookClientConfig{
+						Service: &admissionregistrationv1.ServiceReference{Name: "webhook-server", Namespace: "mix-scheduler-system", Path: &path},
+					},
+					Rules: []admissionregistrationv1.RuleWithOperations{{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{""},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"pods"},
+						},
+					}},
+				}},
+			}},
+		},
+	}
+
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("start envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("stop envtest: %v", err)
+		}
+	})
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	opts := env.WebhookInstallOptions
+	addr := net.JoinHostPort(opts.LocalServingHost, strconv.Itoa(opts.LocalServingPort))
+	srv := &http.Server{Addr: addr, Handler: server.BuildRouter(server.NewApp(ctx, client))}
+	go func() {
+		err := srv.ListenAndServeTLS(filepath.Join(opts.LocalServingCertDir, "tls.crt"), filepath.Join(opts.LocalServingCertDir, "tls.key"))
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("serve webhook: %v", err)
+		}
+	}()
+	t.Cleanup(func() { srv.Close() })
+
+	// the API server fails the creates until the webhook serves
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("webhook not serving on %s: %v", addr, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return client
+}
+
+func createNode(t *testing.T, client kubernetes.Interface, name, capacity string) {
+	t.Helper()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{capacityKey: capacity}}}
+	if _, err := client.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create node %s: %v", name, err)
+	}
+}
+
+// createPod creates a pod of the app through the webhook, returns the pod as stored by the API server
+func createPod(t *testing.T, client kubernetes.Interface, name, app string, nodeSelector map[string]string) *corev1.Pod {
+	t.Helper()
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": app}},
+		Spec: corev1.PodSpec{
+			NodeSelector: nodeSelector,
+			Containers:   []corev1.Container{{Name: "main", Image: "nginx"}},
+		},
+	}
+
+	created, err := client.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create pod %s: %v", name, err)
+	}
+
+	return created
+}
+
+// antiAffinityTerm the injected pod anti-affinity term over the hostname, nil when there is none
+func antiAffinityTerm(pod *corev1.Pod) *corev1.WeightedPodAffinityTerm {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.PodAntiAffinity == nil {
+		return nil
+	}
+
+	for i, term := range pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if term.PodAffinityTerm.TopologyKey == "kubernetes.io/hostname" {
+			return &pod.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[i]
+		}
+	}
+	return nil
+}
+
+func TestMutatePodCreate(t *testing.T) {
+	client := startEnv(t)
+
+	createNode(t, client, "od-1", "on-demand")
+	createNode(t, client, "spot-1", "spot")
+
+	// OnDemandMinPodNum defaults to 1, the first pod is pinned to on-demand
+	first := createPod(t, client, "web-0", "web", nil)
+	if got := first.Spec.NodeSelector[capacityKey]; got != "on-demand" {
+		t.Errorf("first pod nodeSelector %v, want %s=on-demand", first.Spec.NodeSelector, capacityKey)
+	}
+	term := antiAffinityTerm(first)
+	if term == nil {
+		t.Fatalf("first pod affinity %+v, want the hostname anti-affinity term", first.Spec.Affinity)
+	}
+	if term.Weight != 100 || term.PodAffinityTerm.LabelSelector == nil || term.PodAffinityTerm.LabelSelector.MatchLabels["app"] != "web" {
+		t.Errorf("anti-affinity term %+v, want weight 100 selecting app=web", term)
+	}
+
+	// the pinned pod counts although it is not scheduled, the second is left to the scheduler
+	second := createPod(t, client, "web-1", "web", nil)
+	if _, ok := second.Spec.NodeSelector[capacityKey]; ok {
+		t.Errorf("second pod nodeSelector %v, want no %s", second.Spec.NodeSelector, capacityKey)
+	}
+	if antiAffinityTerm(second) != nil {
+		t.Errorf("second pod affinity %+v, want none injected", second.Spec.Affinity)
+	}
+
+	// the user's nodeSelector keys survive the patch
+	mixed := createPod(t, client, "api-0", "api", map[string]string{"disktype": "ssd"})
+	if mixed.Spec.NodeSelector["disktype"] != "ssd" || mixed.Spec.NodeSelector[capacityKey] != "on-demand" {
+		t.Errorf("pod nodeSelector %v, want disktype=ssd and %s=on-demand", mixed.Spec.NodeSelector, capacityKey)
+	}
+}